@@ -8,6 +8,7 @@ require (
 	github.com/creack/pty v1.1.21
 	github.com/fsnotify/fsnotify v1.8.0
 	github.com/gorilla/websocket v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.24
 	google.golang.org/grpc v1.71.0
 	google.golang.org/protobuf v1.36.5
 )
@@ -0,0 +1,347 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"glask-ide/internal/terminal"
+)
+
+const (
+	// defaultAgentSteps and maxAgentSteps bound the model round trips of a run
+	defaultAgentSteps = 10
+	maxAgentSteps     = 50
+
+	// agentApprovalTimeout is how long a run waits for the user to approve a
+	// write or command
+	agentApprovalTimeout = 10 * time.Minute
+)
+
+var (
+	// ErrAgentRunNotFound is returned when cancelling or approving an unknown run
+	ErrAgentRunNotFound = errors.New("agent run not found")
+
+	// ErrApprovalNotPending is returned when approving a tool call that is not waiting
+	ErrApprovalNotPending = errors.New("no approval pending for this tool call")
+
+	// ErrAgentStepLimit is returned when a run uses all its steps without finishing
+	ErrAgentStepLimit = errors.New("agent reached its step limit")
+)
+
+// AgentRequest starts an agent run
+type AgentRequest struct {
+	Task           string
+	ProjectPath    string // Workspace the tools are confined to; the server's directory when empty
+	ConversationID string // Optional conversation the task and final answer are recorded in
+	Editor         *EditorContext
+	MaxSteps       int
+	ModelID        string // Overrides the session's model
+	SessionID      string // Defaults to the conversation
+	Template       string // Prompt template the task is filled into
+	TemplateVars   map[string]string
+}
+
+// AgentEvent reports the progress of an agent run
+type AgentEvent struct {
+	RunID     string
+	Step      int
+	Type      string // "started", "step", "text", "tool_call", "approval_required", "tool_result", "done", "error", "cancelled"
+	Content   string // The command on "approval_required" events for commands
+	ToolCall  *ToolCall
+	Result    *ToolResult
+	Diff      string // Set on "approval_required" events for writes
+	Timestamp time.Time
+}
+
+// agentRun is the state of one in-flight agent run
+type agentRun struct {
+	id          string
+	projectPath string
+	cancel      context.CancelFunc
+	terminals   *terminal.Manager
+
+	mu        sync.Mutex
+	approvals map[string]chan bool // Pending approvals by tool call ID
+	session   *terminal.Session    // Terminal for run_command, created on first use
+}
+
+// agentRuns tracks in-flight runs so they can be cancelled and approved
+type agentRuns struct {
+	mu   sync.Mutex
+	runs map[string]*agentRun
+}
+
+func newAgentRuns() *agentRuns {
+	return &agentRuns{runs: make(map[string]*agentRun)}
+}
+
+func (a *agentRuns) get(id string) (*agentRun, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	run, ok := a.runs[id]
+	return run, ok
+}
+
+func (a *agentRuns) add(run *agentRun) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.runs[run.id] = run
+}
+
+func (a *agentRuns) remove(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.runs, id)
+}
+
+// RunAgent lets the model work on a task with workspace tools, reporting each
+// step through the callback until it answers without calling a tool. Once the
+// "started" event is sent, failures are also reported as events.
+func (s *service) RunAgent(ctx context.Context, req AgentRequest, callback func(AgentEvent) error) error {
+	if strings.TrimSpace(req.Task) == "" {
+		return fmt.Errorf("task is required")
+	}
+
+	maxSteps := req.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultAgentSteps
+	}
+	maxSteps = min(maxSteps, maxAgentSteps)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	run := &agentRun{
+		id:          generateID(),
+		projectPath: req.ProjectPath,
+		cancel:      cancel,
+		terminals:   s.terminals,
+		approvals:   make(map[string]chan bool),
+	}
+	s.agents.add(run)
+	defer func() {
+		s.agents.remove(run.id)
+		run.close()
+	}()
+
+	step := 0
+	emit := func(event AgentEvent) error {
+		event.RunID = run.id
+		event.Step = step
+		event.Timestamp = time.Now()
+		return callback(event)
+	}
+
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = req.ConversationID
+	}
+	activeModel, err := s.modelManager.ResolveModel(req.ModelID, sessionID)
+	if err != nil {
+		return err
+	}
+	// Every step runs on the same model, whatever the session selects meanwhile
+	opts := Options{
+		Temperature:  ptr(0.2),
+		MaxTokens:    s.getConfigForModel(activeModel.ID).MaxTokens,
+		Tools:        agentTools,
+		Editor:       req.Editor,
+		ModelID:      activeModel.ID,
+		Project:      run.projectPath,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	}
+
+	// The template is filled once; later steps keep its system prompt
+	rendered, opts, err := s.applyTemplate(req.Task, "", opts)
+	if err != nil {
+		return err
+	}
+	task := agentInstructions(run.projectPath) + rendered
+	messages := []Message{{Role: "user", Content: task}}
+	opts.pinnedMessage = 1
+	if req.ConversationID != "" {
+		if _, err := s.appendMessage(req.ConversationID, "user", req.Task, activeModel); err != nil {
+			return err
+		}
+		history, err := s.loadHistory(req.ConversationID, activeModel, opts)
+		if err != nil {
+			return err
+		}
+		if len(history) > 0 {
+			// The stored turn holds the bare task; the model also gets the instructions
+			history[len(history)-1].Content = task
+			messages = history
+			opts.pinnedMessage = len(history)
+		}
+	}
+
+	// Add memories and workspace context once, to the task itself, so they are kept across steps
+	project := run.projectPath
+	if project == "" {
+		project = req.Editor.projectPath()
+	}
+	messages = s.applyMemories(ctx, messages, project)
+	messages, _, err = s.applyEditorContext(messages, activeModel, opts)
+	if err != nil {
+		return err
+	}
+	opts.Editor = nil
+	opts.Feature = "agent"
+	opts.Project = project
+
+	if err := emit(AgentEvent{Type: "started"}); err != nil {
+		return err
+	}
+
+	for step = 1; step <= maxSteps; step++ {
+		if err := emit(AgentEvent{Type: "step"}); err != nil {
+			return err
+		}
+
+		resp, err := s.complete(ctx, messages, opts)
+		if err == nil && resp.Status == "failed" {
+			err = fmt.Errorf("completion failed: %s", resp.Error)
+		}
+		if err != nil {
+			return s.endAgentRun(ctx, emit, err)
+		}
+
+		if resp.Output != "" {
+			if err := emit(AgentEvent{Type: "text", Content: resp.Output}); err != nil {
+				return err
+			}
+		}
+
+		if len(resp.ToolCalls) == 0 {
+			if req.ConversationID != "" && resp.Output != "" {
+				if _, err := s.appendMessage(req.ConversationID, "assistant", resp.Output, activeModel); err != nil {
+					return err
+				}
+			}
+			return emit(AgentEvent{Type: "done", Content: resp.Output})
+		}
+
+		messages = append(messages, Message{Role: "assistant", Content: resp.Output, ToolCalls: resp.ToolCalls})
+
+		results := make([]ToolResult, 0, len(resp.ToolCalls))
+		for i := range resp.ToolCalls {
+			call := resp.ToolCalls[i]
+			if err := emit(AgentEvent{Type: "tool_call", ToolCall: &call}); err != nil {
+				return err
+			}
+
+			result := s.executeTool(ctx, run, call, emit)
+			if ctx.Err() != nil {
+				return s.endAgentRun(ctx, emit, ctx.Err())
+			}
+			if err := emit(AgentEvent{Type: "tool_result", ToolCall: &call, Result: &result}); err != nil {
+				return err
+			}
+			results = append(results, result)
+		}
+
+		messages = append(messages, Message{Role: "user", ToolResults: results})
+	}
+
+	step = maxSteps
+	emit(AgentEvent{Type: "error", Content: ErrAgentStepLimit.Error()})
+	return ErrAgentStepLimit
+}
+
+// endAgentRun reports why a run stopped early
+func (s *service) endAgentRun(ctx context.Context, emit func(AgentEvent) error, err error) error {
+	if ctx.Err() != nil {
+		emit(AgentEvent{Type: "cancelled", Content: "run cancelled"})
+		return context.Canceled
+	}
+	emit(AgentEvent{Type: "error", Content: err.Error()})
+	return err
+}
+
+// CancelAgent stops an in-flight run
+func (s *service) CancelAgent(runID string) error {
+	run, ok := s.agents.get(runID)
+	if !ok {
+		return ErrAgentRunNotFound
+	}
+	run.cancel()
+	return nil
+}
+
+// ApproveAgentAction answers a pending approval request from a run
+func (s *service) ApproveAgentAction(runID, callID string, approved bool) error {
+	run, ok := s.agents.get(runID)
+	if !ok {
+		return ErrAgentRunNotFound
+	}
+
+	run.mu.Lock()
+	decision, ok := run.approvals[callID]
+	if ok {
+		delete(run.approvals, callID)
+	}
+	run.mu.Unlock()
+	if !ok {
+		return ErrApprovalNotPending
+	}
+
+	decision <- approved
+	return nil
+}
+
+// awaitApproval blocks until the user approves or rejects a tool call
+func (r *agentRun) awaitApproval(ctx context.Context, callID string, request func() error) (bool, error) {
+	decision := make(chan bool, 1)
+	r.mu.Lock()
+	r.approvals[callID] = decision
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.approvals, callID)
+		r.mu.Unlock()
+	}()
+
+	if err := request(); err != nil {
+		return false, err
+	}
+
+	timer := time.NewTimer(agentApprovalTimeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-decision:
+		return approved, nil
+	case <-timer.C:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// close releases the run's terminal session
+func (r *agentRun) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session != nil {
+		r.terminals.CloseSession(r.session.ID)
+		r.session = nil
+	}
+}
+
+// agentInstructions tells the model how to work with the tools
+func agentInstructions(projectPath string) string {
+	var b strings.Builder
+	b.WriteString("You are a coding agent working in the user's project. ")
+	if projectPath != "" {
+		fmt.Fprintf(&b, "The project root is %s; relative paths are resolved against it. ", projectPath)
+	}
+	b.WriteString("Use the tools to inspect the code before changing it, and keep changes minimal. ")
+	b.WriteString("File writes and commands need the user's approval; if one is rejected, do not retry it unchanged. ")
+	b.WriteString("When the task is complete, reply with a short summary and no tool calls.\n\nTask: ")
+	return b.String()
+}
@@ -0,0 +1,472 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"glask-ide/internal/filesystem"
+	"glask-ide/internal/terminal"
+)
+
+const (
+	// maxToolOutput caps the text returned to the model from a single tool call
+	maxToolOutput = 16000
+
+	maxListedEntries  = 500
+	maxReadLines      = 1000
+	maxSearchResults  = 50
+	defaultCmdTimeout = 60 * time.Second
+	maxCmdTimeout     = 5 * time.Minute
+)
+
+// agentTools are the built-in tools offered to the model during agent runs
+var agentTools = []ToolDefinition{
+	{
+		Name:        "list_directory",
+		Description: "List the files and directories at a path in the project.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{
+			"path":{"type":"string","description":"Directory path, relative to the project root"},
+			"recursive":{"type":"boolean","description":"Include nested directories"}}}`),
+	},
+	{
+		Name:        "read_file",
+		Description: "Read a file with line numbers. Use startLine and endLine to read part of a large file.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{
+			"path":{"type":"string"},
+			"startLine":{"type":"integer","description":"First line to read (1-based)"},
+			"endLine":{"type":"integer","description":"Last line to read (inclusive)"}},
+			"required":["path"]}`),
+	},
+	{
+		Name:        "search_content",
+		Description: "Search file contents in the project for a case-insensitive substring.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{
+			"query":{"type":"string"},
+			"path":{"type":"string","description":"Directory to search, relative to the project root"},
+			"filePattern":{"type":"string","description":"Glob matched against file names, e.g. *.go"}},
+			"required":["query"]}`),
+	},
+	{
+		Name:        "write_file",
+		Description: "Create or overwrite a file with the given content. The user must approve the change.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{
+			"path":{"type":"string"},
+			"content":{"type":"string","description":"Complete new file content"}},
+			"required":["path","content"]}`),
+	},
+	{
+		Name:        "run_command",
+		Description: "Run a shell command in the project's terminal and return its output and exit code. The user must approve the command.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{
+			"command":{"type":"string"},
+			"timeoutSeconds":{"type":"integer","description":"Maximum run time (default 60, at most 300)"}},
+			"required":["command"]}`),
+	},
+}
+
+// executeTool runs a tool call and returns its result; failures are reported
+// to the model as error results rather than ending the run
+func (s *service) executeTool(ctx context.Context, run *agentRun, call ToolCall, emit func(AgentEvent) error) ToolResult {
+	result := ToolResult{CallID: call.ID, Name: call.Name}
+
+	var (
+		output string
+		err    error
+	)
+	switch call.Name {
+	case "list_directory":
+		output, err = s.toolListDirectory(run, call.Arguments)
+	case "read_file":
+		output, err = s.toolReadFile(run, call.Arguments)
+	case "search_content":
+		output, err = s.toolSearchContent(run, call.Arguments)
+	case "write_file":
+		output, err = s.toolWriteFile(ctx, run, call, emit)
+	case "run_command":
+		output, err = run.toolRunCommand(ctx, call, emit)
+	default:
+		err = fmt.Errorf("unknown tool %q", call.Name)
+	}
+
+	if err != nil {
+		result.Content = err.Error()
+		result.IsError = true
+		return result
+	}
+	result.Content = truncateToolOutput(output)
+	return result
+}
+
+func (s *service) toolListDirectory(run *agentRun, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Path      string `json:"path"`
+		Recursive bool   `json:"recursive"`
+	}
+	if err := decodeToolArgs(rawArgs, &args); err != nil {
+		return "", err
+	}
+
+	dir, err := run.resolvePath(args.Path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := s.edits.fs.ListDirectory(dir, args.Recursive)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, entry := range entries {
+		if i == maxListedEntries {
+			fmt.Fprintf(&b, "... %d more entries\n", len(entries)-i)
+			break
+		}
+		rel, err := filepath.Rel(dir, entry.Path)
+		if err != nil {
+			rel = entry.Path
+		}
+		if entry.IsDir {
+			fmt.Fprintf(&b, "%s/\n", rel)
+		} else {
+			fmt.Fprintf(&b, "%s (%d bytes)\n", rel, entry.Size)
+		}
+	}
+	if b.Len() == 0 {
+		return "(empty directory)", nil
+	}
+	return b.String(), nil
+}
+
+func (s *service) toolReadFile(run *agentRun, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"startLine"`
+		EndLine   int    `json:"endLine"`
+	}
+	if err := decodeToolArgs(rawArgs, &args); err != nil {
+		return "", err
+	}
+
+	path, err := run.resolvePath(args.Path)
+	if err != nil {
+		return "", err
+	}
+	content, err := s.edits.fs.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	lines := splitLines(string(content))
+	start := max(args.StartLine, 1)
+	end := len(lines)
+	if args.EndLine > 0 {
+		end = min(args.EndLine, len(lines))
+	}
+	if start > end {
+		return fmt.Sprintf("(file has %d lines)", len(lines)), nil
+	}
+
+	var b strings.Builder
+	for i := start; i <= end; i++ {
+		if i-start == maxReadLines {
+			fmt.Fprintf(&b, "... truncated; read from line %d to continue (file has %d lines)\n", i, len(lines))
+			break
+		}
+		fmt.Fprintf(&b, "%d| %s\n", i, lines[i-1])
+	}
+	return b.String(), nil
+}
+
+func (s *service) toolSearchContent(run *agentRun, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Query       string `json:"query"`
+		Path        string `json:"path"`
+		FilePattern string `json:"filePattern"`
+	}
+	if err := decodeToolArgs(rawArgs, &args); err != nil {
+		return "", err
+	}
+
+	root, err := run.resolvePath(args.Path)
+	if err != nil {
+		return "", err
+	}
+
+	opts := filesystem.SearchOptions{Query: args.Query, Path: root, MaxResults: maxSearchResults}
+	if args.FilePattern != "" {
+		opts.FilePatterns = []string{args.FilePattern}
+	}
+	refs, err := s.edits.fs.SearchContent(opts)
+	if err != nil {
+		return "", err
+	}
+	if len(refs) == 0 {
+		return "no matches", nil
+	}
+
+	var b strings.Builder
+	for _, ref := range refs {
+		rel, err := filepath.Rel(root, ref.Path)
+		if err != nil {
+			rel = ref.Path
+		}
+		fmt.Fprintf(&b, "%s:%d: %s\n", rel, ref.Line, ref.Context)
+	}
+	if len(refs) == maxSearchResults {
+		b.WriteString("... more matches omitted; narrow the search\n")
+	}
+	return b.String(), nil
+}
+
+// toolWriteFile proposes a whole-file replacement and applies it once the user approves
+func (s *service) toolWriteFile(ctx context.Context, run *agentRun, call ToolCall, emit func(AgentEvent) error) (string, error) {
+	var args struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if err := decodeToolArgs(call.Arguments, &args); err != nil {
+		return "", err
+	}
+
+	path, err := run.resolvePath(args.Path)
+	if err != nil {
+		return "", err
+	}
+
+	// A range ending on the line after the last one covers the whole file
+	current, _ := s.readSource(path)
+	proposal, err := s.edits.propose("", []TextEdit{{
+		FilePath: path,
+		Range:    TextRange{StartLine: 1, StartColumn: 1, EndLine: strings.Count(current, "\n") + 2, EndColumn: 1},
+		NewText:  args.Content,
+	}})
+	if err != nil {
+		return "", err
+	}
+	if proposal.Diff() == "" {
+		return "file already has this content", nil
+	}
+
+	approved, err := run.awaitApproval(ctx, call.ID, func() error {
+		return emit(AgentEvent{Type: "approval_required", ToolCall: &call, Diff: proposal.Diff()})
+	})
+	if err != nil {
+		return "", err
+	}
+	if !approved {
+		return "", fmt.Errorf("the user rejected this change")
+	}
+
+	applied, err := s.edits.apply(proposal.ID, nil)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote %s (undo id %s)", args.Path, applied.ID), nil
+}
+
+// ansiEscape matches terminal control sequences stripped from command output
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>]`)
+
+// toolRunCommand runs a command in the run's terminal session once the user
+// approves it, since a command can change anything a write can. Markers
+// printed around the command delimit its output and carry the exit code; the
+// nonce keeps the shell's echo of the input from matching them.
+func (r *agentRun) toolRunCommand(ctx context.Context, call ToolCall, emit func(AgentEvent) error) (string, error) {
+	var args struct {
+		Command        string `json:"command"`
+		TimeoutSeconds int    `json:"timeoutSeconds"`
+	}
+	if err := decodeToolArgs(call.Arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Command) == "" {
+		return "", fmt.Errorf("command is required")
+	}
+
+	approved, err := r.awaitApproval(ctx, call.ID, func() error {
+		return emit(AgentEvent{Type: "approval_required", ToolCall: &call, Content: args.Command})
+	})
+	if err != nil {
+		return "", err
+	}
+	if !approved {
+		return "", fmt.Errorf("the user rejected this command")
+	}
+
+	timeout := defaultCmdTimeout
+	if args.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(args.TimeoutSeconds)*time.Second, maxCmdTimeout)
+	}
+
+	session, err := r.terminal()
+	if err != nil {
+		return "", err
+	}
+
+	nonceBytes := make([]byte, 6)
+	rand.Read(nonceBytes)
+	nonce := hex.EncodeToString(nonceBytes)
+	exitPattern := regexp.MustCompile(`__AGENT_` + nonce + `_EXIT_(\d+)__`)
+
+	output, unsubscribe := session.Subscribe()
+	defer unsubscribe()
+
+	script := fmt.Sprintf("printf '__AGENT_%%s_START__\\n' %s; %s\nprintf '__AGENT_%%s_EXIT_%%d__\\n' %s $?\n",
+		nonce, args.Command, nonce)
+	if err := session.Write([]byte(script)); err != nil {
+		return "", fmt.Errorf("failed to write to terminal: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var buf bytes.Buffer
+	for {
+		select {
+		case chunk := <-output:
+			buf.Write(chunk)
+			text := ansiEscape.ReplaceAllString(buf.String(), "")
+			if match := exitPattern.FindStringSubmatchIndex(text); match != nil {
+				exitCode, _ := strconv.Atoi(text[match[2]:match[3]])
+				return formatCommandOutput(text[:match[0]], nonce, exitCode), nil
+			}
+
+		case <-timer.C:
+			session.Write([]byte{3}) // Ctrl-C
+			text := ansiEscape.ReplaceAllString(buf.String(), "")
+			return formatCommandOutput(text, nonce, -1) + fmt.Sprintf("\n(timed out after %s and was interrupted)", timeout), nil
+
+		case <-session.Done():
+			return "", fmt.Errorf("terminal session ended")
+
+		case <-ctx.Done():
+			session.Write([]byte{3})
+			return "", ctx.Err()
+		}
+	}
+}
+
+// formatCommandOutput extracts the command's output from after the start
+// marker, dropping the shell's echo of the marker commands
+func formatCommandOutput(text, nonce string, exitCode int) string {
+	if i := strings.Index(text, "__AGENT_"+nonce+"_START__"); i >= 0 {
+		text = text[i:]
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		if !strings.Contains(line, nonce) {
+			lines = append(lines, line)
+		}
+	}
+	text = strings.Trim(strings.Join(lines, "\n"), "\n")
+
+	if exitCode < 0 {
+		return text
+	}
+	return fmt.Sprintf("%s\n(exit code %d)", text, exitCode)
+}
+
+// terminal returns the run's terminal session, starting it in the project directory
+func (r *agentRun) terminal() (*terminal.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.session != nil {
+		return r.session, nil
+	}
+	if r.terminals == nil {
+		return nil, fmt.Errorf("terminal service is not available")
+	}
+
+	session, err := r.terminals.NewSession(terminal.SessionOptions{Dir: r.projectPath})
+	if err != nil {
+		return nil, err
+	}
+	r.session = session
+	return session, nil
+}
+
+// resolvePath resolves a tool path against the project root, following
+// symlinks, and keeps it inside the project
+func (r *agentRun) resolvePath(path string) (string, error) {
+	root := r.projectPath
+	if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", fmt.Errorf("project directory is not available: %v", err)
+	}
+
+	if path == "" {
+		return root, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := evalExistingSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the project", path)
+	}
+	return resolved, nil
+}
+
+// evalExistingSymlinks follows the symlinks in the part of a clean absolute
+// path that exists, so a file that is about to be created resolves too
+func evalExistingSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	resolvedParent, err := evalExistingSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+func decodeToolArgs(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// truncateToolOutput keeps the start and end of long output
+func truncateToolOutput(output string) string {
+	if len(output) <= maxToolOutput {
+		return output
+	}
+	head := output[:maxToolOutput/4]
+	tail := output[len(output)-maxToolOutput*3/4:]
+	return fmt.Sprintf("%s\n... (%d bytes omitted) ...\n%s", head, len(output)-len(head)-len(tail), tail)
+}
@@ -0,0 +1,232 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// diskPruneInterval is how many disk writes pass between sweeps of the disk tier
+const diskPruneInterval = 100
+
+// CacheConfig sizes the response cache of deterministic completions
+type CacheConfig struct {
+	Entries     int           // In-memory entries; 0 disables the cache
+	TTL         time.Duration // Age after which entries are stale; 0 never expires them
+	Dir         string        // Directory of the on-disk tier; disabled when empty
+	DiskEntries int           // Most entries kept on disk
+}
+
+// DefaultCacheConfig returns the cache settings used unless configured otherwise.
+// The disk tier is off until a directory is set.
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Entries:     256,
+		TTL:         24 * time.Hour,
+		DiskEntries: 2000,
+	}
+}
+
+// responseCache is a content-addressed cache of completions with an LRU
+// memory tier in front of an optional directory of JSON files
+type responseCache struct {
+	memory      *lruCache[Response]
+	ttl         time.Duration
+	dir         string
+	diskEntries int
+	writes      atomic.Int64
+}
+
+// newResponseCache creates the cache, or returns nil when it is disabled
+func newResponseCache(config CacheConfig) (*responseCache, error) {
+	if config.Entries <= 0 {
+		return nil, nil
+	}
+
+	c := &responseCache{
+		memory:      newLRUCache[Response](config.Entries, config.TTL),
+		ttl:         config.TTL,
+		dir:         config.Dir,
+		diskEntries: config.DiskEntries,
+	}
+	if c.dir != "" {
+		if err := os.MkdirAll(c.dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		c.prune()
+	}
+	return c, nil
+}
+
+// Get returns a cached response, promoting disk hits to memory
+func (c *responseCache) Get(key string) (Response, bool) {
+	if c == nil {
+		return Response{}, false
+	}
+	if resp, ok := c.memory.Get(key); ok {
+		return resp, true
+	}
+	if c.dir == "" {
+		return Response{}, false
+	}
+
+	path := c.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		return Response{}, false
+	}
+	if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+		os.Remove(path)
+		return Response{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Response{}, false
+	}
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		// A partial or outdated file; it is rewritten on the next miss
+		os.Remove(path)
+		return Response{}, false
+	}
+
+	c.memory.Put(key, resp)
+	return resp, true
+}
+
+// Put stores a response in memory and, when enabled, on disk
+func (c *responseCache) Put(key string, resp Response) {
+	if c == nil {
+		return
+	}
+	c.memory.Put(key, resp)
+	if c.dir == "" {
+		return
+	}
+
+	if err := c.writeFile(key, resp); err != nil {
+		// The disk tier is best effort; the memory tier still has the entry
+		fmt.Printf("Error writing response cache: %v\n", err)
+		return
+	}
+	if c.writes.Add(1)%diskPruneInterval == 0 {
+		go c.prune()
+	}
+}
+
+// writeFile saves an entry through a temporary file so readers never see a partial one
+func (c *responseCache) writeFile(key string, resp Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// prune removes expired entries from disk, then the oldest ones above the size limit
+func (c *responseCache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		fmt.Printf("Error reading response cache: %v\n", err)
+		return
+	}
+
+	type diskEntry struct {
+		path    string
+		modTime time.Time
+	}
+	var kept []diskEntry
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(c.dir, entry.Name())
+		if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+			os.Remove(path)
+			continue
+		}
+		kept = append(kept, diskEntry{path: path, modTime: info.ModTime()})
+	}
+
+	if c.diskEntries <= 0 || len(kept) <= c.diskEntries {
+		return
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].modTime.Before(kept[j].modTime) })
+	for _, entry := range kept[:len(kept)-c.diskEntries] {
+		if err := os.Remove(entry.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Error pruning response cache: %v\n", err)
+		}
+	}
+}
+
+func (c *responseCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// cacheable reports whether a request's response may be cached: only
+// deterministic completions without tools qualify
+func cacheable(opts Options) bool {
+	return !opts.NoCache && !opts.Stream && len(opts.Tools) == 0 &&
+		opts.Temperature != nil && *opts.Temperature == 0
+}
+
+// responseCacheKey addresses a completion by everything that shapes its output:
+// the provider and model, the generation options that reach the provider and
+// the prompt itself
+func responseCacheKey(model ModelInfo, config Config, messages []Message, opts Options) string {
+	// Stop sequences act as a set, so their order does not split the cache
+	stop := append([]string(nil), opts.StopSequences...)
+	sort.Strings(stop)
+
+	promptJSON, _ := json.Marshal(messages)
+	promptHash := sha256.Sum256(promptJSON)
+
+	key, _ := json.Marshal(struct {
+		Provider     string
+		Model        string
+		SystemPrompt string
+		Temperature  float64
+		MaxTokens    int
+		Stop         []string
+		TopP         float64
+		TopK         int
+		Prompt       string
+	}{
+		Provider:     model.Provider,
+		Model:        config.Model,
+		SystemPrompt: config.SystemPrompt,
+		Temperature:  *opts.Temperature,
+		MaxTokens:    opts.MaxTokens,
+		Stop:         stop,
+		TopP:         opts.TopP,
+		TopK:         opts.TopK,
+		Prompt:       hex.EncodeToString(promptHash[:]),
+	})
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
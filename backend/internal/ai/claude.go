@@ -6,35 +6,57 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 const claudeAPIURL = "https://api.anthropic.com/v1/messages"
 
 type claudeRequest struct {
-	Model       string    `json:"model"`
-	Messages    []message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
-	Stream      bool      `json:"stream,omitempty"`
-	Stop        []string  `json:"stop,omitempty"`
+	Model       string       `json:"model"`
+	Messages    []message    `json:"messages"`
+	MaxTokens   int          `json:"max_tokens,omitempty"`
+	Temperature *float64     `json:"temperature,omitempty"`
+	Stream      bool         `json:"stream,omitempty"`
+	Stop        []string     `json:"stop,omitempty"`
+	Tools       []claudeTool `json:"tools,omitempty"`
 }
 
 type message struct {
 	Role    string `json:"role"`
-	Content string `json:"content"`
+	Content any    `json:"content"` // A string, or content blocks for tool use
 }
 
-func buildClaudeRequest(ctx context.Context, prompt string, config Config, opts Options) (*http.Request, error) {
+type claudeTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// claudeContentBlock is one element of a structured message body
+type claudeContentBlock struct {
+	Type string `json:"type"` // "text", "tool_use", "tool_result"
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+func buildClaudeRequest(ctx context.Context, messages []Message, config Config, opts Options) (*http.Request, error) {
 	reqBody := claudeRequest{
-		Model: config.Model,
-		Messages: []message{
-			{Role: "system", Content: config.SystemPrompt},
-			{Role: "user", Content: prompt},
-		},
+		Model:       config.Model,
+		Messages:    claudeMessages(messages, config),
 		MaxTokens:   opts.MaxTokens,
 		Temperature: opts.Temperature,
 		Stream:      opts.Stream,
 		Stop:        opts.StopSequences,
+		Tools:       claudeTools(opts.Tools),
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -54,13 +76,64 @@ func buildClaudeRequest(ctx context.Context, prompt string, config Config, opts
 	return req, nil
 }
 
+// claudeMessages converts a message list, led by the system prompt
+func claudeMessages(messages []Message, config Config) []message {
+	result := make([]message, 0, len(messages)+1)
+	result = append(result, message{Role: "system", Content: config.SystemPrompt})
+	for _, msg := range messages {
+		result = append(result, message{Role: msg.Role, Content: claudeContent(msg)})
+	}
+	return result
+}
+
+func claudeTools(tools []ToolDefinition) []claudeTool {
+	var result []claudeTool
+	for _, tool := range tools {
+		result = append(result, claudeTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.Parameters,
+		})
+	}
+	return result
+}
+
+// claudeContent returns a plain string for ordinary turns and content blocks
+// for turns that carry tool calls or results
+func claudeContent(msg Message) any {
+	if len(msg.ToolCalls) == 0 && len(msg.ToolResults) == 0 {
+		return msg.Content
+	}
+
+	var blocks []claudeContentBlock
+	if msg.Content != "" {
+		blocks = append(blocks, claudeContentBlock{Type: "text", Text: msg.Content})
+	}
+	for _, call := range msg.ToolCalls {
+		input := call.Arguments
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		blocks = append(blocks, claudeContentBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+	}
+	for _, result := range msg.ToolResults {
+		blocks = append(blocks, claudeContentBlock{
+			Type:      "tool_result",
+			ToolUseID: result.CallID,
+			Content:   result.Content,
+			IsError:   result.IsError,
+		})
+	}
+	return blocks
+}
+
 type claudeResponse struct {
-	ID         string `json:"id"`
-	Type       string `json:"type"`
-	Role       string `json:"role"`
-	Content    string `json:"content"`
-	StopReason string `json:"stop_reason,omitempty"`
-	Model      string `json:"model"`
+	ID         string             `json:"id"`
+	Type       string             `json:"type"`
+	Role       string             `json:"role"`
+	Content    claudeResponseBody `json:"content"`
+	StopReason string             `json:"stop_reason,omitempty"`
+	Model      string             `json:"model"`
 	Usage      struct {
 		InputTokens  int `json:"input_tokens"`
 		OutputTokens int `json:"output_tokens"`
@@ -68,11 +141,35 @@ type claudeResponse struct {
 	} `json:"usage"`
 }
 
+// claudeResponseBody accepts response content either as a plain string or as content blocks
+type claudeResponseBody []claudeContentBlock
+
+func (b *claudeResponseBody) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = claudeResponseBody{{Type: "text", Text: text}}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]claudeContentBlock)(b))
+}
+
 func parseClaudeResponse(resp *claudeResponse) *Response {
+	var output strings.Builder
+	var toolCalls []ToolCall
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			output.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: block.Input})
+		}
+	}
+
 	return &Response{
-		ID:     resp.ID,
-		Status: "succeeded",
-		Output: resp.Content,
+		ID:        resp.ID,
+		Status:    "succeeded",
+		Output:    output.String(),
+		ToolCalls: toolCalls,
 		Metrics: Metrics{
 			TotalTokens:      resp.Usage.TotalTokens,
 			PromptTokens:     resp.Usage.InputTokens,
@@ -82,19 +179,33 @@ func parseClaudeResponse(resp *claudeResponse) *Response {
 }
 
 type claudeStreamChunk struct {
-	Type    string `json:"type"`
-	Content string `json:"content"`
-	Done    bool   `json:"done"`
+	Type       string `json:"type"`
+	Content    string `json:"content"`
+	Done       bool   `json:"done"`
+	StopReason string `json:"stop_reason,omitempty"`
 }
 
 func parseClaudeStreamChunk(chunk *claudeStreamChunk) StreamChunk {
 	chunkType := "text"
+	stopReason := ""
 	if chunk.Done {
 		chunkType = "done"
+		stopReason = claudeStopReason(chunk.StopReason)
 	}
 
 	return StreamChunk{
-		Type:    chunkType,
-		Content: chunk.Content,
+		Type:       chunkType,
+		Content:    chunk.Content,
+		StopReason: stopReason,
+	}
+}
+
+// claudeStopReason maps Claude's stop reasons to the ones reported to clients
+func claudeStopReason(reason string) string {
+	switch reason {
+	case "", "end_turn":
+		return "end"
+	default:
+		return reason // "max_tokens", "stop_sequence", "tool_use"
 	}
 }
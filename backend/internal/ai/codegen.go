@@ -0,0 +1,385 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// maxEditAttempts is how many times a model is asked for well-formed edits
+// before giving up; later attempts include the previous error as feedback
+const maxEditAttempts = 2
+
+// GenerateRequest asks for new code described in natural language
+type GenerateRequest struct {
+	Prompt    string
+	FilePath  string // Target file; created if it does not exist
+	Language  string
+	Editor    *EditorContext // Cursor position used as the insertion point
+	ModelID   string
+	SessionID string
+
+	// Template fills the prompt into a prompt template; the edit format is added after it
+	Template     string
+	TemplateVars map[string]string
+}
+
+// RefactorRequest asks for a change to existing code
+type RefactorRequest struct {
+	FilePath    string
+	Selection   *TextRange // Code to refactor; the whole file when nil
+	Instruction string
+	Editor      *EditorContext
+	ModelID     string
+	SessionID   string
+
+	// Template fills the instruction into a prompt template
+	Template     string
+	TemplateVars map[string]string
+}
+
+// AnalyzeRequest asks for a review of a file
+type AnalyzeRequest struct {
+	FilePath  string
+	Code      string // Unsaved buffer contents; read from disk when empty
+	Editor    *EditorContext
+	ModelID   string
+	SessionID string
+	NoCache   bool // Ask the model even if an identical review is cached
+
+	// Template replaces the review request; the code is available to it as .Code
+	Template     string
+	TemplateVars map[string]string
+}
+
+// CodeIssue is a single finding from code analysis
+type CodeIssue struct {
+	Severity   string `json:"severity"` // "error", "warning", "info"
+	Message    string `json:"message"`
+	StartLine  int    `json:"startLine"`
+	EndLine    int    `json:"endLine"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// CodeAnalysis is the result of analyzing a file
+type CodeAnalysis struct {
+	Summary  string
+	Issues   []CodeIssue
+	Proposal *EditProposal // Fixes for the issues, when the model suggested any
+}
+
+// modelEdit is the JSON shape edits are requested in
+type modelEdit struct {
+	FilePath    string `json:"filePath"`
+	StartLine   int    `json:"startLine"`
+	StartColumn int    `json:"startColumn"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+	NewText     string `json:"newText"`
+}
+
+// modelEditResponse is the JSON document the model is asked to return
+type modelEditResponse struct {
+	Explanation string      `json:"explanation"`
+	Summary     string      `json:"summary"`
+	Issues      []CodeIssue `json:"issues"`
+	Edits       []modelEdit `json:"edits"`
+}
+
+const editFormatInstructions = `Respond with a single JSON object and nothing else:
+{"explanation": "<short description of the change>",
+ "edits": [{"filePath": "<path>", "startLine": 1, "startColumn": 1, "endLine": 1, "endColumn": 1, "newText": "<replacement>"}]}
+Lines and columns are 1-based. The range is half-open: it starts at (startLine, startColumn) and ends just before (endLine, endColumn).
+An empty range inserts newText. To replace whole lines, end the range at column 1 of the line after the last replaced line.
+Line numbers refer to the numbered listing below; never include the "N| " prefixes in newText. Edits must not overlap.`
+
+// GenerateCode asks the model for new code and returns it as an edit proposal
+func (s *service) GenerateCode(ctx context.Context, req GenerateRequest) (*EditProposal, error) {
+	if strings.TrimSpace(req.Prompt) == "" {
+		return nil, fmt.Errorf("prompt is required")
+	}
+	if req.FilePath == "" && req.Editor != nil {
+		req.FilePath = req.Editor.FilePath
+	}
+	if req.FilePath == "" {
+		return nil, fmt.Errorf("file path is required")
+	}
+
+	content, err := s.readSource(req.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	prompt, opts, err := s.applyTemplate(req.Prompt, content, Options{
+		Temperature:  ptr(0.7),
+		Editor:       req.Editor,
+		ModelID:      req.ModelID,
+		SessionID:    req.SessionID,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+		Feature:      "generate",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Generate code for this request: %s\n\n", prompt)
+	if req.Language != "" {
+		fmt.Fprintf(&b, "Language: %s\n", req.Language)
+	}
+	if content == "" {
+		fmt.Fprintf(&b, "The file %s does not exist yet; create it with a single edit at line 1, column 1.\n\n", req.FilePath)
+	} else if req.Editor != nil && req.Editor.CursorLine > 0 {
+		fmt.Fprintf(&b, "Insert the code at line %d, column %d of %s unless other edits are needed for it to compile (e.g. imports).\n\n",
+			req.Editor.CursorLine, max(req.Editor.CursorColumn, 1), req.FilePath)
+	}
+	b.WriteString(editFormatInstructions)
+	writeNumberedFile(&b, req.FilePath, content)
+
+	resp, proposal, err := s.requestEdits(ctx, b.String(), opts)
+	if err != nil {
+		return nil, err
+	}
+	if proposal == nil {
+		return nil, fmt.Errorf("model returned no edits: %s", resp.Explanation)
+	}
+	return proposal, nil
+}
+
+// RefactorCode asks the model to rewrite existing code and returns the change as an edit proposal
+func (s *service) RefactorCode(ctx context.Context, req RefactorRequest) (*EditProposal, error) {
+	if strings.TrimSpace(req.Instruction) == "" {
+		return nil, fmt.Errorf("instruction is required")
+	}
+	if req.FilePath == "" {
+		return nil, fmt.Errorf("file path is required")
+	}
+
+	content, err := s.readSource(req.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	if content == "" {
+		return nil, fmt.Errorf("%s: %w", req.FilePath, os.ErrNotExist)
+	}
+	instruction, opts, err := s.applyTemplate(req.Instruction, content, Options{
+		Temperature:  ptr(0.1),
+		Editor:       req.Editor,
+		ModelID:      req.ModelID,
+		SessionID:    req.SessionID,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+		Feature:      "refactor",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Refactor the code in %s: %s\n", req.FilePath, instruction)
+	if req.Selection != nil {
+		fmt.Fprintf(&b, "Limit the change to lines %d-%d unless callers or imports elsewhere must change with it.\n",
+			req.Selection.StartLine, req.Selection.EndLine)
+	}
+	b.WriteString("Preserve behaviour and keep edits as small as possible.\n\n")
+	b.WriteString(editFormatInstructions)
+	writeNumberedFile(&b, req.FilePath, content)
+
+	resp, proposal, err := s.requestEdits(ctx, b.String(), opts)
+	if err != nil {
+		return nil, err
+	}
+	if proposal == nil {
+		return nil, fmt.Errorf("model returned no edits: %s", resp.Explanation)
+	}
+	return proposal, nil
+}
+
+// AnalyzeCode reviews a file and returns its issues, with fixes as an edit proposal when possible
+func (s *service) AnalyzeCode(ctx context.Context, req AnalyzeRequest) (*CodeAnalysis, error) {
+	if req.FilePath == "" {
+		return nil, fmt.Errorf("file path is required")
+	}
+
+	onDisk, err := s.readSource(req.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	content := req.Code
+	if content == "" {
+		content = onDisk
+	}
+	// Fixes can only be applied when they were computed against the file on disk
+	fixable := content == onDisk
+
+	review := fmt.Sprintf("Review %s for bugs, security problems and maintainability issues.", req.FilePath)
+	review, opts, err := s.applyTemplate(review, content, Options{
+		Temperature:  ptr(0.0), // Deterministic, so reviews of unchanged code are served from the cache
+		Editor:       req.Editor,
+		ModelID:      req.ModelID,
+		SessionID:    req.SessionID,
+		NoCache:      req.NoCache,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+		Feature:      "analyze",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString(review + "\n")
+	b.WriteString(`Respond with a single JSON object and nothing else:
+{"summary": "<one paragraph overview>",
+ "issues": [{"severity": "error|warning|info", "message": "<problem>", "startLine": 1, "endLine": 1, "suggestion": "<how to fix>"}]`)
+	if fixable {
+		b.WriteString(`,
+ "edits": [<edits fixing the issues, in the format below; empty if none are safe to make>]}
+
+`)
+		b.WriteString(editFormatInstructions)
+	} else {
+		b.WriteString("}\n")
+	}
+	writeNumberedFile(&b, req.FilePath, content)
+
+	resp, proposal, err := s.requestEdits(ctx, b.String(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &CodeAnalysis{
+		Summary:  resp.Summary,
+		Issues:   resp.Issues,
+		Proposal: proposal,
+	}
+	if analysis.Summary == "" {
+		analysis.Summary = resp.Explanation
+	}
+	if proposal != nil && proposal.Explanation == "" {
+		proposal.Explanation = analysis.Summary
+	}
+	return analysis, nil
+}
+
+// ApplyEdits applies a stored proposal, or an explicit list of edits, as one undoable step
+func (s *service) ApplyEdits(proposalID string, edits []TextEdit) (*AppliedEdits, error) {
+	if proposalID == "" && len(edits) == 0 {
+		return nil, fmt.Errorf("a proposal ID or edits are required")
+	}
+	return s.edits.apply(proposalID, edits)
+}
+
+// UndoEdits reverts a previously applied edit set and returns the restored files
+func (s *service) UndoEdits(appliedID string) ([]string, error) {
+	return s.edits.undo(appliedID)
+}
+
+// requestEdits sends a prompt asking for JSON edits and turns the reply into
+// a validated proposal. Malformed JSON or edits that fail validation are sent
+// back to the model once so it can correct them.
+func (s *service) requestEdits(ctx context.Context, prompt string, opts Options) (*modelEditResponse, *EditProposal, error) {
+	messages := []Message{{Role: "user", Content: prompt}}
+	if opts.Project == "" {
+		opts.Project = opts.Editor.projectPath()
+	}
+
+	// Retries go to the same model even if the session switches meanwhile
+	model, err := s.resolveModel(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.ModelID = model.ID
+
+	var lastErr error
+	for attempt := 0; attempt < maxEditAttempts; attempt++ {
+		resp, err := s.complete(ctx, messages, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.Status == "failed" {
+			return nil, nil, fmt.Errorf("completion failed: %s", resp.Error)
+		}
+
+		parsed, err := parseEditResponse(resp.Output)
+		if err == nil {
+			var proposal *EditProposal
+			if len(parsed.Edits) > 0 {
+				proposal, err = s.edits.propose(parsed.Explanation, toTextEdits(parsed.Edits))
+			}
+			if err == nil {
+				return parsed, proposal, nil
+			}
+		}
+		lastErr = err
+
+		// Workspace context is already part of the first message
+		opts.Editor = nil
+		messages = append(messages,
+			Message{Role: "assistant", Content: resp.Output},
+			Message{Role: "user", Content: fmt.Sprintf("That response could not be used: %v. Reply again with corrected JSON only.", err)},
+		)
+	}
+
+	return nil, nil, fmt.Errorf("model did not return usable edits: %w", lastErr)
+}
+
+// readSource reads a file as text, treating a missing file as empty
+func (s *service) readSource(path string) (string, error) {
+	content, err := s.edits.fs.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return string(content), nil
+}
+
+// parseEditResponse extracts the JSON object from a model reply, tolerating
+// markdown fences and surrounding prose
+func parseEditResponse(output string) (*modelEditResponse, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object found")
+	}
+
+	var parsed modelEditResponse
+	if err := json.Unmarshal([]byte(output[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return &parsed, nil
+}
+
+func toTextEdits(edits []modelEdit) []TextEdit {
+	result := make([]TextEdit, len(edits))
+	for i, e := range edits {
+		result[i] = TextEdit{
+			FilePath: e.FilePath,
+			Range: TextRange{
+				StartLine:   e.StartLine,
+				StartColumn: e.StartColumn,
+				EndLine:     e.EndLine,
+				EndColumn:   e.EndColumn,
+			},
+			NewText: e.NewText,
+		}
+	}
+	return result
+}
+
+// writeNumberedFile appends a file listing with line numbers the model can reference
+func writeNumberedFile(b *strings.Builder, path, content string) {
+	fmt.Fprintf(b, "\n\nFile: %s\n", path)
+	if content == "" {
+		b.WriteString("(empty)\n")
+		return
+	}
+	for i, line := range splitLines(content) {
+		fmt.Fprintf(b, "%d| %s\n", i+1, line)
+	}
+}
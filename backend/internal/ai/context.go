@@ -0,0 +1,474 @@
+package ai
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"glask-ide/internal/filesystem"
+)
+
+const (
+	// maxContextFiles is the most files a single context bundle may contain
+	maxContextFiles = 50
+
+	// maxContextFileSize is the largest file read into a context bundle
+	maxContextFileSize = 1 << 20
+
+	// minContextChunk is the smallest truncated snippet worth including
+	minContextChunk = 64
+
+	// maxContextIdentifiers bounds how many identifiers are looked up in the symbol index
+	maxContextIdentifiers = 12
+
+	// Candidate scores; higher scores are packed first
+	scoreActive = 100
+	scoreSymbol = 60
+	scoreImport = 50
+	scoreRecent = 20
+)
+
+var identifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// commonKeywords are identifiers never worth looking up in the symbol index
+var commonKeywords = map[string]bool{
+	"func": true, "return": true, "package": true, "import": true, "const": true, "var": true,
+	"type": true, "struct": true, "interface": true, "range": true, "for": true, "else": true,
+	"switch": true, "case": true, "default": true, "defer": true, "nil": true, "true": true,
+	"false": true, "string": true, "int": true, "bool": true, "error": true, "byte": true,
+	"function": true, "class": true, "export": true, "from": true, "let": true, "new": true,
+	"this": true, "null": true, "undefined": true, "async": true, "await": true, "def": true,
+	"self": true, "None": true, "True": true, "False": true, "pass": true, "impl": true,
+	"pub": true, "mut": true, "use": true, "mod": true, "Self": true, "err": true,
+}
+
+// contextCandidate is a snippet that may be packed into a context bundle
+type contextCandidate struct {
+	path      string
+	reason    string
+	score     int
+	lines     []string
+	startLine int
+}
+
+// ContextBuilder assembles workspace context for AI requests from the filesystem service
+type ContextBuilder struct {
+	fs filesystem.Service
+}
+
+// NewContextBuilder creates a context builder backed by the filesystem service
+func NewContextBuilder(fs filesystem.Service) *ContextBuilder {
+	return &ContextBuilder{fs: fs}
+}
+
+// Build ranks the active file, its imports, symbols referenced near the cursor
+// and recently edited files, then packs as many as fit in the token budget
+func (b *ContextBuilder) Build(ec EditorContext, budget int) (*ContextBundle, error) {
+	if ec.FilePath == "" {
+		return nil, fmt.Errorf("editor context requires a file path")
+	}
+	if budget <= 0 {
+		return &ContextBundle{}, nil
+	}
+
+	root := ec.ProjectPath
+	if root == "" {
+		root = filepath.Dir(ec.FilePath)
+	}
+
+	content, err := b.fs.ReadFile(ec.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read active file: %w", err)
+	}
+	activeLines := strings.Split(string(content), "\n")
+
+	// The active file gets at most half the budget, centred on the cursor
+	candidates := []contextCandidate{b.activeCandidate(ec, activeLines, budget/2)}
+
+	meta, err := b.fs.GetFileMetadata(ec.FilePath)
+	if err == nil {
+		candidates = append(candidates, b.importCandidates(ec, root, meta.Imports)...)
+	}
+	candidates = append(candidates, b.symbolCandidates(ec, root, activeLines)...)
+	candidates = append(candidates, b.recentCandidates(ec, root)...)
+
+	return packContext(ec, candidates, budget), nil
+}
+
+// activeCandidate returns the active file, windowed around the cursor or selection if too large
+func (b *ContextBuilder) activeCandidate(ec EditorContext, lines []string, budget int) contextCandidate {
+	focusStart, focusEnd := ec.CursorLine, ec.CursorLine
+	if ec.Selection != nil {
+		focusStart, focusEnd = ec.Selection.StartLine, ec.Selection.EndLine
+	}
+	focusStart = clamp(focusStart, 1, len(lines))
+	focusEnd = clamp(focusEnd, focusStart, len(lines))
+
+	// Grow the window outwards from the focus until the budget is spent
+	start, end := focusStart, focusEnd
+	tokens := 0
+	for i := start; i <= end; i++ {
+		tokens += estimateTokens(lines[i-1]) + 1
+	}
+	for start > 1 || end < len(lines) {
+		grew := false
+		if start > 1 {
+			if t := estimateTokens(lines[start-2]) + 1; tokens+t <= budget {
+				start--
+				tokens += t
+				grew = true
+			}
+		}
+		if end < len(lines) {
+			if t := estimateTokens(lines[end]) + 1; tokens+t <= budget {
+				end++
+				tokens += t
+				grew = true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+
+	return contextCandidate{
+		path:      ec.FilePath,
+		reason:    "active",
+		score:     scoreActive,
+		lines:     lines[start-1 : end],
+		startLine: start,
+	}
+}
+
+// importCandidates resolves the active file's imports to files in the project
+func (b *ContextBuilder) importCandidates(ec EditorContext, root string, imports []string) []contextCandidate {
+	var candidates []contextCandidate
+	seen := make(map[string]bool)
+
+	for _, imp := range imports {
+		for _, path := range b.resolveImport(ec, root, imp) {
+			if seen[path] || path == ec.FilePath {
+				continue
+			}
+			seen[path] = true
+
+			content, err := b.fs.ReadFile(path)
+			if err != nil || len(content) > maxContextFileSize {
+				continue
+			}
+			candidates = append(candidates, contextCandidate{
+				path:      path,
+				reason:    "import",
+				score:     scoreImport,
+				lines:     strings.Split(string(content), "\n"),
+				startLine: 1,
+			})
+		}
+	}
+
+	return candidates
+}
+
+// resolveImport maps an import specifier to candidate files inside the project
+func (b *ContextBuilder) resolveImport(ec EditorContext, root, imp string) []string {
+	dir := filepath.Dir(ec.FilePath)
+	language := ec.Language
+	if language == "" {
+		language = filesystem.LanguageForPath(ec.FilePath)
+	}
+
+	switch language {
+	case "go":
+		module := b.goModulePath(root)
+		if module == "" || !strings.HasPrefix(imp, module+"/") {
+			return nil
+		}
+		pkgDir := filepath.Join(root, strings.TrimPrefix(imp, module+"/"))
+		files, err := b.fs.ListDirectory(pkgDir, false)
+		if err != nil {
+			return nil
+		}
+		var paths []string
+		for _, f := range files {
+			if !f.IsDir && strings.HasSuffix(f.Name, ".go") && !strings.HasSuffix(f.Name, "_test.go") {
+				paths = append(paths, f.Path)
+			}
+		}
+		return paths
+
+	case "typescript", "javascript":
+		var base string
+		switch {
+		case strings.HasPrefix(imp, "."):
+			base = filepath.Join(dir, imp)
+		case strings.HasPrefix(imp, "@/"):
+			base = filepath.Join(root, strings.TrimPrefix(imp, "@/"))
+		default:
+			return nil // Package imports live outside the project
+		}
+		for _, suffix := range []string{"", ".ts", ".tsx", ".js", ".jsx", "/index.ts", "/index.tsx", "/index.js"} {
+			if b.isFile(base + suffix) {
+				return []string{base + suffix}
+			}
+		}
+
+	case "python":
+		trimmed := strings.TrimLeft(imp, ".")
+		base := root
+		if dots := len(imp) - len(trimmed); dots > 0 {
+			base = dir
+			for i := 1; i < dots; i++ {
+				base = filepath.Dir(base)
+			}
+		}
+		rel := filepath.Join(base, strings.ReplaceAll(trimmed, ".", string(filepath.Separator)))
+		for _, candidate := range []string{rel + ".py", filepath.Join(rel, "__init__.py")} {
+			if b.isFile(candidate) {
+				return []string{candidate}
+			}
+		}
+
+	case "rust":
+		var rel string
+		switch {
+		case strings.HasPrefix(imp, "crate::"):
+			parts := strings.Split(strings.TrimPrefix(imp, "crate::"), "::")
+			rel = filepath.Join(root, "src", parts[0])
+		case !strings.Contains(imp, "::"):
+			rel = filepath.Join(dir, imp) // mod declarations
+		default:
+			return nil
+		}
+		for _, candidate := range []string{rel + ".rs", filepath.Join(rel, "mod.rs")} {
+			if b.isFile(candidate) {
+				return []string{candidate}
+			}
+		}
+	}
+
+	return nil
+}
+
+// symbolCandidates looks up identifiers near the cursor in the symbol index
+// and returns the declarations they refer to
+func (b *ContextBuilder) symbolCandidates(ec EditorContext, root string, lines []string) []contextCandidate {
+	start, end := ec.CursorLine-2, ec.CursorLine+2
+	if ec.Selection != nil {
+		start, end = ec.Selection.StartLine, ec.Selection.EndLine
+	}
+	start = clamp(start, 1, len(lines))
+	end = clamp(end, start, len(lines))
+
+	identifiers := make([]string, 0, maxContextIdentifiers)
+	seen := make(map[string]bool)
+	for _, line := range lines[start-1 : end] {
+		for _, ident := range identifierPattern.FindAllString(line, -1) {
+			if seen[ident] || commonKeywords[ident] {
+				continue
+			}
+			seen[ident] = true
+			identifiers = append(identifiers, ident)
+		}
+	}
+	if len(identifiers) > maxContextIdentifiers {
+		identifiers = identifiers[:maxContextIdentifiers]
+	}
+
+	var candidates []contextCandidate
+	for _, ident := range identifiers {
+		symbols, err := b.fs.SearchSymbols(filesystem.SearchOptions{Query: ident, Path: root, MaxResults: 3})
+		if err != nil {
+			continue
+		}
+		for _, sym := range symbols {
+			if sym.Name != ident || sym.Path == ec.FilePath {
+				continue
+			}
+			if candidate, ok := b.declarationSnippet(sym); ok {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	return candidates
+}
+
+// declarationSnippet extracts a symbol's declaration, ending where the next
+// indexed symbol in the same file starts
+func (b *ContextBuilder) declarationSnippet(sym filesystem.Symbol) (contextCandidate, bool) {
+	content, err := b.fs.ReadFile(sym.Path)
+	if err != nil || len(content) > maxContextFileSize {
+		return contextCandidate{}, false
+	}
+	lines := strings.Split(string(content), "\n")
+	if sym.Line < 1 || sym.Line > len(lines) {
+		return contextCandidate{}, false
+	}
+
+	end := len(lines)
+	if meta, err := b.fs.GetFileMetadata(sym.Path); err == nil {
+		for _, other := range meta.Symbols {
+			if other.Line > sym.Line && other.Line-1 < end {
+				end = other.Line - 1
+			}
+		}
+	}
+
+	// Include the doc comment directly above the declaration
+	start := sym.Line
+	for start > 1 && isCommentLine(lines[start-2]) {
+		start--
+	}
+
+	return contextCandidate{
+		path:      sym.Path,
+		reason:    "symbol",
+		score:     scoreSymbol,
+		lines:     lines[start-1 : end],
+		startLine: start,
+	}, true
+}
+
+// recentCandidates returns recently edited files in the same project
+func (b *ContextBuilder) recentCandidates(ec EditorContext, root string) []contextCandidate {
+	var candidates []contextCandidate
+	for i, f := range b.fs.RecentFiles(10) {
+		if f.Path == ec.FilePath || !strings.HasPrefix(f.Path, root) {
+			continue
+		}
+		content, err := b.fs.ReadFile(f.Path)
+		if err != nil || len(content) > maxContextFileSize {
+			continue
+		}
+		candidates = append(candidates, contextCandidate{
+			path:      f.Path,
+			reason:    "recent",
+			score:     scoreRecent - i,
+			lines:     strings.Split(string(content), "\n"),
+			startLine: 1,
+		})
+	}
+	return candidates
+}
+
+// goModulePath returns the module path declared in the project's go.mod
+func (b *ContextBuilder) goModulePath(root string) string {
+	content, err := b.fs.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// isFile reports whether path can be read through the filesystem service
+func (b *ContextBuilder) isFile(path string) bool {
+	_, err := b.fs.ReadFile(path)
+	return err == nil
+}
+
+// packContext greedily fills the budget with the highest-scoring candidates,
+// keeping one entry per file and truncating the last snippet if needed
+func packContext(ec EditorContext, candidates []contextCandidate, budget int) *ContextBundle {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	bundle := &ContextBundle{}
+	var prompt strings.Builder
+	prompt.WriteString("The following files from the user's workspace may be relevant.\n")
+	if ec.CursorLine > 0 {
+		fmt.Fprintf(&prompt, "The cursor is in %s at line %d.\n", ec.FilePath, ec.CursorLine)
+	}
+	if ec.Selection != nil {
+		fmt.Fprintf(&prompt, "The user has selected lines %d-%d of %s.\n", ec.Selection.StartLine, ec.Selection.EndLine, ec.FilePath)
+	}
+	bundle.Tokens = estimateTokens(prompt.String())
+
+	included := make(map[string]bool)
+	for _, c := range candidates {
+		if len(bundle.Files) >= maxContextFiles {
+			break
+		}
+		if included[c.path] || len(c.lines) == 0 {
+			continue
+		}
+
+		header := fmt.Sprintf("\nFile: %s (lines %d-%d, %s)\n```%s\n", c.path, c.startLine, c.startLine+len(c.lines)-1, c.reason, filesystem.LanguageForPath(c.path))
+		footer := "```\n"
+		overhead := estimateTokens(header) + estimateTokens(footer)
+		remaining := budget - bundle.Tokens - overhead
+		if remaining < minContextChunk {
+			continue
+		}
+
+		lines, truncated := fitLines(c.lines, remaining)
+		if len(lines) == 0 {
+			continue
+		}
+		if truncated {
+			header = fmt.Sprintf("\nFile: %s (lines %d-%d, %s)\n```%s\n", c.path, c.startLine, c.startLine+len(lines)-1, c.reason, filesystem.LanguageForPath(c.path))
+		}
+
+		body := strings.Join(lines, "\n") + "\n"
+		tokens := estimateTokens(header) + estimateTokens(body) + estimateTokens(footer)
+
+		prompt.WriteString(header)
+		prompt.WriteString(body)
+		prompt.WriteString(footer)
+		bundle.Tokens += tokens
+		included[c.path] = true
+
+		bundle.Files = append(bundle.Files, ContextFile{
+			Path:      c.path,
+			Reason:    c.reason,
+			StartLine: c.startLine,
+			EndLine:   c.startLine + len(lines) - 1,
+			Tokens:    tokens,
+			Truncated: truncated,
+		})
+	}
+
+	if len(bundle.Files) > 0 {
+		bundle.Prompt = prompt.String()
+	} else {
+		bundle.Tokens = 0
+	}
+	return bundle
+}
+
+// fitLines returns the longest prefix of lines that fits in the token budget
+func fitLines(lines []string, budget int) ([]string, bool) {
+	tokens := 0
+	for i, line := range lines {
+		tokens += estimateTokens(line) + 1
+		if tokens > budget {
+			return lines[:i], true
+		}
+	}
+	return lines, false
+}
+
+// isCommentLine reports whether a line is a single-line comment
+func isCommentLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") ||
+		strings.HasPrefix(trimmed, "*") || strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "///")
+}
+
+// clamp limits v to the range [lo, hi]
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
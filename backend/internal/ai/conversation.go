@@ -0,0 +1,274 @@
+package ai
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"glask-ide/internal/storage"
+)
+
+var (
+	// ErrConversationNotFound is returned when a conversation ID is unknown
+	ErrConversationNotFound = errors.New("conversation not found")
+
+	// ErrInvalidRole is returned when appending a message that is neither a
+	// user nor an assistant turn
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+const (
+	// defaultCompletionReserve is the number of tokens kept free for the reply
+	defaultCompletionReserve = 2048
+)
+
+const conversationSchema = `
+CREATE TABLE IF NOT EXISTS conversations (
+	id TEXT PRIMARY KEY,
+	title TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`
+
+const conversationHistorySchema = `
+CREATE TABLE IF NOT EXISTS conversation_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT NOT NULL,
+	message_index INTEGER NOT NULL,
+	role TEXT NOT NULL,
+	content TEXT NOT NULL,
+	timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+	token_count INTEGER,
+	metadata TEXT
+)`
+
+const conversationHistoryIndex = `
+CREATE INDEX IF NOT EXISTS idx_conversation_history_conversation
+ON conversation_history(conversation_id, message_index)`
+
+// ConversationStore persists conversations and their messages in SQLite
+type ConversationStore struct {
+	db *sql.DB
+}
+
+// NewConversationStore creates a conversation store, creating its tables if needed
+func NewConversationStore(db *sql.DB) (*ConversationStore, error) {
+	if err := storage.Migrate(db, conversationSchema, conversationHistorySchema, conversationHistoryIndex); err != nil {
+		return nil, err
+	}
+	return &ConversationStore{db: db}, nil
+}
+
+// Create starts a new, empty conversation
+func (s *ConversationStore) Create(title string) (*Conversation, error) {
+	if title == "" {
+		title = "New conversation"
+	}
+
+	now := time.Now().UTC()
+	conv := &Conversation{
+		ID:        generateID(),
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO conversations (id, title, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		conv.ID, conv.Title, conv.CreatedAt, conv.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	return conv, nil
+}
+
+// List returns all conversations, most recently updated first
+func (s *ConversationStore) List() ([]Conversation, error) {
+	rows, err := s.db.Query(`
+		SELECT c.id, c.title, c.created_at, c.updated_at, COUNT(h.id)
+		FROM conversations c
+		LEFT JOIN conversation_history h ON h.conversation_id = c.id
+		GROUP BY c.id
+		ORDER BY c.updated_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var conv Conversation
+		if err := rows.Scan(&conv.ID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt, &conv.MessageCount); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+
+	return conversations, rows.Err()
+}
+
+// Get returns a single conversation
+func (s *ConversationStore) Get(id string) (*Conversation, error) {
+	var conv Conversation
+	err := s.db.QueryRow(`
+		SELECT c.id, c.title, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM conversation_history h WHERE h.conversation_id = c.id)
+		FROM conversations c
+		WHERE c.id = ?`, id,
+	).Scan(&conv.ID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt, &conv.MessageCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	return &conv, nil
+}
+
+// Delete removes a conversation and its history
+func (s *ConversationStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM conversations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConversationNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM conversation_history WHERE conversation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete conversation history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Messages returns the full history of a conversation in order
+func (s *ConversationStore) Messages(id string) ([]ConversationMessage, error) {
+	rows, err := s.db.Query(`
+		SELECT message_index, role, content, COALESCE(token_count, 0), timestamp, COALESCE(metadata, '')
+		FROM conversation_history
+		WHERE conversation_id = ?
+		ORDER BY message_index`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []ConversationMessage
+	for rows.Next() {
+		var msg ConversationMessage
+		if err := rows.Scan(&msg.Index, &msg.Role, &msg.Content, &msg.TokenCount, &msg.Timestamp, &msg.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// Append adds a message to the end of a conversation
+func (s *ConversationStore) Append(id, role, content string, tokenCount int) (*ConversationMessage, error) {
+	if role != "user" && role != "assistant" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(`UPDATE conversations SET updated_at = ? WHERE id = ?`, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update conversation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrConversationNotFound
+	}
+
+	var index int
+	if err := tx.QueryRow(
+		`SELECT COALESCE(MAX(message_index) + 1, 0) FROM conversation_history WHERE conversation_id = ?`, id,
+	).Scan(&index); err != nil {
+		return nil, fmt.Errorf("failed to compute message index: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO conversation_history (conversation_id, message_index, role, content, timestamp, token_count)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		id, index, role, content, now, tokenCount,
+	); err != nil {
+		return nil, fmt.Errorf("failed to append message: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit message: %w", err)
+	}
+
+	return &ConversationMessage{
+		Index:      index,
+		Role:       role,
+		Content:    content,
+		TokenCount: tokenCount,
+		Timestamp:  now,
+	}, nil
+}
+
+// trimHistory drops the oldest turns until the history fits in the token
+// budget. The latest message is always kept, consecutive turns from the same
+// role are merged and the result always starts with a user turn, since
+// providers reject anything else.
+func trimHistory(messages []Message, budget int, estimate func(string) int) []Message {
+	merged := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if n := len(merged); n > 0 && merged[n-1].Role == msg.Role {
+			merged[n-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		merged = append(merged, msg)
+	}
+
+	total := 0
+	for _, msg := range merged {
+		total += estimate(msg.Content)
+	}
+	for len(merged) > 1 && total > budget {
+		total -= estimate(merged[0].Content)
+		merged = merged[1:]
+	}
+
+	for len(merged) > 1 && merged[0].Role != "user" {
+		merged = merged[1:]
+	}
+
+	return merged
+}
+
+// lastID is the most recent ID handed out by generateID
+var lastID atomic.Int64
+
+// generateID generates a unique identifier for stored records: the time in
+// nanoseconds, moved past the last ID when two are made in the same tick
+func generateID() string {
+	now := time.Now().UnixNano()
+	for {
+		last := lastID.Load()
+		id := max(now, last+1)
+		if lastID.CompareAndSwap(last, id) {
+			return strconv.FormatInt(id, 10)
+		}
+	}
+}
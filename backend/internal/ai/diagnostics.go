@@ -0,0 +1,431 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"glask-ide/internal/filesystem"
+)
+
+const (
+	// maxDiagnostics caps the errors extracted from one piece of output
+	maxDiagnostics = 50
+
+	// maxDiagnosedFiles caps the source files sent to the model with the errors
+	maxDiagnosedFiles = 4
+
+	// diagnosticContextLines is how many lines around each error are shown
+	// from files too long to send whole
+	diagnosticContextLines = 30
+
+	// maxWholeFileLines is the longest file sent to the model in full
+	maxWholeFileLines = 400
+
+	// maxPathMatches bounds the search that locates files printed with a
+	// path relative to somewhere other than the working directory
+	maxPathMatches = 1000
+)
+
+var (
+	// ErrNoDiagnostics is returned when terminal output contains no recognizable errors
+	ErrNoDiagnostics = errors.New("no errors found in the terminal output")
+
+	// ErrTerminalNotFound is returned for an unknown terminal session
+	ErrTerminalNotFound = errors.New("terminal session not found")
+)
+
+// TerminalAnalysisRequest asks for a diagnosis of errors printed in a terminal
+type TerminalAnalysisRequest struct {
+	TerminalID  string // Terminal session whose recent output is analyzed
+	Output      string // Selected output; used instead of the session's output when set
+	ProjectPath string // Directory relative paths are resolved against; the shell's directory by default
+	Editor      *EditorContext
+	ModelID     string
+	SessionID   string
+
+	// Template replaces the diagnosis request; the errors are available to it as .Vars.error
+	Template     string
+	TemplateVars map[string]string
+}
+
+// TerminalDiagnostic is an error or warning found in terminal output
+type TerminalDiagnostic struct {
+	FilePath string // Absolute when the file was found, as printed otherwise
+	Line     int
+	Column   int    // 0 when not printed
+	Severity string // "error" or "warning"
+	Message  string
+	Language string // "go", "typescript", "javascript", "python" or "rust"; empty when unknown
+	Code     string // Compiler error code such as TS2322 or E0308
+	Exists   bool   // The file was found in the workspace
+}
+
+// TerminalAnalysis is the diagnosis of errors in terminal output
+type TerminalAnalysis struct {
+	Diagnostics []TerminalDiagnostic
+	Diagnosis   string
+	Proposal    *EditProposal // Fixes for the errors, when the model suggested any
+}
+
+var (
+	// Go, mypy, pytest and most linters: path:line[:col]: message
+	lineColPattern = regexp.MustCompile(`^\s*(\S+\.(?:go|py|rs|ts|tsx|js|jsx|mts|cts)):(\d+)(?::(\d+))?:\s+(.+)$`)
+
+	// tsc: path(line,col): error TS1234: message
+	tscPattern = regexp.MustCompile(`^(\S+\.(?:ts|tsx|js|jsx|mts|cts))\((\d+),(\d+)\): (error|warning) (TS\d+): (.+)$`)
+
+	// tsc --pretty: path:line:col - error TS1234: message
+	tscPrettyPattern = regexp.MustCompile(`^(\S+\.(?:ts|tsx|js|jsx|mts|cts)):(\d+):(\d+) - (error|warning) (TS\d+): (.+)$`)
+
+	// rustc and cargo: "error[E0308]: message" followed by " --> path:line:col"
+	rustHeaderPattern = regexp.MustCompile(`^(error|warning)(?:\[(\w+)\])?: (.+)$`)
+	rustArrowPattern  = regexp.MustCompile(`^\s*--> (\S+?):(\d+):(\d+)$`)
+
+	// Python tracebacks: frames, then the exception once the frames end
+	pythonFramePattern     = regexp.MustCompile(`^\s*File "(.+?)", line (\d+)`)
+	pythonExceptionPattern = regexp.MustCompile(`^([A-Za-z_][\w.]*(?:Error|Exception|Exit|Interrupt|Warning)|AssertionError)(?::\s*(.*))?$`)
+
+	// Go panics: "panic: message", then goroutine stacks with "\tpath.go:line +0x1f" frames
+	goPanicPattern = regexp.MustCompile(`^panic: (.+)$`)
+	goFramePattern = regexp.MustCompile(`^\t(\S+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// parseTerminalErrors extracts compiler, test and runtime errors from
+// terminal output in Go, TypeScript, Python and Rust formats
+func parseTerminalErrors(output string) []TerminalDiagnostic {
+	output = ansiEscape.ReplaceAllString(output, "")
+
+	var (
+		result     []TerminalDiagnostic
+		seen       = make(map[string]bool)
+		rustHeader []string // Severity, code and message awaiting their location
+		pyFrame    *TerminalDiagnostic
+		panicMsg   string
+	)
+	add := func(d TerminalDiagnostic) {
+		key := fmt.Sprintf("%s:%d:%d:%s", d.FilePath, d.Line, d.Column, d.Message)
+		if seen[key] || len(result) >= maxDiagnostics {
+			return
+		}
+		seen[key] = true
+		if d.Severity == "" {
+			d.Severity = "error"
+		}
+		if d.Language == "" {
+			d.Language = filesystem.LanguageForPath(d.FilePath)
+		}
+		result = append(result, d)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		// Progress output redraws lines with carriage returns; the last draw wins
+		if i := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		line = strings.TrimRight(line, "\r ")
+
+		// A Python traceback ends with the exception, reported at its innermost frame
+		if pyFrame != nil {
+			if pythonFramePattern.MatchString(line) || strings.HasPrefix(line, " ") || line == "" {
+				if m := pythonFramePattern.FindStringSubmatch(line); m != nil {
+					pyFrame.FilePath, pyFrame.Line = m[1], atoi(m[2])
+				}
+				continue
+			}
+			if m := pythonExceptionPattern.FindStringSubmatch(line); m != nil {
+				pyFrame.Message = strings.TrimSpace(m[1] + ": " + m[2])
+				pyFrame.Message = strings.TrimSuffix(pyFrame.Message, ":")
+				add(*pyFrame)
+			}
+			pyFrame = nil
+		}
+		if m := pythonFramePattern.FindStringSubmatch(line); m != nil {
+			pyFrame = &TerminalDiagnostic{FilePath: m[1], Line: atoi(m[2]), Language: "python"}
+			continue
+		}
+
+		if m := goPanicPattern.FindStringSubmatch(line); m != nil {
+			panicMsg = "panic: " + m[1]
+			continue
+		}
+		if m := goFramePattern.FindStringSubmatch(line); m != nil {
+			// The first frame outside the standard library is where the panic is reported
+			if panicMsg != "" && !isGoStdlibPath(m[1]) {
+				add(TerminalDiagnostic{FilePath: m[1], Line: atoi(m[2]), Message: panicMsg, Language: "go"})
+				panicMsg = ""
+			}
+			continue
+		}
+
+		if m := rustHeaderPattern.FindStringSubmatch(line); m != nil {
+			rustHeader = m[1:]
+			continue
+		}
+		if m := rustArrowPattern.FindStringSubmatch(line); m != nil {
+			if rustHeader != nil {
+				add(TerminalDiagnostic{
+					FilePath: m[1],
+					Line:     atoi(m[2]),
+					Column:   atoi(m[3]),
+					Severity: rustHeader[0],
+					Code:     rustHeader[1],
+					Message:  rustHeader[2],
+					Language: "rust",
+				})
+				rustHeader = nil
+			}
+			continue
+		}
+
+		if m := tscPattern.FindStringSubmatch(line); m != nil {
+			add(TerminalDiagnostic{FilePath: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: m[4], Code: m[5], Message: m[6]})
+			continue
+		}
+		if m := tscPrettyPattern.FindStringSubmatch(line); m != nil {
+			add(TerminalDiagnostic{FilePath: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Severity: m[4], Code: m[5], Message: m[6]})
+			continue
+		}
+		if m := lineColPattern.FindStringSubmatch(line); m != nil {
+			d := TerminalDiagnostic{FilePath: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Message: m[4]}
+			// mypy and linters prefix the message with its severity
+			for _, severity := range []string{"error", "warning", "note"} {
+				if rest, ok := strings.CutPrefix(d.Message, severity+": "); ok {
+					d.Message = rest
+					if severity != "error" {
+						d.Severity = "warning"
+					}
+				}
+			}
+			add(d)
+		}
+	}
+	if pyFrame != nil && pyFrame.Message != "" {
+		add(*pyFrame)
+	}
+	return result
+}
+
+// isGoStdlibPath reports whether a stack frame is in the Go runtime or standard library
+func isGoStdlibPath(path string) bool {
+	return strings.Contains(path, "/src/runtime/") || strings.Contains(path, "/src/testing/") ||
+		strings.Contains(path, "/src/reflect/") || strings.Contains(path, "/src/sync/")
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// AnalyzeTerminalOutput extracts the errors from a terminal session's recent
+// output, or from selected output, and asks the model to diagnose them and
+// propose fixes
+func (s *service) AnalyzeTerminalOutput(ctx context.Context, req TerminalAnalysisRequest) (*TerminalAnalysis, error) {
+	output := req.Output
+	root := req.ProjectPath
+	if req.TerminalID != "" {
+		if s.terminals == nil {
+			return nil, fmt.Errorf("terminal service is not available")
+		}
+		session, ok := s.terminals.GetSession(req.TerminalID)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTerminalNotFound, req.TerminalID)
+		}
+		if output == "" {
+			output = string(session.RecentOutput())
+		}
+		if root == "" {
+			root = session.WorkingDir()
+		}
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil, fmt.Errorf("a terminal session or output is required")
+	}
+	if root == "" {
+		root = req.Editor.projectPath()
+	}
+
+	diagnostics := parseTerminalErrors(output)
+	if len(diagnostics) == 0 {
+		return nil, ErrNoDiagnostics
+	}
+	s.resolveDiagnosticPaths(diagnostics, root)
+
+	// The errors, with the source around them, go to the model
+	var errorsText strings.Builder
+	for _, d := range diagnostics {
+		fmt.Fprintf(&errorsText, "%s:%d", d.FilePath, d.Line)
+		if d.Column > 0 {
+			fmt.Fprintf(&errorsText, ":%d", d.Column)
+		}
+		fmt.Fprintf(&errorsText, ": %s: ", d.Severity)
+		if d.Code != "" {
+			fmt.Fprintf(&errorsText, "[%s] ", d.Code)
+		}
+		errorsText.WriteString(d.Message + "\n")
+	}
+
+	vars := map[string]string{"error": errorsText.String()}
+	for k, v := range req.TemplateVars {
+		vars[k] = v
+	}
+	request, opts, err := s.applyTemplate("Diagnose these errors from the terminal and fix them.", "", Options{
+		Temperature:  ptr(0.0),
+		Editor:       req.Editor,
+		ModelID:      req.ModelID,
+		SessionID:    req.SessionID,
+		Project:      root,
+		Template:     req.Template,
+		TemplateVars: vars,
+		Feature:      "terminal_analysis",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString(request + "\n\n")
+	b.WriteString("Errors:\n" + errorsText.String() + "\n")
+	b.WriteString(`Respond with a single JSON object and nothing else:
+{"summary": "<the root cause and how to fix it, briefly>",
+ "edits": [<edits fixing the errors, in the format below; empty if the fix is not in these files>]}
+
+`)
+	b.WriteString(editFormatInstructions)
+	if err := s.writeDiagnosedFiles(&b, diagnostics); err != nil {
+		return nil, err
+	}
+
+	resp, proposal, err := s.requestEdits(ctx, b.String(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &TerminalAnalysis{
+		Diagnostics: diagnostics,
+		Diagnosis:   resp.Summary,
+		Proposal:    proposal,
+	}
+	if analysis.Diagnosis == "" {
+		analysis.Diagnosis = resp.Explanation
+	}
+	if proposal != nil && proposal.Explanation == "" {
+		proposal.Explanation = analysis.Diagnosis
+	}
+	return analysis, nil
+}
+
+// resolveDiagnosticPaths makes the diagnostics' paths absolute where the file
+// can be found. Paths are tried against the root first; test runners print
+// paths relative to the package, so otherwise the root is searched for a
+// unique file ending with the printed path.
+func (s *service) resolveDiagnosticPaths(diagnostics []TerminalDiagnostic, root string) {
+	var unresolved []*TerminalDiagnostic
+	for i := range diagnostics {
+		d := &diagnostics[i]
+		path := d.FilePath
+		if !filepath.IsAbs(path) && root != "" {
+			path = filepath.Join(root, path)
+		}
+		if _, err := s.edits.fs.GetFileMetadata(path); err == nil {
+			d.FilePath, d.Exists = filepath.Clean(path), true
+			continue
+		}
+		if !filepath.IsAbs(d.FilePath) && root != "" {
+			unresolved = append(unresolved, d)
+		}
+	}
+	if len(unresolved) == 0 {
+		return
+	}
+
+	// One search finds the candidates for every unresolved path
+	var names []string
+	for _, d := range unresolved {
+		names = append(names, filepath.Base(d.FilePath))
+	}
+	files, err := s.edits.fs.SearchFiles(filesystem.SearchOptions{
+		Path:         root,
+		FilePatterns: names,
+		MaxResults:   maxPathMatches,
+	})
+	if err != nil {
+		return
+	}
+
+	for _, d := range unresolved {
+		suffix := string(filepath.Separator) + filepath.Clean(d.FilePath)
+		var match string
+		for _, f := range files {
+			if !f.IsDir && strings.HasSuffix(f.Path, suffix) {
+				if match != "" {
+					match = "" // Ambiguous; leave the path as printed
+					break
+				}
+				match = f.Path
+			}
+		}
+		if match != "" {
+			d.FilePath, d.Exists = match, true
+		}
+	}
+}
+
+// writeDiagnosedFiles adds the files with errors to the prompt, numbered so
+// the model can address edits. Long files are cut down to the lines around
+// their errors.
+func (s *service) writeDiagnosedFiles(b *strings.Builder, diagnostics []TerminalDiagnostic) error {
+	var paths []string
+	lines := make(map[string][]int)
+	for _, d := range diagnostics {
+		if !d.Exists {
+			continue
+		}
+		if _, ok := lines[d.FilePath]; !ok {
+			if len(paths) == maxDiagnosedFiles {
+				continue
+			}
+			paths = append(paths, d.FilePath)
+		}
+		lines[d.FilePath] = append(lines[d.FilePath], d.Line)
+	}
+
+	for _, path := range paths {
+		content, err := s.readSource(path)
+		if err != nil {
+			return err
+		}
+		fileLines := splitLines(content)
+		if len(fileLines) <= maxWholeFileLines {
+			writeNumberedFile(b, path, content)
+			continue
+		}
+
+		fmt.Fprintf(b, "\n\nFile: %s (excerpts)\n", path)
+		sort.Ints(lines[path])
+		next := 1
+		for _, line := range lines[path] {
+			start := max(line-diagnosticContextLines, next, 1)
+			end := min(line+diagnosticContextLines, len(fileLines))
+			if start > end {
+				continue
+			}
+			if start > next {
+				b.WriteString("...\n")
+			}
+			for i := start; i <= end; i++ {
+				fmt.Fprintf(b, "%d| %s\n", i, fileLines[i-1])
+			}
+			next = end + 1
+		}
+		if next <= len(fileLines) {
+			b.WriteString("...\n")
+		}
+	}
+	return nil
+}
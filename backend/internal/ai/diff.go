@@ -0,0 +1,205 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each hunk
+const diffContextLines = 3
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// unifiedDiff returns a unified diff between two versions of a file, or an
+// empty string if they are identical
+func unifiedDiff(path, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+	script := diffLines(oldLines, newLines)
+
+	oldName, newName := "a"+path, "b"+path
+	if oldText == "" {
+		oldName = "/dev/null"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Walk the script, emitting hunks of changes with surrounding context
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(script); {
+		if script[i].op == diffEqual {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are separated by little enough context
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(script) {
+			if script[end].op != diffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].op == diffEqual {
+				run++
+			}
+			if run == len(script) || run-end > 2*diffContextLines {
+				end += min(diffContextLines, run-end)
+				break
+			}
+			end = run
+		}
+
+		hunkOldStart, hunkNewStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, l := range script[start:end] {
+			switch l.op {
+			case diffEqual:
+				body.WriteString(" " + l.text + "\n")
+				oldCount++
+				newCount++
+			case diffDelete:
+				body.WriteString("-" + l.text + "\n")
+				oldCount++
+			case diffInsert:
+				body.WriteString("+" + l.text + "\n")
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			hunkOldStart--
+		}
+		if newCount == 0 {
+			hunkNewStart--
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", hunkOldStart, oldCount, hunkNewStart, newCount)
+		b.WriteString(body.String())
+
+		// Advance the line counters past the hunk
+		for _, l := range script[i:end] {
+			if l.op != diffInsert {
+				oldLine++
+			}
+			if l.op != diffDelete {
+				newLine++
+			}
+		}
+		i = end
+	}
+
+	return b.String()
+}
+
+// splitLines splits text into lines without their trailing newlines
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script between two line slices using
+// Myers' O(ND) algorithm
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(trace, a, b, offset, d)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backtrackDiff reconstructs the edit script from the saved Myers frontiers
+func backtrackDiff(trace [][]int, a, b []string, offset, d int) []diffLine {
+	x, y := len(a), len(b)
+	var script []diffLine
+
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			script = append(script, diffLine{op: diffEqual, text: a[x]})
+		}
+		if x == prevX {
+			y--
+			script = append(script, diffLine{op: diffInsert, text: b[y]})
+		} else {
+			x--
+			script = append(script, diffLine{op: diffDelete, text: a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		script = append(script, diffLine{op: diffEqual, text: a[x]})
+	}
+
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
@@ -0,0 +1,483 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"glask-ide/internal/filesystem"
+)
+
+const (
+	// maxDocSymbols caps the symbols documented by one request
+	maxDocSymbols = 100
+
+	// docBatchSize is how many symbols are documented per model request
+	docBatchSize = 20
+
+	// docSnippetLines is how much of each declaration the model is shown
+	docSnippetLines = 30
+)
+
+var (
+	// ErrSymbolNotFound is returned when no indexed declaration has the requested name
+	ErrSymbolNotFound = errors.New("symbol not found")
+
+	// ErrAmbiguousSymbol is returned when a symbol name matches several declarations
+	ErrAmbiguousSymbol = errors.New("symbol name matches several declarations")
+
+	// ErrAlreadyDocumented is returned when the requested symbol has a doc comment
+	ErrAlreadyDocumented = errors.New("symbol already has documentation")
+)
+
+// DocsRequest asks for doc comments on a symbol, on the exported symbols of a
+// file, or on the exported symbols of every file in a package directory.
+// Symbols that already have documentation are skipped.
+type DocsRequest struct {
+	FilePath    string
+	Symbol      string // "Name" or "Type.Method"; searched in the project when FilePath is empty
+	PackagePath string // Batch mode: a directory whose files are all documented
+	ProjectPath string // Where a symbol is searched; the editor's project by default
+	Editor      *EditorContext
+	ModelID     string
+	SessionID   string
+
+	// Template fills the documentation request into a prompt template
+	Template     string
+	TemplateVars map[string]string
+}
+
+// DocumentedSymbol is a symbol a doc comment was written for
+type DocumentedSymbol struct {
+	Name     string
+	Kind     string
+	FilePath string
+	Line     int
+	Doc      string // The documentation text, without comment markers
+}
+
+// DocsResult is the documentation written for a request
+type DocsResult struct {
+	Symbols  []DocumentedSymbol
+	Proposal *EditProposal // Insert edits adding the comments; nil when nothing needed documenting
+}
+
+// docTarget is a symbol to document and where its comment goes
+type docTarget struct {
+	symbol     filesystem.Symbol
+	language   string
+	insertLine int    // 1-based line the comment is inserted before
+	indent     string // Indentation of the comment
+	snippet    string // The declaration, as shown to the model
+}
+
+// modelDocResponse is the JSON document the model is asked to return
+type modelDocResponse struct {
+	Docs []struct {
+		ID  int    `json:"id"`
+		Doc string `json:"doc"`
+	} `json:"docs"`
+}
+
+const docInstructions = `Follow the documentation conventions of each declaration's language:
+- Go: full sentences beginning with the declared name, as godoc expects.
+- TypeScript and JavaScript: a JSDoc description, with @param and @returns tags for functions.
+- Python: a docstring with a one-line summary, then Args:, Returns: and Raises: sections where they apply.
+- Rust: a summary line, then # Errors and # Panics sections where they apply.
+Describe what the code does and how to use it, not how it is implemented. Give only the text,
+without comment markers or quotes; it is formatted as a comment for you.
+Respond with a single JSON object and nothing else:
+{"docs": [{"id": 1, "doc": "<documentation text>"}]}`
+
+// GenerateDocs writes doc comments for the requested symbols and returns them as insert edits
+func (s *service) GenerateDocs(ctx context.Context, req DocsRequest) (*DocsResult, error) {
+	targets, err := s.docTargets(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return &DocsResult{}, nil
+	}
+	if len(targets) > maxDocSymbols {
+		targets = targets[:maxDocSymbols]
+	}
+
+	project := req.ProjectPath
+	if project == "" {
+		project = req.Editor.projectPath()
+	}
+	request, opts, err := s.applyTemplate("Write documentation for each declaration below.", "", Options{
+		Temperature:  ptr(0.3),
+		Editor:       req.Editor,
+		ModelID:      req.ModelID,
+		SessionID:    req.SessionID,
+		Project:      project,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+		Feature:      "docs",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every batch goes to the same model, whatever the session selects meanwhile
+	model, err := s.resolveModel(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.ModelID = model.ID
+
+	result := &DocsResult{}
+	var edits []TextEdit
+	for start := 0; start < len(targets); start += docBatchSize {
+		batch := targets[start:min(start+docBatchSize, len(targets))]
+		docs, err := s.requestDocs(ctx, request, batch, opts)
+		if err != nil {
+			return nil, err
+		}
+		// Workspace context only needs to be sent with the first batch
+		opts.Editor = nil
+
+		for i, t := range batch {
+			doc := strings.TrimSpace(docs[i+1])
+			if doc == "" {
+				continue
+			}
+			edits = append(edits, TextEdit{
+				FilePath: t.symbol.Path,
+				Range:    TextRange{StartLine: t.insertLine, StartColumn: 1, EndLine: t.insertLine, EndColumn: 1},
+				NewText:  formatDocComment(doc, t.language, t.indent),
+			})
+			result.Symbols = append(result.Symbols, DocumentedSymbol{
+				Name:     t.symbol.Name,
+				Kind:     t.symbol.Kind,
+				FilePath: t.symbol.Path,
+				Line:     t.symbol.Line,
+				Doc:      doc,
+			})
+		}
+	}
+	if len(edits) == 0 {
+		return result, nil
+	}
+
+	result.Proposal, err = s.edits.propose(fmt.Sprintf("Document %d symbols", len(edits)), edits)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// requestDocs asks the model to document a batch of symbols and returns the
+// text by 1-based position in the batch. A malformed reply is sent back once
+// so the model can correct it.
+func (s *service) requestDocs(ctx context.Context, request string, batch []docTarget, opts Options) (map[int]string, error) {
+	var b strings.Builder
+	b.WriteString(request + "\n\n")
+	b.WriteString(docInstructions)
+	for i, t := range batch {
+		name := t.symbol.Name
+		if t.symbol.Parent != "" {
+			name = t.symbol.Parent + "." + name
+		}
+		fmt.Fprintf(&b, "\n\n[%d] %s %s %s in %s:\n```%s\n%s\n```", i+1, t.language, t.symbol.Kind, name, t.symbol.Path, t.language, t.snippet)
+	}
+	messages := []Message{{Role: "user", Content: b.String()}}
+
+	var lastErr error
+	for attempt := 0; attempt < maxEditAttempts; attempt++ {
+		resp, err := s.complete(ctx, messages, opts)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Status == "failed" {
+			return nil, fmt.Errorf("completion failed: %s", resp.Error)
+		}
+
+		docs, err := parseDocResponse(resp.Output)
+		if err == nil {
+			return docs, nil
+		}
+		lastErr = err
+
+		opts.Editor = nil
+		messages = append(messages,
+			Message{Role: "assistant", Content: resp.Output},
+			Message{Role: "user", Content: fmt.Sprintf("That response could not be used: %v. Reply again with corrected JSON only.", err)},
+		)
+	}
+	return nil, fmt.Errorf("model did not return usable documentation: %w", lastErr)
+}
+
+// parseDocResponse extracts the documentation from a model reply, tolerating
+// markdown fences and surrounding prose
+func parseDocResponse(output string) (map[int]string, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object found")
+	}
+
+	var parsed modelDocResponse
+	if err := json.Unmarshal([]byte(output[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	docs := make(map[int]string, len(parsed.Docs))
+	for _, d := range parsed.Docs {
+		docs[d.ID] = d.Doc
+	}
+	return docs, nil
+}
+
+// docTargets finds the symbols a request documents
+func (s *service) docTargets(req DocsRequest) ([]docTarget, error) {
+	fs := s.edits.fs
+
+	switch {
+	case req.Symbol != "":
+		name, parent := req.Symbol, ""
+		if i := strings.LastIndex(req.Symbol, "."); i >= 0 {
+			parent, name = req.Symbol[:i], req.Symbol[i+1:]
+		}
+
+		var candidates []filesystem.Symbol
+		if req.FilePath != "" {
+			meta, err := fs.GetFileMetadata(req.FilePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to index %s: %w", req.FilePath, err)
+			}
+			candidates = meta.Symbols
+		} else {
+			root := req.ProjectPath
+			if root == "" {
+				root = req.Editor.projectPath()
+			}
+			if root == "" {
+				return nil, fmt.Errorf("a file or project path is required to find %s", req.Symbol)
+			}
+			found, err := fs.SearchSymbols(filesystem.SearchOptions{Query: name, Path: root})
+			if err != nil {
+				return nil, err
+			}
+			candidates = found
+		}
+
+		var matches []filesystem.Symbol
+		for _, sym := range candidates {
+			if sym.Name == name && (parent == "" || sym.Parent == parent) {
+				matches = append(matches, sym)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, req.Symbol)
+		case 1:
+		default:
+			locations := make([]string, len(matches))
+			for i, sym := range matches {
+				locations[i] = fmt.Sprintf("%s:%d", sym.Path, sym.Line)
+			}
+			return nil, fmt.Errorf("%w: %s is declared at %s", ErrAmbiguousSymbol, req.Symbol, strings.Join(locations, ", "))
+		}
+
+		lines, err := s.sourceLines(matches[0].Path)
+		if err != nil {
+			return nil, err
+		}
+		t, documented, ok := newDocTarget(matches[0], lines)
+		if !ok {
+			return nil, fmt.Errorf("cannot place a doc comment on %s", req.Symbol)
+		}
+		if documented {
+			return nil, fmt.Errorf("%w: %s", ErrAlreadyDocumented, req.Symbol)
+		}
+		return []docTarget{t}, nil
+
+	case req.FilePath != "":
+		return s.undocumentedSymbols(req.FilePath)
+
+	case req.PackagePath != "":
+		entries, err := os.ReadDir(req.PackagePath)
+		if err != nil {
+			return nil, err
+		}
+		var targets []docTarget
+		for _, entry := range entries {
+			if entry.IsDir() || isTestFile(entry.Name()) || filesystem.LanguageForPath(entry.Name()) == "" {
+				continue
+			}
+			found, err := s.undocumentedSymbols(filepath.Join(req.PackagePath, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, found...)
+		}
+		return targets, nil
+	}
+
+	return nil, fmt.Errorf("a symbol, file or package path is required")
+}
+
+// undocumentedSymbols returns the exported symbols of a file that have no documentation
+func (s *service) undocumentedSymbols(path string) ([]docTarget, error) {
+	meta, err := s.edits.fs.GetFileMetadata(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", path, err)
+	}
+	lines, err := s.sourceLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []docTarget
+	for _, sym := range meta.Symbols {
+		t, documented, ok := newDocTarget(sym, lines)
+		if ok && !documented && isExportedSymbol(sym, t.language, lines) {
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+func (s *service) sourceLines(path string) ([]string, error) {
+	content, err := s.readSource(path)
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(content), nil
+}
+
+// newDocTarget works out where a symbol's comment goes and whether it already
+// has one. ok is false when the declaration is not where the index says.
+func newDocTarget(sym filesystem.Symbol, lines []string) (t docTarget, documented, ok bool) {
+	if sym.Line < 1 || sym.Line > len(lines) {
+		return t, false, false
+	}
+	t = docTarget{symbol: sym, language: filesystem.LanguageForPath(sym.Path)}
+	decl := sym.Line - 1 // 0-based
+	t.snippet = strings.Join(lines[decl:min(decl+docSnippetLines, len(lines))], "\n")
+
+	if t.language == "python" {
+		// Docstrings are the first statement of the body, after the signature
+		end := decl
+		for end < len(lines) && !strings.HasSuffix(stripPythonComment(lines[end]), ":") {
+			end++
+		}
+		if end == len(lines) {
+			return t, false, false
+		}
+		body := end + 1
+		for body < len(lines) && strings.TrimSpace(lines[body]) == "" {
+			body++
+		}
+		t.insertLine = end + 2
+		t.indent = leadingSpace(lines[decl]) + "    "
+		if body < len(lines) && len(leadingSpace(lines[body])) > len(leadingSpace(lines[decl])) {
+			t.indent = leadingSpace(lines[body])
+			first := strings.TrimLeft(strings.TrimSpace(lines[body]), "rRbBuU")
+			documented = strings.HasPrefix(first, `"""`) || strings.HasPrefix(first, `'''`)
+		}
+		return t, documented, true
+	}
+
+	// Comments go above decorators and attributes, which belong to the declaration
+	start := decl
+	for start > 0 {
+		above := strings.TrimSpace(lines[start-1])
+		if t.language == "rust" && strings.HasPrefix(above, "#[") ||
+			(t.language == "typescript" || t.language == "javascript") && strings.HasPrefix(above, "@") {
+			start--
+			continue
+		}
+		break
+	}
+	t.insertLine = start + 1
+	t.indent = leadingSpace(lines[decl])
+	if start > 0 {
+		above := strings.TrimSpace(lines[start-1])
+		documented = strings.HasPrefix(above, "//") || strings.HasSuffix(above, "*/")
+	}
+	return t, documented, true
+}
+
+// isExportedSymbol reports whether a symbol is part of its package's public API
+func isExportedSymbol(sym filesystem.Symbol, language string, lines []string) bool {
+	decl := strings.TrimSpace(lines[sym.Line-1])
+	switch language {
+	case "go":
+		return ast.IsExported(sym.Name) && (sym.Parent == "" || ast.IsExported(sym.Parent))
+	case "python":
+		return !strings.HasPrefix(sym.Name, "_") && !strings.HasPrefix(sym.Parent, "_")
+	case "rust":
+		return strings.HasPrefix(decl, "pub")
+	case "typescript", "javascript":
+		return strings.HasPrefix(decl, "export")
+	}
+	return false
+}
+
+// isTestFile reports whether a file holds tests, which batch mode leaves alone
+func isTestFile(name string) bool {
+	return strings.HasSuffix(name, "_test.go") || strings.HasSuffix(name, "_test.py") ||
+		strings.HasPrefix(name, "test_") || strings.Contains(name, ".test.") || strings.Contains(name, ".spec.")
+}
+
+// formatDocComment formats documentation text as a comment in the language's style
+func formatDocComment(doc, language, indent string) string {
+	lines := strings.Split(doc, "\n")
+	var b strings.Builder
+	switch language {
+	case "python":
+		doc = strings.ReplaceAll(doc, `"""`, `\"\"\"`)
+		lines = strings.Split(doc, "\n")
+		if len(lines) == 1 {
+			return indent + `"""` + doc + `"""` + "\n"
+		}
+		b.WriteString(indent + `"""` + lines[0] + "\n")
+		for _, line := range lines[1:] {
+			if strings.TrimSpace(line) == "" {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(indent + line + "\n")
+			}
+		}
+		b.WriteString(indent + `"""` + "\n")
+	case "typescript", "javascript":
+		doc = strings.ReplaceAll(doc, "*/", `*\/`)
+		lines = strings.Split(doc, "\n")
+		if len(lines) == 1 {
+			return indent + "/** " + doc + " */\n"
+		}
+		b.WriteString(indent + "/**\n")
+		for _, line := range lines {
+			b.WriteString(strings.TrimRight(indent+" * "+line, " ") + "\n")
+		}
+		b.WriteString(indent + " */\n")
+	default:
+		marker := "//"
+		if language == "rust" {
+			marker = "///"
+		}
+		for _, line := range lines {
+			b.WriteString(strings.TrimRight(indent+marker+" "+line, " ") + "\n")
+		}
+	}
+	return b.String()
+}
+
+// stripPythonComment removes a trailing comment and whitespace from a line of Python
+func stripPythonComment(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 && !strings.ContainsAny(line[:i], `"'`) {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
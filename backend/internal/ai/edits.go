@@ -0,0 +1,372 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"glask-ide/internal/filesystem"
+)
+
+const (
+	// maxStoredProposals bounds how many unapplied proposals are kept for ApplyEdits
+	maxStoredProposals = 100
+
+	// maxUndoSteps bounds how many applied edit sets can be undone
+	maxUndoSteps = 50
+
+	proposalTTL = time.Hour
+)
+
+var (
+	// ErrProposalNotFound is returned when applying an unknown or expired proposal
+	ErrProposalNotFound = errors.New("edit proposal not found")
+
+	// ErrUndoNotFound is returned when undoing an unknown edit set
+	ErrUndoNotFound = errors.New("applied edit set not found")
+
+	// ErrInvalidEdit is returned when edits do not fit the file or would break its syntax
+	ErrInvalidEdit = errors.New("invalid edit")
+
+	// ErrEditConflict is returned when a file changed since edits were proposed or applied
+	ErrEditConflict = errors.New("file changed since the edits were computed")
+)
+
+// TextEdit replaces a range of a file with new text. The range is half-open:
+// [Start, End). An empty range inserts; a range in a missing file creates it.
+type TextEdit struct {
+	FilePath string    `json:"filePath"`
+	Range    TextRange `json:"range"`
+	NewText  string    `json:"newText"`
+}
+
+// FileChange is the effect of an edit set on one file
+type FileChange struct {
+	Path       string `json:"path"`
+	OldContent string `json:"-"`
+	NewContent string `json:"-"`
+	Diff       string `json:"diff"`
+	Created    bool   `json:"created,omitempty"`
+}
+
+// EditProposal is a validated set of edits that can be previewed and applied
+type EditProposal struct {
+	ID          string       `json:"id"`
+	Explanation string       `json:"explanation"`
+	Edits       []TextEdit   `json:"edits"`
+	Changes     []FileChange `json:"changes"`
+}
+
+// Diff returns the unified diff of every file the proposal touches
+func (p *EditProposal) Diff() string {
+	var b strings.Builder
+	for _, c := range p.Changes {
+		b.WriteString(c.Diff)
+	}
+	return b.String()
+}
+
+// AppliedEdits records an applied edit set so it can be undone as one step
+type AppliedEdits struct {
+	ID        string       `json:"id"`
+	Files     []string     `json:"files"`
+	AppliedAt time.Time    `json:"appliedAt"`
+	changes   []FileChange // Old and new content, used for undo
+}
+
+// editManager computes, stores, applies and undoes edit sets through the filesystem service
+type editManager struct {
+	fs        filesystem.Service
+	proposals *lruCache[*EditProposal]
+	mu        sync.Mutex // Serialises apply and undo
+	applied   *lruCache[*AppliedEdits]
+}
+
+func newEditManager(fs filesystem.Service) *editManager {
+	return &editManager{
+		fs:        fs,
+		proposals: newLRUCache[*EditProposal](maxStoredProposals, proposalTTL),
+		applied:   newLRUCache[*AppliedEdits](maxUndoSteps, 0),
+	}
+}
+
+// propose validates edits against the current files and stores the resulting proposal
+func (m *editManager) propose(explanation string, edits []TextEdit) (*EditProposal, error) {
+	changes, err := m.computeChanges(edits)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := &EditProposal{
+		ID:          generateID(),
+		Explanation: explanation,
+		Edits:       edits,
+		Changes:     changes,
+	}
+	m.proposals.Put(proposal.ID, proposal)
+	return proposal, nil
+}
+
+// computeChanges applies edits in memory and validates that every resulting file still parses
+func (m *editManager) computeChanges(edits []TextEdit) ([]FileChange, error) {
+	byFile := make(map[string][]TextEdit)
+	var order []string
+	for _, edit := range edits {
+		if edit.FilePath == "" {
+			return nil, fmt.Errorf("%w: missing file path", ErrInvalidEdit)
+		}
+		if _, ok := byFile[edit.FilePath]; !ok {
+			order = append(order, edit.FilePath)
+		}
+		byFile[edit.FilePath] = append(byFile[edit.FilePath], edit)
+	}
+
+	changes := make([]FileChange, 0, len(order))
+	for _, path := range order {
+		created := false
+		content, err := m.fs.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			created = true
+		}
+
+		oldContent := string(content)
+		newContent, err := applyTextEdits(oldContent, byFile[path])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidEdit, err)
+		}
+		if err := validateSource(path, oldContent, newContent); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidEdit, err)
+		}
+
+		changes = append(changes, FileChange{
+			Path:       path,
+			OldContent: oldContent,
+			NewContent: newContent,
+			Diff:       unifiedDiff(path, oldContent, newContent),
+			Created:    created,
+		})
+	}
+
+	return changes, nil
+}
+
+// apply writes a proposal (or an explicit edit list) to disk as a single
+// undoable step, rolling back already-written files if any write fails
+func (m *editManager) apply(proposalID string, edits []TextEdit) (*AppliedEdits, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var changes []FileChange
+	if proposalID != "" {
+		proposal, ok := m.proposals.Get(proposalID)
+		if !ok {
+			return nil, ErrProposalNotFound
+		}
+		// Make sure nothing changed underneath the proposal
+		for _, c := range proposal.Changes {
+			if current, err := m.fs.ReadFile(c.Path); (err == nil && string(current) != c.OldContent) || (err != nil && !c.Created) {
+				return nil, fmt.Errorf("%s: %w", c.Path, ErrEditConflict)
+			}
+		}
+		changes = proposal.Changes
+	} else {
+		var err error
+		if changes, err = m.computeChanges(edits); err != nil {
+			return nil, err
+		}
+	}
+
+	written := make([]FileChange, 0, len(changes))
+	for _, c := range changes {
+		if err := m.fs.WriteFile(c.Path, []byte(c.NewContent)); err != nil {
+			m.revert(written)
+			return nil, fmt.Errorf("failed to write %s: %w", c.Path, err)
+		}
+		written = append(written, c)
+	}
+
+	applied := &AppliedEdits{
+		ID:        generateID(),
+		AppliedAt: time.Now(),
+		changes:   changes,
+	}
+	for _, c := range changes {
+		applied.Files = append(applied.Files, c.Path)
+	}
+	m.applied.Put(applied.ID, applied)
+	if proposalID != "" {
+		m.proposals.Delete(proposalID) // A proposal can only be applied once
+	}
+
+	return applied, nil
+}
+
+// undo restores every file of an applied edit set, refusing if any was modified since
+func (m *editManager) undo(appliedID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	applied, ok := m.applied.Get(appliedID)
+	if !ok {
+		return nil, ErrUndoNotFound
+	}
+
+	for _, c := range applied.changes {
+		current, err := m.fs.ReadFile(c.Path)
+		if err != nil || string(current) != c.NewContent {
+			return nil, fmt.Errorf("%s: %w", c.Path, ErrEditConflict)
+		}
+	}
+
+	m.revert(applied.changes)
+	m.applied.Delete(appliedID)
+	return applied.Files, nil
+}
+
+// revert restores the original content of changed files, deleting created ones
+func (m *editManager) revert(changes []FileChange) {
+	for _, c := range changes {
+		var err error
+		if c.Created {
+			err = m.fs.DeleteFile(c.Path)
+		} else {
+			err = m.fs.WriteFile(c.Path, []byte(c.OldContent))
+		}
+		if err != nil {
+			fmt.Printf("Error reverting %s: %v\n", c.Path, err)
+		}
+	}
+}
+
+// applyTextEdits applies non-overlapping edits to content
+func applyTextEdits(content string, edits []TextEdit) (string, error) {
+	type span struct {
+		start, end int
+		text       string
+	}
+
+	lineStarts := []int{0}
+	for i, r := range content {
+		if r == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	spans := make([]span, 0, len(edits))
+	for _, edit := range edits {
+		start, err := rangeOffset(content, lineStarts, edit.Range.StartLine, edit.Range.StartColumn)
+		if err != nil {
+			return "", err
+		}
+		end, err := rangeOffset(content, lineStarts, edit.Range.EndLine, edit.Range.EndColumn)
+		if err != nil {
+			return "", err
+		}
+		if end < start {
+			return "", fmt.Errorf("edit range ends before it starts (line %d)", edit.Range.StartLine)
+		}
+		spans = append(spans, span{start: start, end: end, text: edit.NewText})
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start < spans[i-1].end {
+			return "", fmt.Errorf("overlapping edits")
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, sp := range spans {
+		b.WriteString(content[last:sp.start])
+		b.WriteString(sp.text)
+		last = sp.end
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
+
+// rangeOffset converts a 1-based line and column (in characters) to a byte
+// offset. Columns past the end of a line clamp to the line end, and the line
+// after the last one addresses the end of the file.
+func rangeOffset(content string, lineStarts []int, line, column int) (int, error) {
+	if line < 1 {
+		line = 1
+	}
+	if column < 1 {
+		column = 1
+	}
+	if line > len(lineStarts) {
+		if line == len(lineStarts)+1 && column == 1 {
+			return len(content), nil
+		}
+		return 0, fmt.Errorf("line %d is beyond the end of the file (%d lines)", line, len(lineStarts))
+	}
+
+	offset := lineStarts[line-1]
+	lineEnd := len(content)
+	if line < len(lineStarts) {
+		lineEnd = lineStarts[line] - 1 // Position of the newline
+	}
+
+	for col := 1; col < column && offset < lineEnd; col++ {
+		_, size := utf8.DecodeRuneInString(content[offset:])
+		offset += size
+	}
+	return offset, nil
+}
+
+// validateSource checks that edited code still parses. Files that did not
+// parse before the edit are only checked for regressions in bracket balance.
+func validateSource(path, oldContent, newContent string) error {
+	switch {
+	case strings.HasSuffix(path, ".json"):
+		if json.Valid([]byte(newContent)) || !json.Valid([]byte(oldContent)) && oldContent != "" {
+			return nil
+		}
+		return fmt.Errorf("edited file is not valid JSON")
+
+	case filesystem.LanguageForPath(path) == "go":
+		fset := token.NewFileSet()
+		if _, err := parser.ParseFile(fset, path, newContent, parser.AllErrors); err != nil {
+			if oldContent != "" {
+				if _, oldErr := parser.ParseFile(token.NewFileSet(), path, oldContent, parser.AllErrors); oldErr != nil {
+					return nil // Already broken before the edit
+				}
+			}
+			return fmt.Errorf("edited file does not parse: %v", err)
+		}
+		return nil
+
+	case filesystem.LanguageForPath(path) != "":
+		if bracketsBalanced(newContent) || !bracketsBalanced(oldContent) {
+			return nil
+		}
+		return fmt.Errorf("edited file has unbalanced brackets")
+	}
+
+	return nil
+}
+
+// bracketsBalanced reports whether (), [] and {} are balanced, ignoring string literals
+func bracketsBalanced(content string) bool {
+	depth := 0
+	for _, line := range strings.Split(content, "\n") {
+		depth += bracketDelta(line)
+		if depth < 0 {
+			return false
+		}
+	}
+	return depth == 0
+}
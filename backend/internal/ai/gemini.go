@@ -6,14 +6,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
-const geminiAPIURL = "https://generativelanguage.googleapis.com/v1/models/%s:generateContent"
+const (
+	geminiAPIURL   = "https://generativelanguage.googleapis.com/v1/models/%s:generateContent"
+	geminiEmbedURL = "https://generativelanguage.googleapis.com/v1/models/text-embedding-004:embedContent"
+)
 
 type geminiRequest struct {
 	Contents         []geminiContent        `json:"contents"`
 	GenerationConfig geminiGenerationConfig `json:"generationConfig,omitempty"`
 	SafetySettings   []geminiSafetySetting  `json:"safetySettings,omitempty"`
+	Tools            []geminiTool           `json:"tools,omitempty"`
 }
 
 type geminiContent struct {
@@ -22,11 +27,33 @@ type geminiContent struct {
 }
 
 type geminiPart struct {
-	Text string `json:"text"`
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
 }
 
 type geminiGenerationConfig struct {
-	Temperature     float64  `json:"temperature,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
 	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
 	StopSequences   []string `json:"stopSequences,omitempty"`
 	TopP            float64  `json:"topP,omitempty"`
@@ -38,16 +65,9 @@ type geminiSafetySetting struct {
 	Threshold string `json:"threshold"`
 }
 
-func buildGeminiRequest(ctx context.Context, prompt string, config Config, opts Options) (*http.Request, error) {
+func buildGeminiRequest(ctx context.Context, messages []Message, config Config, opts Options) (*http.Request, error) {
 	reqBody := geminiRequest{
-		Contents: []geminiContent{
-			{
-				Role: "user",
-				Parts: []geminiPart{
-					{Text: config.SystemPrompt + "\n\n" + prompt},
-				},
-			},
-		},
+		Contents: geminiContents(messages, config),
 		GenerationConfig: geminiGenerationConfig{
 			Temperature:     opts.Temperature,
 			MaxOutputTokens: opts.MaxTokens,
@@ -62,6 +82,17 @@ func buildGeminiRequest(ctx context.Context, prompt string, config Config, opts
 			{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Threshold: "BLOCK_NONE"},
 		},
 	}
+	if len(opts.Tools) > 0 {
+		declarations := make([]geminiFunctionDeclaration, len(opts.Tools))
+		for i, tool := range opts.Tools {
+			declarations[i] = geminiFunctionDeclaration{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			}
+		}
+		reqBody.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
@@ -80,11 +111,54 @@ func buildGeminiRequest(ctx context.Context, prompt string, config Config, opts
 	return req, nil
 }
 
+// geminiContents converts a message list to Gemini's turn format
+func geminiContents(messages []Message, config Config) []geminiContent {
+	contents := make([]geminiContent, 0, len(messages))
+	for i, msg := range messages {
+		// Gemini calls the assistant role "model"
+		role := msg.Role
+		if role == "assistant" {
+			role = "model"
+		}
+
+		// Gemini has no system role, so the system prompt leads the first turn
+		text := msg.Content
+		if i == 0 {
+			text = config.SystemPrompt + "\n\n" + text
+		}
+
+		// Function calls and responses travel as their own parts; Gemini
+		// matches responses to calls by name
+		var parts []geminiPart
+		if text != "" || (len(msg.ToolCalls) == 0 && len(msg.ToolResults) == 0) {
+			parts = append(parts, geminiPart{Text: text})
+		}
+		for _, call := range msg.ToolCalls {
+			parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Name, Args: call.Arguments}})
+		}
+		for _, result := range msg.ToolResults {
+			response := map[string]any{"result": result.Content}
+			if result.IsError {
+				response = map[string]any{"error": result.Content}
+			}
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{Name: result.Name, Response: response}})
+		}
+
+		contents = append(contents, geminiContent{
+			Role:  role,
+			Parts: parts,
+		})
+	}
+
+	return contents
+}
+
 type geminiResponse struct {
 	Candidates []struct {
 		Content struct {
 			Parts []struct {
-				Text string `json:"text"`
+				Text         string              `json:"text"`
+				FunctionCall *geminiFunctionCall `json:"functionCall,omitempty"`
 			} `json:"parts"`
 		} `json:"content"`
 		FinishReason  string `json:"finishReason"`
@@ -109,13 +183,23 @@ func parseGeminiResponse(resp *geminiResponse) *Response {
 
 	candidate := resp.Candidates[0]
 	output := ""
-	if len(candidate.Content.Parts) > 0 {
-		output = candidate.Content.Parts[0].Text
+	var toolCalls []ToolCall
+	for _, part := range candidate.Content.Parts {
+		output += part.Text
+		if part.FunctionCall != nil {
+			// Gemini does not assign call IDs, so number them within the turn
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        fmt.Sprintf("call_%d", len(toolCalls)+1),
+				Name:      part.FunctionCall.Name,
+				Arguments: part.FunctionCall.Args,
+			})
+		}
 	}
 
 	return &Response{
-		Status: "succeeded",
-		Output: output,
+		Status:    "succeeded",
+		Output:    output,
+		ToolCalls: toolCalls,
 		Metrics: Metrics{
 			TotalTokens:      candidate.TokenCount + resp.PromptFeedback.TokenCount,
 			PromptTokens:     resp.PromptFeedback.TokenCount,
@@ -150,12 +234,80 @@ func parseGeminiStreamChunk(chunk *geminiStreamChunk) StreamChunk {
 	}
 
 	chunkType := "text"
+	stopReason := ""
 	if candidate.FinishReason != "" {
 		chunkType = "done"
+		stopReason = geminiStopReason(candidate.FinishReason)
 	}
 
 	return StreamChunk{
-		Type:    chunkType,
-		Content: content,
+		Type:       chunkType,
+		Content:    content,
+		StopReason: stopReason,
+	}
+}
+
+// geminiStopReason maps Gemini's finish reasons to the ones reported to clients
+func geminiStopReason(reason string) string {
+	switch reason {
+	case "STOP":
+		return "end"
+	case "MAX_TOKENS":
+		return "max_tokens"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT":
+		return "filtered"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// geminiEmbedder computes text embeddings with Gemini's embedding model
+type geminiEmbedder struct {
+	apiToken   string
+	httpClient *http.Client
+}
+
+func newGeminiEmbedder(apiToken string) *geminiEmbedder {
+	return &geminiEmbedder{apiToken: apiToken, httpClient: &http.Client{}}
+}
+
+// Embed returns the embedding vector of text
+func (e *geminiEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	reqBody := struct {
+		Content geminiContent `json:"content"`
+	}{
+		Content: geminiContent{Parts: []geminiPart{{Text: text}}},
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", geminiEmbedURL, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", e.apiToken)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding request failed: %s", resp.Status)
+	}
+
+	var embedResp struct {
+		Embedding struct {
+			Values []float32 `json:"values"`
+		} `json:"embedding"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
 	}
+	return embedResp.Embedding.Values, nil
 }
@@ -2,7 +2,13 @@ package ai
 
 import (
 	"context"
+	"errors"
 	pb "glask-ide/internal/ai/proto"
+	"os"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // GRPCServer implements the AIService gRPC interface
@@ -22,28 +28,32 @@ func NewGRPCServer(service Service) *GRPCServer {
 func (s *GRPCServer) Complete(ctx context.Context, req *pb.CompletionRequest) (*pb.CompletionResponse, error) {
 	opts := Options{
 		MaxTokens:     int(req.GetMaxTokens()),
-		Temperature:   float64(req.GetTemperature()),
+		Temperature:   fromPBFloat(req.Temperature),
 		StopSequences: req.StopSequences,
 		TopP:          float64(req.GetTopP()),
 		TopK:          int(req.GetTopK()),
+		Editor:        fromPBEditorContext(req.Editor),
+		ContextBudget: int(req.GetContextBudget()),
+		ModelID:       req.ModelId,
+		SessionID:     req.SessionId,
+		NoCache:       req.NoCache,
+		Template:      req.Template,
+		TemplateVars:  req.TemplateVars,
 	}
 
 	resp, err := s.service.Complete(ctx, req.Prompt, opts)
 	if err != nil {
-		return nil, err
+		return nil, completionError(err)
 	}
 
 	return &pb.CompletionResponse{
-		Id:     resp.ID,
-		Status: resp.Status,
-		Output: resp.Output,
-		Error:  &resp.Error,
-		Metrics: &pb.CompletionMetrics{
-			TotalTokens:      int32(resp.Metrics.TotalTokens),
-			PromptTokens:     int32(resp.Metrics.PromptTokens),
-			CompletionTokens: int32(resp.Metrics.CompletionTokens),
-			TotalTimeMs:      resp.Metrics.TotalTime.Milliseconds(),
-		},
+		Id:           resp.ID,
+		Model:        resp.Model,
+		Status:       resp.Status,
+		Output:       resp.Output,
+		Error:        &resp.Error,
+		Metrics:      toPBCompletionMetrics(resp.Metrics),
+		ContextFiles: toPBContextFiles(resp.Context),
 	}, nil
 }
 
@@ -51,28 +61,33 @@ func (s *GRPCServer) Complete(ctx context.Context, req *pb.CompletionRequest) (*
 func (s *GRPCServer) StreamComplete(req *pb.CompletionRequest, stream pb.AIService_StreamCompleteServer) error {
 	opts := Options{
 		MaxTokens:     int(req.GetMaxTokens()),
-		Temperature:   float64(req.GetTemperature()),
+		Temperature:   fromPBFloat(req.Temperature),
 		StopSequences: req.StopSequences,
 		TopP:          float64(req.GetTopP()),
 		TopK:          int(req.GetTopK()),
 		Stream:        true,
+		Editor:        fromPBEditorContext(req.Editor),
+		ContextBudget: int(req.GetContextBudget()),
+		ModelID:       req.ModelId,
+		SessionID:     req.SessionId,
+		Template:      req.Template,
+		TemplateVars:  req.TemplateVars,
 	}
 
 	callback := func(chunk StreamChunk) error {
-		return stream.Send(&pb.CompletionChunk{
-			Type:      chunk.Type,
-			Content:   chunk.Content,
-			Timestamp: chunk.Timestamp.UnixNano() / 1e6, // Convert to milliseconds
-		})
+		return stream.Send(toPBCompletionChunk(chunk))
 	}
 
-	return s.service.Stream(stream.Context(), req.Prompt, callback, opts)
+	if err := s.service.Stream(stream.Context(), req.Prompt, callback, opts); err != nil {
+		return completionError(err)
+	}
+	return nil
 }
 
 // GetModels returns available models
 func (s *GRPCServer) GetModels(ctx context.Context, req *pb.GetModelsRequest) (*pb.GetModelsResponse, error) {
 	models := s.service.GetModels()
-	activeModel := s.service.GetActiveModel()
+	activeModel := s.service.GetActiveModel(req.SessionId)
 
 	pbModels := make([]*pb.ModelInfo, len(models))
 	for i, model := range models {
@@ -101,7 +116,7 @@ func (s *GRPCServer) GetModels(ctx context.Context, req *pb.GetModelsRequest) (*
 
 // SetActiveModel changes the active model
 func (s *GRPCServer) SetActiveModel(ctx context.Context, req *pb.SetActiveModelRequest) (*pb.SetActiveModelResponse, error) {
-	if err := s.service.SetActiveModel(req.ModelId); err != nil {
+	if err := s.service.SetActiveModel(req.SessionId, req.ModelId); err != nil {
 		errStr := err.Error()
 		return &pb.SetActiveModelResponse{
 			Success: false,
@@ -109,7 +124,7 @@ func (s *GRPCServer) SetActiveModel(ctx context.Context, req *pb.SetActiveModelR
 		}, nil
 	}
 
-	activeModel := s.service.GetActiveModel()
+	activeModel := s.service.GetActiveModel(req.SessionId)
 	return &pb.SetActiveModelResponse{
 		Success: true,
 		ActiveModel: &pb.ModelInfo{
@@ -122,3 +137,830 @@ func (s *GRPCServer) SetActiveModel(ctx context.Context, req *pb.SetActiveModelR
 		},
 	}, nil
 }
+
+// CreateConversation starts a new conversation
+func (s *GRPCServer) CreateConversation(ctx context.Context, req *pb.CreateConversationRequest) (*pb.Conversation, error) {
+	conv, err := s.service.CreateConversation(req.Title)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toPBConversation(conv), nil
+}
+
+// ListConversations returns all stored conversations
+func (s *GRPCServer) ListConversations(ctx context.Context, req *pb.ListConversationsRequest) (*pb.ListConversationsResponse, error) {
+	conversations, err := s.service.ListConversations()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	pbConversations := make([]*pb.Conversation, len(conversations))
+	for i := range conversations {
+		pbConversations[i] = toPBConversation(&conversations[i])
+	}
+
+	return &pb.ListConversationsResponse{Conversations: pbConversations}, nil
+}
+
+// GetConversation returns a conversation and its full message history
+func (s *GRPCServer) GetConversation(ctx context.Context, req *pb.GetConversationRequest) (*pb.GetConversationResponse, error) {
+	conv, messages, err := s.service.GetConversation(req.ConversationId)
+	if err != nil {
+		return nil, conversationError(err)
+	}
+
+	pbMessages := make([]*pb.ConversationMessage, len(messages))
+	for i := range messages {
+		pbMessages[i] = toPBConversationMessage(&messages[i])
+	}
+
+	return &pb.GetConversationResponse{
+		Conversation: toPBConversation(conv),
+		Messages:     pbMessages,
+	}, nil
+}
+
+// DeleteConversation removes a conversation
+func (s *GRPCServer) DeleteConversation(ctx context.Context, req *pb.DeleteConversationRequest) (*pb.DeleteConversationResponse, error) {
+	if err := s.service.DeleteConversation(req.ConversationId); err != nil {
+		return nil, conversationError(err)
+	}
+	return &pb.DeleteConversationResponse{Success: true}, nil
+}
+
+// AppendMessage adds a turn to a conversation without calling the model
+func (s *GRPCServer) AppendMessage(ctx context.Context, req *pb.AppendMessageRequest) (*pb.ConversationMessage, error) {
+	msg, err := s.service.AppendMessage(req.ConversationId, req.Role, req.Content)
+	if err != nil {
+		return nil, conversationError(err)
+	}
+	return toPBConversationMessage(msg), nil
+}
+
+// Chat sends a message in a conversation and streams the model's reply
+func (s *GRPCServer) Chat(req *pb.ChatRequest, stream pb.AIService_ChatServer) error {
+	opts := Options{
+		MaxTokens:     int(req.GetMaxTokens()),
+		Temperature:   fromPBFloat(req.Temperature),
+		StopSequences: req.StopSequences,
+		TopP:          float64(req.GetTopP()),
+		TopK:          int(req.GetTopK()),
+		Stream:        true,
+		Editor:        fromPBEditorContext(req.Editor),
+		ContextBudget: int(req.GetContextBudget()),
+		ModelID:       req.ModelId,
+		SessionID:     req.SessionId,
+		Template:      req.Template,
+		TemplateVars:  req.TemplateVars,
+	}
+
+	callback := func(chunk StreamChunk) error {
+		return stream.Send(toPBCompletionChunk(chunk))
+	}
+
+	if err := s.service.Chat(stream.Context(), req.ConversationId, req.Message, callback, opts); err != nil {
+		return conversationError(err)
+	}
+	return nil
+}
+
+// BuildContext previews the workspace context assembled for an editor position
+func (s *GRPCServer) BuildContext(ctx context.Context, req *pb.BuildContextRequest) (*pb.BuildContextResponse, error) {
+	if req.Editor == nil || req.Editor.FilePath == "" {
+		return nil, status.Error(codes.InvalidArgument, "editor file path is required")
+	}
+
+	bundle, err := s.service.BuildContext(*fromPBEditorContext(req.Editor), int(req.GetBudget()), req.SessionId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.BuildContextResponse{
+		Files:  toPBContextFiles(bundle.Files),
+		Prompt: bundle.Prompt,
+		Tokens: int32(bundle.Tokens),
+	}, nil
+}
+
+// CodeComplete returns an inline fill-in-the-middle suggestion
+func (s *GRPCServer) CodeComplete(ctx context.Context, req *pb.CodeCompleteRequest) (*pb.CodeCompleteResponse, error) {
+	resp, err := s.service.CodeComplete(ctx, InlineCompletionRequest{
+		SessionID: req.SessionId,
+		FilePath:  req.FilePath,
+		Language:  req.Language,
+		Prefix:    req.Prefix,
+		Suffix:    req.Suffix,
+		MaxTokens: int(req.GetMaxTokens()),
+		ModelID:   req.ModelId,
+	})
+	if err != nil {
+		if errors.Is(err, ErrSuperseded) || errors.Is(err, context.Canceled) {
+			return nil, status.Error(codes.Canceled, err.Error())
+		}
+		return nil, completionError(err)
+	}
+
+	return &pb.CodeCompleteResponse{
+		Completion: resp.Text,
+		Cached:     resp.Cached,
+		Model:      resp.Model,
+		LatencyMs:  resp.Latency.Milliseconds(),
+	}, nil
+}
+
+// Generate asks the model for new code and returns it as an edit proposal
+func (s *GRPCServer) Generate(ctx context.Context, req *pb.GenerateRequest) (*pb.EditProposal, error) {
+	if req.Prompt == "" {
+		return nil, status.Error(codes.InvalidArgument, "prompt is required")
+	}
+	if req.FilePath == "" && req.Editor.GetFilePath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "file path is required")
+	}
+
+	proposal, err := s.service.GenerateCode(ctx, GenerateRequest{
+		Prompt:       req.Prompt,
+		FilePath:     req.FilePath,
+		Language:     req.Language,
+		Editor:       fromPBEditorContext(req.Editor),
+		ModelID:      req.ModelId,
+		SessionID:    req.SessionId,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		return nil, editError(err)
+	}
+	return toPBEditProposal(proposal), nil
+}
+
+// Refactor asks the model to rewrite existing code and returns the change as an edit proposal
+func (s *GRPCServer) Refactor(ctx context.Context, req *pb.RefactorRequest) (*pb.EditProposal, error) {
+	if req.FilePath == "" || req.Instruction == "" {
+		return nil, status.Error(codes.InvalidArgument, "file path and instruction are required")
+	}
+
+	refactorReq := RefactorRequest{
+		FilePath:     req.FilePath,
+		Instruction:  req.Instruction,
+		Editor:       fromPBEditorContext(req.Editor),
+		ModelID:      req.ModelId,
+		SessionID:    req.SessionId,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	}
+	if req.Selection != nil {
+		refactorReq.Selection = fromPBTextRange(req.Selection)
+	}
+
+	proposal, err := s.service.RefactorCode(ctx, refactorReq)
+	if err != nil {
+		return nil, editError(err)
+	}
+	return toPBEditProposal(proposal), nil
+}
+
+// Analyze reviews a file and returns its issues with an optional fix proposal
+func (s *GRPCServer) Analyze(ctx context.Context, req *pb.AnalyzeRequest) (*pb.AnalyzeResponse, error) {
+	if req.FilePath == "" {
+		return nil, status.Error(codes.InvalidArgument, "file path is required")
+	}
+
+	analysis, err := s.service.AnalyzeCode(ctx, AnalyzeRequest{
+		FilePath:     req.FilePath,
+		Code:         req.Code,
+		Editor:       fromPBEditorContext(req.Editor),
+		ModelID:      req.ModelId,
+		SessionID:    req.SessionId,
+		NoCache:      req.NoCache,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		return nil, editError(err)
+	}
+
+	resp := &pb.AnalyzeResponse{Summary: analysis.Summary}
+	for _, issue := range analysis.Issues {
+		resp.Issues = append(resp.Issues, &pb.CodeIssue{
+			Severity:   issue.Severity,
+			Message:    issue.Message,
+			StartLine:  int32(issue.StartLine),
+			EndLine:    int32(issue.EndLine),
+			Suggestion: issue.Suggestion,
+		})
+	}
+	if analysis.Proposal != nil {
+		resp.Proposal = toPBEditProposal(analysis.Proposal)
+	}
+	return resp, nil
+}
+
+// AnalyzeTerminal diagnoses the errors in terminal output and proposes fixes
+func (s *GRPCServer) AnalyzeTerminal(ctx context.Context, req *pb.AnalyzeTerminalRequest) (*pb.AnalyzeTerminalResponse, error) {
+	if req.TerminalId == "" && req.Output == "" {
+		return nil, status.Error(codes.InvalidArgument, "terminal ID or output is required")
+	}
+
+	analysis, err := s.service.AnalyzeTerminalOutput(ctx, TerminalAnalysisRequest{
+		TerminalID:   req.TerminalId,
+		Output:       req.Output,
+		ProjectPath:  req.ProjectPath,
+		Editor:       fromPBEditorContext(req.Editor),
+		ModelID:      req.ModelId,
+		SessionID:    req.SessionId,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		return nil, editError(err)
+	}
+
+	resp := &pb.AnalyzeTerminalResponse{Diagnosis: analysis.Diagnosis}
+	for _, d := range analysis.Diagnostics {
+		resp.Diagnostics = append(resp.Diagnostics, &pb.TerminalDiagnostic{
+			FilePath: d.FilePath,
+			Line:     int32(d.Line),
+			Column:   int32(d.Column),
+			Severity: d.Severity,
+			Message:  d.Message,
+			Language: d.Language,
+			Code:     d.Code,
+			Exists:   d.Exists,
+		})
+	}
+	if analysis.Proposal != nil {
+		resp.Proposal = toPBEditProposal(analysis.Proposal)
+	}
+	return resp, nil
+}
+
+// GenerateDocs writes doc comments for a symbol, a file or a package
+func (s *GRPCServer) GenerateDocs(ctx context.Context, req *pb.GenerateDocsRequest) (*pb.GenerateDocsResponse, error) {
+	if req.Symbol == "" && req.FilePath == "" && req.PackagePath == "" {
+		return nil, status.Error(codes.InvalidArgument, "symbol, file path or package path is required")
+	}
+
+	result, err := s.service.GenerateDocs(ctx, DocsRequest{
+		FilePath:     req.FilePath,
+		Symbol:       req.Symbol,
+		PackagePath:  req.PackagePath,
+		ProjectPath:  req.ProjectPath,
+		Editor:       fromPBEditorContext(req.Editor),
+		ModelID:      req.ModelId,
+		SessionID:    req.SessionId,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		return nil, editError(err)
+	}
+
+	resp := &pb.GenerateDocsResponse{}
+	for _, sym := range result.Symbols {
+		resp.Symbols = append(resp.Symbols, &pb.DocSymbol{
+			Name:     sym.Name,
+			Kind:     sym.Kind,
+			FilePath: sym.FilePath,
+			Line:     int32(sym.Line),
+			Doc:      sym.Doc,
+		})
+	}
+	if result.Proposal != nil {
+		resp.Proposal = toPBEditProposal(result.Proposal)
+	}
+	return resp, nil
+}
+
+// ApplyEdits applies a stored proposal or an explicit list of edits as one undoable step
+func (s *GRPCServer) ApplyEdits(ctx context.Context, req *pb.ApplyEditsRequest) (*pb.ApplyEditsResponse, error) {
+	if req.ProposalId == "" && len(req.Edits) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "proposal ID or edits are required")
+	}
+
+	edits := make([]TextEdit, 0, len(req.Edits))
+	for _, e := range req.Edits {
+		edit := TextEdit{FilePath: e.FilePath, NewText: e.NewText}
+		if e.Range != nil {
+			edit.Range = *fromPBTextRange(e.Range)
+		}
+		edits = append(edits, edit)
+	}
+
+	applied, err := s.service.ApplyEdits(req.ProposalId, edits)
+	if err != nil {
+		return nil, editError(err)
+	}
+
+	return &pb.ApplyEditsResponse{
+		Id:        applied.ID,
+		Files:     applied.Files,
+		AppliedAt: applied.AppliedAt.Unix(),
+	}, nil
+}
+
+// UndoEdits reverts a previously applied edit set
+func (s *GRPCServer) UndoEdits(ctx context.Context, req *pb.UndoEditsRequest) (*pb.UndoEditsResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	files, err := s.service.UndoEdits(req.Id)
+	if err != nil {
+		return nil, editError(err)
+	}
+	return &pb.UndoEditsResponse{Files: files}, nil
+}
+
+// RunAgent runs the agent loop and streams its events
+func (s *GRPCServer) RunAgent(req *pb.AgentRequest, stream pb.AIService_RunAgentServer) error {
+	if req.Task == "" {
+		return status.Error(codes.InvalidArgument, "task is required")
+	}
+
+	started := false
+	err := s.service.RunAgent(stream.Context(), AgentRequest{
+		Task:           req.Task,
+		ProjectPath:    req.ProjectPath,
+		ConversationID: req.ConversationId,
+		Editor:         fromPBEditorContext(req.Editor),
+		MaxSteps:       int(req.GetMaxSteps()),
+		ModelID:        req.ModelId,
+		SessionID:      req.SessionId,
+		Template:       req.Template,
+		TemplateVars:   req.TemplateVars,
+	}, func(event AgentEvent) error {
+		started = true
+		return stream.Send(toPBAgentEvent(event))
+	})
+
+	// Once the run has started, failures are reported as events
+	if err != nil && !started {
+		if errors.Is(err, ErrConversationNotFound) || errors.Is(err, ErrModelNotFound) ||
+			errors.Is(err, ErrTemplateNotFound) || errors.Is(err, ErrInvalidTemplate) {
+			return conversationError(err)
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// CancelAgent stops an in-flight agent run
+func (s *GRPCServer) CancelAgent(ctx context.Context, req *pb.CancelAgentRequest) (*pb.CancelAgentResponse, error) {
+	if err := s.service.CancelAgent(req.RunId); err != nil {
+		return nil, agentError(err)
+	}
+	return &pb.CancelAgentResponse{Success: true}, nil
+}
+
+// ApproveAgentAction approves or rejects a tool call waiting for the user
+func (s *GRPCServer) ApproveAgentAction(ctx context.Context, req *pb.ApproveAgentActionRequest) (*pb.ApproveAgentActionResponse, error) {
+	if err := s.service.ApproveAgentAction(req.RunId, req.CallId, req.Approved); err != nil {
+		return nil, agentError(err)
+	}
+	return &pb.ApproveAgentActionResponse{Success: true}, nil
+}
+
+// agentError maps agent errors to gRPC status errors
+func agentError(err error) error {
+	switch {
+	case errors.Is(err, ErrAgentRunNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrApprovalNotPending):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// CreateMemory stores a new memory
+func (s *GRPCServer) CreateMemory(ctx context.Context, req *pb.CreateMemoryRequest) (*pb.Memory, error) {
+	memory, err := s.service.CreateMemory(Memory{
+		Key:      req.MemoryKey,
+		Type:     req.MemoryType,
+		Project:  req.Project,
+		Content:  req.Content,
+		Metadata: req.Metadata,
+	})
+	if err != nil {
+		return nil, memoryError(err)
+	}
+	return toPBMemory(memory), nil
+}
+
+// UpdateMemory replaces an existing memory
+func (s *GRPCServer) UpdateMemory(ctx context.Context, req *pb.UpdateMemoryRequest) (*pb.Memory, error) {
+	memory, err := s.service.UpdateMemory(Memory{
+		ID:       req.Id,
+		Key:      req.MemoryKey,
+		Type:     req.MemoryType,
+		Project:  req.Project,
+		Content:  req.Content,
+		Metadata: req.Metadata,
+	})
+	if err != nil {
+		return nil, memoryError(err)
+	}
+	return toPBMemory(memory), nil
+}
+
+// DeleteMemory removes a memory
+func (s *GRPCServer) DeleteMemory(ctx context.Context, req *pb.DeleteMemoryRequest) (*pb.DeleteMemoryResponse, error) {
+	if err := s.service.DeleteMemory(req.Id); err != nil {
+		return nil, memoryError(err)
+	}
+	return &pb.DeleteMemoryResponse{Success: true}, nil
+}
+
+// ListMemories returns memories matching the request, ranked by relevance when it has a query
+func (s *GRPCServer) ListMemories(ctx context.Context, req *pb.ListMemoriesRequest) (*pb.ListMemoriesResponse, error) {
+	memories, err := s.service.ListMemories(ctx, MemoryFilter{
+		Key:     req.MemoryKey,
+		Type:    req.MemoryType,
+		Project: req.Project,
+		Query:   req.Query,
+		Limit:   int(req.GetLimit()),
+	})
+	if err != nil {
+		return nil, memoryError(err)
+	}
+
+	resp := &pb.ListMemoriesResponse{Memories: make([]*pb.Memory, len(memories))}
+	for i := range memories {
+		resp.Memories[i] = toPBMemory(&memories[i])
+	}
+	return resp, nil
+}
+
+// CountTokens measures a prompt against a model's context window
+func (s *GRPCServer) CountTokens(ctx context.Context, req *pb.CountTokensRequest) (*pb.CountTokensResponse, error) {
+	messages := make([]Message, 0, len(req.Messages)+1)
+	for _, msg := range req.Messages {
+		messages = append(messages, Message{Role: msg.Role, Content: msg.Content})
+	}
+	if req.Text != "" {
+		messages = append(messages, Message{Role: "user", Content: req.Text})
+	}
+	if len(messages) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "text or messages are required")
+	}
+
+	count, err := s.service.CountTokens(ctx, TokenCountRequest{
+		ModelID:   req.ModelId,
+		SessionID: req.SessionId,
+		Messages:  messages,
+		MaxTokens: int(req.GetMaxTokens()),
+	})
+	if err != nil {
+		return nil, completionError(err)
+	}
+
+	return &pb.CountTokensResponse{
+		ModelId: count.ModelID,
+		Tokens:  int32(count.Tokens),
+		Exact:   count.Exact,
+		Fits:    count.Fits,
+		Budget:  toPBPromptBudget(&count.Budget),
+	}, nil
+}
+
+// GetUsageSummary aggregates recorded usage by day, model, feature or project
+func (s *GRPCServer) GetUsageSummary(ctx context.Context, req *pb.UsageSummaryRequest) (*pb.UsageSummaryResponse, error) {
+	summaryReq := UsageSummaryRequest{GroupBy: req.GroupBy, Project: req.Project}
+	if req.From > 0 {
+		summaryReq.From = time.Unix(req.From, 0)
+	}
+	if req.To > 0 {
+		summaryReq.To = time.Unix(req.To, 0)
+	}
+
+	summary, err := s.service.GetUsageSummary(summaryReq)
+	if err != nil {
+		return nil, usageError(err)
+	}
+
+	resp := &pb.UsageSummaryResponse{
+		Rows:  make([]*pb.UsageSummaryRow, len(summary.Rows)),
+		Total: toPBUsageSummaryRow(summary.Total),
+	}
+	for i, row := range summary.Rows {
+		resp.Rows[i] = toPBUsageSummaryRow(row)
+	}
+	return resp, nil
+}
+
+// GetUsageLimits returns the spend limits with the current spend
+func (s *GRPCServer) GetUsageLimits(ctx context.Context, req *pb.GetUsageLimitsRequest) (*pb.UsageLimits, error) {
+	usage, err := s.service.GetUsageStatus()
+	if err != nil {
+		return nil, usageError(err)
+	}
+	return toPBUsageLimits(usage), nil
+}
+
+// SetUsageLimits changes the spend limits
+func (s *GRPCServer) SetUsageLimits(ctx context.Context, req *pb.SetUsageLimitsRequest) (*pb.UsageLimits, error) {
+	usage, err := s.service.SetUsageLimits(UsageLimits{
+		DailyCost:   req.DailyCostLimit,
+		MonthlyCost: req.MonthlyCostLimit,
+	})
+	if err != nil {
+		return nil, usageError(err)
+	}
+	return toPBUsageLimits(usage), nil
+}
+
+// ListPromptTemplates returns the prompt templates selectable for a project
+func (s *GRPCServer) ListPromptTemplates(ctx context.Context, req *pb.ListPromptTemplatesRequest) (*pb.ListPromptTemplatesResponse, error) {
+	templates := s.service.ListTemplates(req.ProjectPath)
+
+	resp := &pb.ListPromptTemplatesResponse{Templates: make([]*pb.PromptTemplate, 0, len(templates))}
+	for _, t := range templates {
+		resp.Templates = append(resp.Templates, &pb.PromptTemplate{
+			Name:        t.Name,
+			Version:     int32(t.Version),
+			Description: t.Description,
+			Source:      t.Source,
+			Path:        t.Path,
+		})
+	}
+	return resp, nil
+}
+
+// usageError maps usage errors to gRPC status errors
+func usageError(err error) error {
+	if errors.Is(err, ErrInvalidUsageQuery) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// memoryError maps memory errors to gRPC status errors
+func memoryError(err error) error {
+	switch {
+	case errors.Is(err, ErrMemoryNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidMemory):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// editError maps edit errors to gRPC status errors
+func editError(err error) error {
+	switch {
+	case errors.Is(err, ErrProposalNotFound), errors.Is(err, ErrUndoNotFound), errors.Is(err, os.ErrNotExist),
+		errors.Is(err, ErrTemplateNotFound), errors.Is(err, ErrTerminalNotFound), errors.Is(err, ErrSymbolNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidEdit), errors.Is(err, ErrPromptTooLarge), errors.Is(err, ErrInvalidTemplate),
+		errors.Is(err, ErrNoDiagnostics), errors.Is(err, ErrAmbiguousSymbol):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrEditConflict), errors.Is(err, ErrAlreadyDocumented):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrBudgetExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// conversationError maps conversation errors to gRPC status errors
+func conversationError(err error) error {
+	switch {
+	case errors.Is(err, ErrConversationNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidRole):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return completionError(err)
+}
+
+// completionError maps errors from sending a prompt to gRPC status errors
+func completionError(err error) error {
+	switch {
+	case errors.Is(err, ErrPromptTooLarge), errors.Is(err, ErrInvalidTemplate):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrModelNotFound), errors.Is(err, ErrTemplateNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrBudgetExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, ErrIdleTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.unavailable() {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toPBConversation(conv *Conversation) *pb.Conversation {
+	return &pb.Conversation{
+		Id:           conv.ID,
+		Title:        conv.Title,
+		CreatedAt:    conv.CreatedAt.Unix(),
+		UpdatedAt:    conv.UpdatedAt.Unix(),
+		MessageCount: int32(conv.MessageCount),
+	}
+}
+
+func toPBConversationMessage(msg *ConversationMessage) *pb.ConversationMessage {
+	return &pb.ConversationMessage{
+		Index:      int32(msg.Index),
+		Role:       msg.Role,
+		Content:    msg.Content,
+		TokenCount: int32(msg.TokenCount),
+		Timestamp:  msg.Timestamp.Unix(),
+	}
+}
+
+func fromPBEditorContext(ec *pb.EditorContext) *EditorContext {
+	if ec == nil {
+		return nil
+	}
+
+	editor := &EditorContext{
+		FilePath:     ec.FilePath,
+		ProjectPath:  ec.ProjectPath,
+		Language:     ec.Language,
+		CursorLine:   int(ec.CursorLine),
+		CursorColumn: int(ec.CursorColumn),
+	}
+	if ec.Selection != nil {
+		editor.Selection = fromPBTextRange(ec.Selection)
+	}
+	return editor
+}
+
+// fromPBFloat converts an optional proto float, keeping unset values unset
+func fromPBFloat(v *float32) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
+
+func fromPBTextRange(r *pb.TextRange) *TextRange {
+	return &TextRange{
+		StartLine:   int(r.StartLine),
+		StartColumn: int(r.StartColumn),
+		EndLine:     int(r.EndLine),
+		EndColumn:   int(r.EndColumn),
+	}
+}
+
+func toPBContextFiles(files []ContextFile) []*pb.ContextFile {
+	if len(files) == 0 {
+		return nil
+	}
+
+	pbFiles := make([]*pb.ContextFile, len(files))
+	for i, f := range files {
+		pbFiles[i] = &pb.ContextFile{
+			Path:      f.Path,
+			Reason:    f.Reason,
+			StartLine: int32(f.StartLine),
+			EndLine:   int32(f.EndLine),
+			Tokens:    int32(f.Tokens),
+			Truncated: f.Truncated,
+		}
+	}
+	return pbFiles
+}
+
+func toPBCompletionMetrics(m Metrics) *pb.CompletionMetrics {
+	return &pb.CompletionMetrics{
+		TotalTokens:      int32(m.TotalTokens),
+		PromptTokens:     int32(m.PromptTokens),
+		CompletionTokens: int32(m.CompletionTokens),
+		TotalTimeMs:      m.TotalTime.Milliseconds(),
+		Budget:           toPBPromptBudget(&m.Budget),
+		Cost:             m.Cost,
+		CacheHit:         m.CacheHit,
+	}
+}
+
+func toPBCompletionChunk(chunk StreamChunk) *pb.CompletionChunk {
+	pbChunk := &pb.CompletionChunk{
+		Type:         chunk.Type,
+		Content:      chunk.Content,
+		Timestamp:    chunk.Timestamp.UnixNano() / 1e6, // Convert to milliseconds
+		ContextFiles: toPBContextFiles(chunk.ContextFiles),
+		Budget:       toPBPromptBudget(chunk.Budget),
+		StopReason:   chunk.StopReason,
+	}
+	if chunk.Summary != nil {
+		pbChunk.Summary = &pb.StreamSummary{
+			Model:      chunk.Summary.Model,
+			StopReason: chunk.Summary.StopReason,
+			Metrics:    toPBCompletionMetrics(chunk.Summary.Metrics),
+		}
+	}
+	return pbChunk
+}
+
+func toPBPromptBudget(b *PromptBudget) *pb.PromptBudget {
+	if b == nil {
+		return nil
+	}
+	return &pb.PromptBudget{
+		ContextWindow:   int32(b.ContextWindow),
+		ReserveTokens:   int32(b.ReserveTokens),
+		PromptBudget:    int32(b.PromptBudget),
+		PromptTokens:    int32(b.PromptTokens),
+		TrimmedMessages: int32(b.TrimmedMessages),
+	}
+}
+
+func toPBUsageSummaryRow(row UsageSummaryRow) *pb.UsageSummaryRow {
+	return &pb.UsageSummaryRow{
+		Key:              row.Key,
+		Requests:         int32(row.Requests),
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+		TotalTokens:      row.TotalTokens,
+		Cost:             row.Cost,
+		AvgLatencyMs:     row.AvgLatency.Milliseconds(),
+	}
+}
+
+func toPBUsageLimits(usage *UsageStatus) *pb.UsageLimits {
+	return &pb.UsageLimits{
+		DailyCostLimit:   usage.Limits.DailyCost,
+		MonthlyCostLimit: usage.Limits.MonthlyCost,
+		DailyCost:        usage.DailySpend,
+		MonthlyCost:      usage.MonthlySpend,
+	}
+}
+
+func toPBEditProposal(p *EditProposal) *pb.EditProposal {
+	proposal := &pb.EditProposal{
+		Id:          p.ID,
+		Explanation: p.Explanation,
+		Diff:        p.Diff(),
+	}
+	for _, e := range p.Edits {
+		proposal.Edits = append(proposal.Edits, &pb.TextEdit{
+			FilePath: e.FilePath,
+			Range: &pb.TextRange{
+				StartLine:   int32(e.Range.StartLine),
+				StartColumn: int32(e.Range.StartColumn),
+				EndLine:     int32(e.Range.EndLine),
+				EndColumn:   int32(e.Range.EndColumn),
+			},
+			NewText: e.NewText,
+		})
+	}
+	for _, c := range p.Changes {
+		proposal.Changes = append(proposal.Changes, &pb.FileChange{
+			Path:    c.Path,
+			Diff:    c.Diff,
+			Created: c.Created,
+		})
+	}
+	return proposal
+}
+
+func toPBAgentEvent(event AgentEvent) *pb.AgentEvent {
+	pbEvent := &pb.AgentEvent{
+		RunId:     event.RunID,
+		Step:      int32(event.Step),
+		Type:      event.Type,
+		Content:   event.Content,
+		Diff:      event.Diff,
+		Timestamp: event.Timestamp.Unix(),
+	}
+	if event.ToolCall != nil {
+		pbEvent.ToolCall = &pb.ToolCall{
+			Id:        event.ToolCall.ID,
+			Name:      event.ToolCall.Name,
+			Arguments: string(event.ToolCall.Arguments),
+		}
+	}
+	if event.Result != nil {
+		pbEvent.ToolResult = &pb.ToolResult{
+			CallId:  event.Result.CallID,
+			Name:    event.Result.Name,
+			Content: event.Result.Content,
+			IsError: event.Result.IsError,
+		}
+	}
+	return pbEvent
+}
+
+func toPBMemory(m *Memory) *pb.Memory {
+	return &pb.Memory{
+		Id:           m.ID,
+		MemoryKey:    m.Key,
+		MemoryType:   m.Type,
+		Project:      m.Project,
+		Content:      m.Content,
+		Metadata:     m.Metadata,
+		CreatedAt:    m.CreatedAt.Unix(),
+		LastAccessed: m.LastAccessed.Unix(),
+		AccessCount:  int32(m.AccessCount),
+		Score:        m.Score,
+	}
+}
@@ -0,0 +1,321 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"glask-ide/internal/filesystem"
+)
+
+const (
+	// maxInlinePrefix and maxInlineSuffix bound the code sent around the cursor
+	maxInlinePrefix = 6000
+	maxInlineSuffix = 2000
+
+	// maxInlineLines caps the length of a single inline suggestion
+	maxInlineLines = 30
+
+	// defaultInlineMaxTokens is the output budget for an inline suggestion
+	defaultInlineMaxTokens = 256
+
+	inlineCacheSize = 512
+	inlineCacheTTL  = 10 * time.Minute
+)
+
+// ErrSuperseded is returned when a newer inline request from the same editor session replaces an in-flight one
+var ErrSuperseded = errors.New("inline completion superseded by a newer request")
+
+// InlineCompletionRequest describes the code around the cursor for an inline suggestion
+type InlineCompletionRequest struct {
+	SessionID string // Editor session; a new request cancels the session's previous one
+	ModelID   string // Overrides the session's model
+	FilePath  string
+	Language  string
+	Prefix    string // Code before the cursor
+	Suffix    string // Code after the cursor
+	MaxTokens int
+}
+
+// InlineCompletion is the text to insert at the cursor
+type InlineCompletion struct {
+	Text    string
+	Cached  bool
+	Model   string
+	Latency time.Duration
+}
+
+// inlineCompleter tracks in-flight requests per editor session and caches recent suggestions
+type inlineCompleter struct {
+	mu       sync.Mutex
+	inflight map[string]*inlineRequest
+	cache    *lruCache[string]
+}
+
+type inlineRequest struct {
+	cancel     context.CancelFunc
+	superseded bool
+}
+
+func newInlineCompleter() *inlineCompleter {
+	return &inlineCompleter{
+		inflight: make(map[string]*inlineRequest),
+		cache:    newLRUCache[string](inlineCacheSize, inlineCacheTTL),
+	}
+}
+
+// begin registers a request for a session, cancelling whatever it replaces
+func (c *inlineCompleter) begin(ctx context.Context, sessionID string) (context.Context, *inlineRequest) {
+	ctx, cancel := context.WithCancel(ctx)
+	req := &inlineRequest{cancel: cancel}
+	if sessionID == "" {
+		return ctx, req
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.inflight[sessionID]; ok {
+		prev.superseded = true
+		prev.cancel()
+	}
+	c.inflight[sessionID] = req
+	return ctx, req
+}
+
+// end releases a request; it reports whether the request was superseded
+func (c *inlineCompleter) end(sessionID string, req *inlineRequest) bool {
+	req.cancel()
+	if sessionID == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inflight[sessionID] == req {
+		delete(c.inflight, sessionID)
+	}
+	return req.superseded
+}
+
+// CodeComplete returns a fill-in-the-middle suggestion for the cursor position
+func (s *service) CodeComplete(ctx context.Context, req InlineCompletionRequest) (*InlineCompletion, error) {
+	startTime := time.Now()
+
+	if req.Language == "" {
+		req.Language = filesystem.LanguageForPath(req.FilePath)
+	}
+	if len(req.Prefix) > maxInlinePrefix {
+		cut := len(req.Prefix) - maxInlinePrefix
+		for cut < len(req.Prefix) && !utf8.RuneStart(req.Prefix[cut]) {
+			cut++
+		}
+		req.Prefix = req.Prefix[cut:]
+	}
+	if len(req.Suffix) > maxInlineSuffix {
+		cut := maxInlineSuffix
+		for cut > 0 && !utf8.RuneStart(req.Suffix[cut]) {
+			cut--
+		}
+		req.Suffix = req.Suffix[:cut]
+	}
+
+	model, err := s.modelManager.ResolveModel(req.ModelID, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	key := inlineCacheKey(model, req)
+	if text, ok := s.inline.cache.Get(key); ok {
+		return &InlineCompletion{Text: text, Cached: true, Model: model.ID, Latency: time.Since(startTime)}, nil
+	}
+
+	ctx, inflight := s.inline.begin(ctx, req.SessionID)
+	prompt, stop := buildFIMPrompt(model.Provider, req)
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultInlineMaxTokens
+	}
+
+	resp, err := s.complete(ctx, []Message{{Role: "user", Content: prompt}}, Options{
+		Temperature:   ptr(0.2),
+		MaxTokens:     maxTokens,
+		StopSequences: stop,
+		ModelID:       model.ID, // The prompt is built for this model's provider
+		Feature:       "inline",
+	})
+	if s.inline.end(req.SessionID, inflight) {
+		return nil, ErrSuperseded
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status == "failed" {
+		return nil, fmt.Errorf("inline completion failed: %s", resp.Error)
+	}
+
+	text := truncateToBlock(extractFIMCompletion(resp.Output), req.Prefix, req.Suffix)
+	s.inline.cache.Put(key, text)
+
+	return &InlineCompletion{Text: text, Model: model.ID, Latency: time.Since(startTime)}, nil
+}
+
+// inlineCacheKey hashes everything that determines a suggestion
+func inlineCacheKey(model ModelInfo, req InlineCompletionRequest) string {
+	h := sha256.New()
+	for _, part := range []string{model.Provider, model.ID, req.Language, req.Prefix, req.Suffix} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// buildFIMPrompt builds a fill-in-the-middle prompt in the style each provider
+// follows best and returns the stop sequences that end the completion
+func buildFIMPrompt(provider string, req InlineCompletionRequest) (string, []string) {
+	switch provider {
+	case "anthropic":
+		// Claude follows XML-delimited instructions closely
+		var b strings.Builder
+		fmt.Fprintf(&b, "You are a code completion engine for %s. ", req.Language)
+		b.WriteString("Write the code that belongs at the cursor, between <prefix> and <suffix>. ")
+		b.WriteString("Complete at most one logical block (statement, block or function body). ")
+		b.WriteString("Do not repeat the prefix or suffix. Reply with only the inserted code inside <completion></completion> tags.\n\n")
+		fmt.Fprintf(&b, "<file>%s</file>\n<prefix>%s</prefix>\n<suffix>%s</suffix>\n<completion>", req.FilePath, req.Prefix, req.Suffix)
+		return b.String(), []string{"</completion>"}
+
+	default:
+		// Gemini works best with a plain-text template and an explicit cursor marker
+		var b strings.Builder
+		fmt.Fprintf(&b, "Fill in the code at <CURSOR> in this %s file (%s).\n", req.Language, req.FilePath)
+		b.WriteString("Output only the code that replaces <CURSOR>, with no explanation and no markdown fences. ")
+		b.WriteString("Complete at most one logical block and do not repeat surrounding code.\n\n")
+		b.WriteString(req.Prefix)
+		b.WriteString("<CURSOR>")
+		b.WriteString(req.Suffix)
+		return b.String(), nil
+	}
+}
+
+// extractFIMCompletion strips completion tags and markdown fences from model output
+func extractFIMCompletion(output string) string {
+	output = strings.TrimPrefix(output, "<completion>")
+	if i := strings.Index(output, "</completion>"); i >= 0 {
+		output = output[:i]
+	}
+
+	trimmed := strings.TrimSpace(output)
+	if strings.HasPrefix(trimmed, "```") {
+		if nl := strings.Index(trimmed, "\n"); nl >= 0 {
+			trimmed = trimmed[nl+1:]
+		}
+		trimmed = strings.TrimSuffix(strings.TrimRight(trimmed, "\n"), "```")
+		return strings.TrimRight(trimmed, "\n")
+	}
+
+	return output
+}
+
+// truncateToBlock cuts a completion after the first logical block and drops
+// any tail that merely repeats the code after the cursor
+func truncateToBlock(completion, prefix, suffix string) string {
+	completion = strings.TrimRight(completion, " \t\n")
+	if completion == "" {
+		return ""
+	}
+
+	currentLine := prefix[strings.LastIndex(prefix, "\n")+1:]
+	baseIndent := indentWidth(currentLine)
+
+	lines := strings.Split(completion, "\n")
+	depth := bracketDelta(lines[0])
+	kept := 1
+	for _, line := range lines[1:] {
+		if kept >= maxInlineLines {
+			break
+		}
+		if strings.TrimSpace(line) == "" {
+			if depth <= 0 {
+				break
+			}
+			kept++
+			continue
+		}
+
+		delta := bracketDelta(line)
+		if depth+delta < 0 {
+			break // Closes a block the completion did not open
+		}
+		if depth <= 0 && indentWidth(line) < baseIndent {
+			break // Dedented out of the cursor's block
+		}
+
+		kept++
+		depth += delta
+		if depth <= 0 && indentWidth(line) <= baseIndent && delta < 0 {
+			break // Closed the block it opened
+		}
+	}
+	completion = strings.Join(lines[:kept], "\n")
+
+	// Drop a final line that repeats the next line of the suffix (e.g. a
+	// closing brace) when it would close more than the completion opened
+	if kept > 1 && bracketDelta(completion) < 0 {
+		nextLine := strings.TrimSpace(strings.SplitN(strings.TrimLeft(suffix, " \t\n"), "\n", 2)[0])
+		if nextLine != "" && strings.TrimSpace(lines[kept-1]) == nextLine {
+			completion = strings.Join(lines[:kept-1], "\n")
+		}
+	}
+
+	return completion
+}
+
+// indentWidth counts leading whitespace, treating tabs as four columns
+func indentWidth(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// bracketDelta returns opened minus closed brackets in a line, ignoring string literals
+func bracketDelta(line string) int {
+	delta := 0
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == quote:
+				quote = 0
+			}
+			continue
+		}
+		switch r {
+		case '"', '\'', '`':
+			quote = r
+		case '(', '[', '{':
+			delta++
+		case ')', ']', '}':
+			delta--
+		}
+	}
+	return delta
+}
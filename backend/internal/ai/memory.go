@@ -0,0 +1,487 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"glask-ide/internal/storage"
+)
+
+var (
+	// ErrMemoryNotFound is returned when a memory ID is unknown
+	ErrMemoryNotFound = errors.New("memory not found")
+
+	// ErrInvalidMemory is returned when a memory has an unknown type or no content
+	ErrInvalidMemory = errors.New("invalid memory")
+)
+
+// Memory types
+const (
+	MemoryUserPreferences  = "user_preferences"
+	MemoryCodePatterns     = "code_patterns"
+	MemoryProjectContext   = "project_context"
+	MemoryFrequentCommands = "frequent_commands"
+)
+
+var memoryTypes = map[string]bool{
+	MemoryUserPreferences:  true,
+	MemoryCodePatterns:     true,
+	MemoryProjectContext:   true,
+	MemoryFrequentCommands: true,
+}
+
+const (
+	// maxInjectedMemories is how many memories are added to a chat or agent prompt
+	maxInjectedMemories = 5
+
+	// maxInjectedMemoryChars truncates long memories in prompts
+	maxInjectedMemoryChars = 500
+
+	// maxMemoryCandidates bounds how many memories are scored per lookup
+	maxMemoryCandidates = 1000
+
+	// embeddingTimeout bounds a call to the embedding model
+	embeddingTimeout = 3 * time.Second
+)
+
+const memorySchema = `
+CREATE TABLE IF NOT EXISTS ai_memory (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	memory_key TEXT NOT NULL,
+	memory_type TEXT NOT NULL,
+	project TEXT NOT NULL DEFAULT '',
+	content TEXT NOT NULL,
+	embedding BLOB,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_accessed DATETIME,
+	access_count INTEGER DEFAULT 0,
+	metadata TEXT
+)`
+
+const (
+	memoryKeyIndex     = `CREATE INDEX IF NOT EXISTS idx_memory_key ON ai_memory(memory_key)`
+	memoryTypeIndex    = `CREATE INDEX IF NOT EXISTS idx_memory_type ON ai_memory(memory_type)`
+	memoryProjectIndex = `CREATE INDEX IF NOT EXISTS idx_memory_project ON ai_memory(project)`
+)
+
+// Memory is a fact the assistant remembers across sessions
+type Memory struct {
+	ID           int64
+	Key          string
+	Type         string
+	Project      string // Project path the memory applies to; empty for all projects
+	Content      string
+	Metadata     string // JSON object
+	CreatedAt    time.Time
+	LastAccessed time.Time
+	AccessCount  int
+	Score        float64 // Relevance to the lookup query, when searching
+}
+
+// MemoryFilter selects memories to list or search
+type MemoryFilter struct {
+	Key     string
+	Type    string
+	Project string // Includes global memories
+	Query   string // Ranks by relevance when set
+	Limit   int
+
+	globalOnly bool // Without a project, match only global memories
+}
+
+// Embedder turns text into a vector for similarity search
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// MemoryStore persists memories in SQLite and finds the ones relevant to a query
+type MemoryStore struct {
+	db       *sql.DB
+	embedder Embedder
+}
+
+// NewMemoryStore creates a memory store, creating its table if needed. The
+// embedder is optional; without it relevance is keyword-based only.
+func NewMemoryStore(db *sql.DB, embedder Embedder) (*MemoryStore, error) {
+	if err := storage.Migrate(db, memorySchema, memoryKeyIndex, memoryTypeIndex, memoryProjectIndex); err != nil {
+		return nil, err
+	}
+	return &MemoryStore{db: db, embedder: embedder}, nil
+}
+
+// Create stores a new memory
+func (s *MemoryStore) Create(m Memory) (*Memory, error) {
+	if err := validateMemory(&m); err != nil {
+		return nil, err
+	}
+
+	m.CreatedAt = time.Now().UTC()
+	res, err := s.db.Exec(`
+		INSERT INTO ai_memory (memory_key, memory_type, project, content, embedding, created_at, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		m.Key, m.Type, m.Project, m.Content, s.embed(m.Key+"\n"+m.Content), m.CreatedAt, m.Metadata,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create memory: %w", err)
+	}
+
+	m.ID, _ = res.LastInsertId()
+	return &m, nil
+}
+
+// Update replaces the key, type, project, content and metadata of a memory
+func (s *MemoryStore) Update(m Memory) (*Memory, error) {
+	if err := validateMemory(&m); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.Exec(`
+		UPDATE ai_memory SET memory_key = ?, memory_type = ?, project = ?, content = ?, embedding = ?, metadata = ?
+		WHERE id = ?`,
+		m.Key, m.Type, m.Project, m.Content, s.embed(m.Key+"\n"+m.Content), m.Metadata, m.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update memory: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrMemoryNotFound
+	}
+
+	return s.Get(m.ID)
+}
+
+// Get returns a single memory
+func (s *MemoryStore) Get(id int64) (*Memory, error) {
+	rows, err := s.db.Query(memorySelect+` WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memory: %w", err)
+	}
+	memories, _, err := scanMemories(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(memories) == 0 {
+		return nil, ErrMemoryNotFound
+	}
+	return &memories[0], nil
+}
+
+// Delete removes a memory
+func (s *MemoryStore) Delete(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM ai_memory WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete memory: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMemoryNotFound
+	}
+	return nil
+}
+
+const memorySelect = `
+	SELECT id, memory_key, memory_type, project, content, embedding, created_at,
+		last_accessed, COALESCE(access_count, 0), COALESCE(metadata, '')
+	FROM ai_memory`
+
+// List returns memories matching the filter. With a query, results are
+// ordered by relevance and memories with no relevance are left out;
+// otherwise the most recently created come first.
+func (s *MemoryStore) List(ctx context.Context, filter MemoryFilter) ([]Memory, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.Key != "" {
+		where = append(where, "memory_key = ?")
+		args = append(args, filter.Key)
+	}
+	if filter.Type != "" {
+		where = append(where, "memory_type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Project != "" {
+		where = append(where, "(project = ? OR project = '')")
+		args = append(args, filter.Project)
+	} else if filter.globalOnly {
+		where = append(where, "project = ''")
+	}
+
+	query := memorySelect
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, maxMemoryCandidates)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memories: %w", err)
+	}
+	memories, embeddings, err := scanMemories(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Query != "" {
+		memories = s.rank(ctx, filter.Query, filter.Project, memories, embeddings)
+	}
+	if filter.Limit > 0 && len(memories) > filter.Limit {
+		memories = memories[:filter.Limit]
+	}
+	return memories, nil
+}
+
+// Relevant returns the memories of a project (and global ones) most relevant
+// to a query and records that they were used
+func (s *MemoryStore) Relevant(ctx context.Context, project, query string, limit int) ([]Memory, error) {
+	memories, err := s.List(ctx, MemoryFilter{Project: project, Query: query, Limit: limit, globalOnly: true})
+	if err != nil || len(memories) == 0 {
+		return memories, err
+	}
+
+	ids := make([]any, len(memories))
+	for i, m := range memories {
+		ids[i] = m.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE ai_memory SET last_accessed = ?, access_count = COALESCE(access_count, 0) + 1 WHERE id IN (`+placeholders+`)`,
+		append([]any{time.Now().UTC()}, ids...)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record memory access: %w", err)
+	}
+	return memories, nil
+}
+
+// rank scores memories against a query and drops the irrelevant ones. Keyword
+// matches are weighted by how rare the term is; embeddings, when available,
+// add cosine similarity. Project-specific and frequently used memories win ties.
+func (s *MemoryStore) rank(ctx context.Context, query, project string, memories []Memory, embeddings [][]float32) []Memory {
+	terms := keywords(query)
+
+	// Inverse document frequency of each query term across the candidates
+	docTerms := make([]map[string]int, len(memories))
+	df := make(map[string]int)
+	for i, m := range memories {
+		docTerms[i] = make(map[string]int)
+		for _, t := range keywords(m.Key + " " + m.Content) {
+			docTerms[i][t]++
+		}
+		for _, t := range uniqueStrings(terms) {
+			if docTerms[i][t] > 0 {
+				df[t]++
+			}
+		}
+	}
+
+	var queryVector []float32
+	for _, e := range embeddings {
+		if e != nil {
+			queryVector = s.embedVector(ctx, query)
+			break
+		}
+	}
+
+	ranked := memories[:0]
+	for i, m := range memories {
+		score := 0.0
+		for _, t := range uniqueStrings(terms) {
+			if n := docTerms[i][t]; n > 0 {
+				idf := math.Log(1 + float64(len(memories))/float64(df[t]))
+				score += idf * (1 + math.Log(float64(n)))
+			}
+		}
+		if strings.Contains(strings.ToLower(m.Key), strings.ToLower(strings.TrimSpace(query))) {
+			score += 2
+		}
+		if queryVector != nil && embeddings[i] != nil {
+			if sim := cosineSimilarity(queryVector, embeddings[i]); sim > 0.5 {
+				score += 4 * sim
+			}
+		}
+		if score == 0 {
+			continue
+		}
+
+		if project != "" && m.Project == project {
+			score *= 1.2
+		}
+		score += 0.1 * math.Log1p(float64(m.AccessCount))
+		m.Score = score
+		ranked = append(ranked, m)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	return ranked
+}
+
+// embed returns the encoded embedding of text, or nil without an embedder or on failure
+func (s *MemoryStore) embed(text string) []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingTimeout)
+	defer cancel()
+	return encodeEmbedding(s.embedVector(ctx, text))
+}
+
+func (s *MemoryStore) embedVector(ctx context.Context, text string) []float32 {
+	if s.embedder == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, embeddingTimeout)
+	defer cancel()
+
+	vector, err := s.embedder.Embed(ctx, text)
+	if err != nil {
+		// Keyword relevance still works without embeddings
+		fmt.Printf("Error embedding memory text: %v\n", err)
+		return nil
+	}
+	return vector
+}
+
+func scanMemories(rows *sql.Rows) ([]Memory, [][]float32, error) {
+	defer rows.Close()
+
+	var (
+		memories   []Memory
+		embeddings [][]float32
+	)
+	for rows.Next() {
+		var (
+			m            Memory
+			embedding    []byte
+			lastAccessed sql.NullTime
+		)
+		if err := rows.Scan(&m.ID, &m.Key, &m.Type, &m.Project, &m.Content, &embedding,
+			&m.CreatedAt, &lastAccessed, &m.AccessCount, &m.Metadata); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan memory: %w", err)
+		}
+		m.LastAccessed = m.CreatedAt
+		if lastAccessed.Valid {
+			m.LastAccessed = lastAccessed.Time
+		}
+		memories = append(memories, m)
+		embeddings = append(embeddings, decodeEmbedding(embedding))
+	}
+	return memories, embeddings, rows.Err()
+}
+
+func validateMemory(m *Memory) error {
+	if !memoryTypes[m.Type] {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidMemory, m.Type)
+	}
+	if strings.TrimSpace(m.Content) == "" {
+		return fmt.Errorf("%w: content is required", ErrInvalidMemory)
+	}
+	if m.Key == "" {
+		m.Key = m.Type
+	}
+	if m.Metadata != "" && !json.Valid([]byte(m.Metadata)) {
+		return fmt.Errorf("%w: metadata is not valid JSON", ErrInvalidMemory)
+	}
+	return nil
+}
+
+// memoryStopWords are ignored when matching memories by keyword
+var memoryStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "this": true, "that": true,
+	"from": true, "are": true, "was": true, "you": true, "how": true, "what": true,
+	"can": true, "use": true, "not": true, "but": true, "have": true, "should": true,
+}
+
+// keywords splits text into lowercase words of three or more letters, without stop words
+func keywords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	words := fields[:0]
+	for _, f := range fields {
+		if len(f) >= 3 && !memoryStopWords[f] {
+			words = append(words, f)
+		}
+	}
+	return words
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+func encodeEmbedding(vector []float32) []byte {
+	if len(vector) == 0 {
+		return nil
+	}
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeEmbedding(buf []byte) []float32 {
+	if len(buf) == 0 || len(buf)%4 != 0 {
+		return nil
+	}
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vector
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// memoryPrompt formats memories for inclusion in a prompt
+func memoryPrompt(memories []Memory) string {
+	if len(memories) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Things to remember about this user and project:\n")
+	for _, m := range memories {
+		content := m.Content
+		if len(content) > maxInjectedMemoryChars {
+			cut := maxInjectedMemoryChars
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			content = content[:cut] + "..."
+		}
+		fmt.Fprintf(&b, "- [%s] %s: %s\n", m.Type, m.Key, content)
+	}
+	return b.String()
+}
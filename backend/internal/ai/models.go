@@ -1,6 +1,14 @@
 package ai
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrModelNotFound is returned when a request names an unknown model
+var ErrModelNotFound = errors.New("model not found")
 
 // ModelInfo represents information about an AI model
 type ModelInfo struct {
@@ -12,11 +20,16 @@ type ModelInfo struct {
 	Description  string   `json:"description"`
 }
 
-// ModelManager handles model selection and configuration
+// ModelManager handles model selection and configuration. The active model
+// is the default for every client; a session, such as an editor tab or a
+// conversation, can select its own model without affecting the others.
 type ModelManager struct {
-	models       map[string]ModelInfo
-	activeModel  string
+	models       map[string]ModelInfo // Not modified after creation
 	defaultModel string
+
+	mu          sync.RWMutex
+	activeModel string
+	sessions    map[string]string // Session ID -> model ID
 }
 
 // NewModelManager creates a new model manager with default configurations
@@ -55,6 +68,7 @@ func NewModelManager() *ModelManager {
 		models:       models,
 		activeModel:  "claude-3-haiku-20240307", // Default to Claude
 		defaultModel: "claude-3-haiku-20240307",
+		sessions:     make(map[string]string),
 	}
 }
 
@@ -67,30 +81,124 @@ func (m *ModelManager) GetModels() []ModelInfo {
 	return models
 }
 
-// GetActiveModel returns the currently active model
+// GetActiveModel returns the model used by sessions that have not selected one
 func (m *ModelManager) GetActiveModel() ModelInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.models[m.activeModel]
 }
 
-// SetActiveModel changes the active model
+// GetModel returns a model by ID
+func (m *ModelManager) GetModel(modelID string) (ModelInfo, bool) {
+	model, ok := m.models[modelID]
+	return model, ok
+}
+
+// SetActiveModel changes the model used by sessions that have not selected one
 func (m *ModelManager) SetActiveModel(modelID string) error {
 	if _, exists := m.models[modelID]; !exists {
-		return fmt.Errorf("model %s not found", modelID)
+		return fmt.Errorf("%w: %s", ErrModelNotFound, modelID)
 	}
+	m.mu.Lock()
 	m.activeModel = modelID
+	m.mu.Unlock()
+	return nil
+}
+
+// GetSessionModel returns the model selected by a session, or the active
+// model when the session has not selected one
+func (m *ModelManager) GetSessionModel(sessionID string) ModelInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if modelID, ok := m.sessions[sessionID]; ok && sessionID != "" {
+		return m.models[modelID]
+	}
+	return m.models[m.activeModel]
+}
+
+// SetSessionModel selects a session's model. An empty model ID clears the
+// selection so the session follows the active model again.
+func (m *ModelManager) SetSessionModel(sessionID, modelID string) error {
+	if sessionID == "" {
+		return m.SetActiveModel(modelID)
+	}
+	if modelID == "" {
+		m.ClearSession(sessionID)
+		return nil
+	}
+	if _, exists := m.models[modelID]; !exists {
+		return fmt.Errorf("%w: %s", ErrModelNotFound, modelID)
+	}
+	m.mu.Lock()
+	m.sessions[sessionID] = modelID
+	m.mu.Unlock()
 	return nil
 }
 
-// GetModelByCapability returns the best model for a given capability
-func (m *ModelManager) GetModelByCapability(capability string) ModelInfo {
+// ClearSession forgets a session's model selection
+func (m *ModelManager) ClearSession(sessionID string) {
+	m.mu.Lock()
+	delete(m.sessions, sessionID)
+	m.mu.Unlock()
+}
+
+// ResolveModel picks the model for a request: an explicit model ID, then the
+// session's selection, then the active model
+func (m *ModelManager) ResolveModel(modelID, sessionID string) (ModelInfo, error) {
+	if modelID != "" {
+		model, ok := m.GetModel(modelID)
+		if !ok {
+			return ModelInfo{}, fmt.Errorf("%w: %s", ErrModelNotFound, modelID)
+		}
+		return model, nil
+	}
+	return m.GetSessionModel(sessionID), nil
+}
+
+// GetModelByCapability returns the best model for a given capability,
+// skipping excluded models. The zero ModelInfo is returned when every
+// candidate is excluded.
+func (m *ModelManager) GetModelByCapability(capability string, exclude ...string) ModelInfo {
+	excluded := make(map[string]bool, len(exclude))
+	for _, id := range exclude {
+		excluded[id] = true
+	}
+
 	// First try active model
-	activeModel := m.models[m.activeModel]
-	for _, cap := range activeModel.Capabilities {
-		if cap == capability {
-			return activeModel
+	activeModel := m.GetActiveModel()
+	if activeModel.hasCapability(capability) && !excluded[activeModel.ID] {
+		return activeModel
+	}
+
+	// Then the default model, then any other capable model in a stable order
+	defaultModel := m.models[m.defaultModel]
+	if defaultModel.hasCapability(capability) && !excluded[defaultModel.ID] {
+		return defaultModel
+	}
+	ids := make([]string, 0, len(m.models))
+	for id := range m.models {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if model := m.models[id]; model.hasCapability(capability) && !excluded[id] {
+			return model
 		}
 	}
 
 	// Fall back to default model
-	return m.models[m.defaultModel]
+	if excluded[defaultModel.ID] {
+		return ModelInfo{}
+	}
+	return defaultModel
+}
+
+// hasCapability reports whether the model lists a capability
+func (mi ModelInfo) hasCapability(capability string) bool {
+	for _, c := range mi.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
 }
@@ -19,10 +19,37 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	AIService_Complete_FullMethodName       = "/ai.AIService/Complete"
-	AIService_StreamComplete_FullMethodName = "/ai.AIService/StreamComplete"
-	AIService_GetModels_FullMethodName      = "/ai.AIService/GetModels"
-	AIService_SetActiveModel_FullMethodName = "/ai.AIService/SetActiveModel"
+	AIService_Complete_FullMethodName            = "/ai.AIService/Complete"
+	AIService_StreamComplete_FullMethodName      = "/ai.AIService/StreamComplete"
+	AIService_GetModels_FullMethodName           = "/ai.AIService/GetModels"
+	AIService_SetActiveModel_FullMethodName      = "/ai.AIService/SetActiveModel"
+	AIService_CreateConversation_FullMethodName  = "/ai.AIService/CreateConversation"
+	AIService_ListConversations_FullMethodName   = "/ai.AIService/ListConversations"
+	AIService_GetConversation_FullMethodName     = "/ai.AIService/GetConversation"
+	AIService_DeleteConversation_FullMethodName  = "/ai.AIService/DeleteConversation"
+	AIService_AppendMessage_FullMethodName       = "/ai.AIService/AppendMessage"
+	AIService_Chat_FullMethodName                = "/ai.AIService/Chat"
+	AIService_BuildContext_FullMethodName        = "/ai.AIService/BuildContext"
+	AIService_CodeComplete_FullMethodName        = "/ai.AIService/CodeComplete"
+	AIService_Generate_FullMethodName            = "/ai.AIService/Generate"
+	AIService_Refactor_FullMethodName            = "/ai.AIService/Refactor"
+	AIService_Analyze_FullMethodName             = "/ai.AIService/Analyze"
+	AIService_AnalyzeTerminal_FullMethodName     = "/ai.AIService/AnalyzeTerminal"
+	AIService_GenerateDocs_FullMethodName        = "/ai.AIService/GenerateDocs"
+	AIService_ApplyEdits_FullMethodName          = "/ai.AIService/ApplyEdits"
+	AIService_UndoEdits_FullMethodName           = "/ai.AIService/UndoEdits"
+	AIService_RunAgent_FullMethodName            = "/ai.AIService/RunAgent"
+	AIService_CancelAgent_FullMethodName         = "/ai.AIService/CancelAgent"
+	AIService_ApproveAgentAction_FullMethodName  = "/ai.AIService/ApproveAgentAction"
+	AIService_CreateMemory_FullMethodName        = "/ai.AIService/CreateMemory"
+	AIService_UpdateMemory_FullMethodName        = "/ai.AIService/UpdateMemory"
+	AIService_DeleteMemory_FullMethodName        = "/ai.AIService/DeleteMemory"
+	AIService_ListMemories_FullMethodName        = "/ai.AIService/ListMemories"
+	AIService_CountTokens_FullMethodName         = "/ai.AIService/CountTokens"
+	AIService_GetUsageSummary_FullMethodName     = "/ai.AIService/GetUsageSummary"
+	AIService_GetUsageLimits_FullMethodName      = "/ai.AIService/GetUsageLimits"
+	AIService_SetUsageLimits_FullMethodName      = "/ai.AIService/SetUsageLimits"
+	AIService_ListPromptTemplates_FullMethodName = "/ai.AIService/ListPromptTemplates"
 )
 
 // AIServiceClient is the client API for AIService service.
@@ -37,6 +64,46 @@ type AIServiceClient interface {
 	GetModels(ctx context.Context, in *GetModelsRequest, opts ...grpc.CallOption) (*GetModelsResponse, error)
 	// SetActiveModel changes the current model
 	SetActiveModel(ctx context.Context, in *SetActiveModelRequest, opts ...grpc.CallOption) (*SetActiveModelResponse, error)
+	// Conversation management
+	CreateConversation(ctx context.Context, in *CreateConversationRequest, opts ...grpc.CallOption) (*Conversation, error)
+	ListConversations(ctx context.Context, in *ListConversationsRequest, opts ...grpc.CallOption) (*ListConversationsResponse, error)
+	GetConversation(ctx context.Context, in *GetConversationRequest, opts ...grpc.CallOption) (*GetConversationResponse, error)
+	DeleteConversation(ctx context.Context, in *DeleteConversationRequest, opts ...grpc.CallOption) (*DeleteConversationResponse, error)
+	AppendMessage(ctx context.Context, in *AppendMessageRequest, opts ...grpc.CallOption) (*ConversationMessage, error)
+	// Chat sends a message in a conversation and streams the reply
+	Chat(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CompletionChunk], error)
+	// BuildContext previews the workspace context assembled for an editor position
+	BuildContext(ctx context.Context, in *BuildContextRequest, opts ...grpc.CallOption) (*BuildContextResponse, error)
+	// CodeComplete returns an inline fill-in-the-middle suggestion
+	CodeComplete(ctx context.Context, in *CodeCompleteRequest, opts ...grpc.CallOption) (*CodeCompleteResponse, error)
+	// Code generation operations return edit proposals previewable as diffs
+	Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*EditProposal, error)
+	Refactor(ctx context.Context, in *RefactorRequest, opts ...grpc.CallOption) (*EditProposal, error)
+	Analyze(ctx context.Context, in *AnalyzeRequest, opts ...grpc.CallOption) (*AnalyzeResponse, error)
+	// AnalyzeTerminal diagnoses the errors in terminal output and proposes fixes
+	AnalyzeTerminal(ctx context.Context, in *AnalyzeTerminalRequest, opts ...grpc.CallOption) (*AnalyzeTerminalResponse, error)
+	// GenerateDocs writes doc comments for a symbol, file or package as insert edits
+	GenerateDocs(ctx context.Context, in *GenerateDocsRequest, opts ...grpc.CallOption) (*GenerateDocsResponse, error)
+	// ApplyEdits writes a proposal as one undoable step; UndoEdits reverts it
+	ApplyEdits(ctx context.Context, in *ApplyEditsRequest, opts ...grpc.CallOption) (*ApplyEditsResponse, error)
+	UndoEdits(ctx context.Context, in *UndoEditsRequest, opts ...grpc.CallOption) (*UndoEditsResponse, error)
+	// RunAgent works on a task with workspace tools and streams each step
+	RunAgent(ctx context.Context, in *AgentRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AgentEvent], error)
+	CancelAgent(ctx context.Context, in *CancelAgentRequest, opts ...grpc.CallOption) (*CancelAgentResponse, error)
+	ApproveAgentAction(ctx context.Context, in *ApproveAgentActionRequest, opts ...grpc.CallOption) (*ApproveAgentActionResponse, error)
+	// Memory operations
+	CreateMemory(ctx context.Context, in *CreateMemoryRequest, opts ...grpc.CallOption) (*Memory, error)
+	UpdateMemory(ctx context.Context, in *UpdateMemoryRequest, opts ...grpc.CallOption) (*Memory, error)
+	DeleteMemory(ctx context.Context, in *DeleteMemoryRequest, opts ...grpc.CallOption) (*DeleteMemoryResponse, error)
+	ListMemories(ctx context.Context, in *ListMemoriesRequest, opts ...grpc.CallOption) (*ListMemoriesResponse, error)
+	// CountTokens measures a prompt against a model's context window
+	CountTokens(ctx context.Context, in *CountTokensRequest, opts ...grpc.CallOption) (*CountTokensResponse, error)
+	// Usage accounting and spend limits
+	GetUsageSummary(ctx context.Context, in *UsageSummaryRequest, opts ...grpc.CallOption) (*UsageSummaryResponse, error)
+	GetUsageLimits(ctx context.Context, in *GetUsageLimitsRequest, opts ...grpc.CallOption) (*UsageLimits, error)
+	SetUsageLimits(ctx context.Context, in *SetUsageLimitsRequest, opts ...grpc.CallOption) (*UsageLimits, error)
+	// ListPromptTemplates returns the prompt templates selectable for a project
+	ListPromptTemplates(ctx context.Context, in *ListPromptTemplatesRequest, opts ...grpc.CallOption) (*ListPromptTemplatesResponse, error)
 }
 
 type aIServiceClient struct {
@@ -96,6 +163,294 @@ func (c *aIServiceClient) SetActiveModel(ctx context.Context, in *SetActiveModel
 	return out, nil
 }
 
+func (c *aIServiceClient) CreateConversation(ctx context.Context, in *CreateConversationRequest, opts ...grpc.CallOption) (*Conversation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Conversation)
+	err := c.cc.Invoke(ctx, AIService_CreateConversation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) ListConversations(ctx context.Context, in *ListConversationsRequest, opts ...grpc.CallOption) (*ListConversationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConversationsResponse)
+	err := c.cc.Invoke(ctx, AIService_ListConversations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) GetConversation(ctx context.Context, in *GetConversationRequest, opts ...grpc.CallOption) (*GetConversationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetConversationResponse)
+	err := c.cc.Invoke(ctx, AIService_GetConversation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) DeleteConversation(ctx context.Context, in *DeleteConversationRequest, opts ...grpc.CallOption) (*DeleteConversationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteConversationResponse)
+	err := c.cc.Invoke(ctx, AIService_DeleteConversation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) AppendMessage(ctx context.Context, in *AppendMessageRequest, opts ...grpc.CallOption) (*ConversationMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConversationMessage)
+	err := c.cc.Invoke(ctx, AIService_AppendMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) Chat(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CompletionChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AIService_ServiceDesc.Streams[1], AIService_Chat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ChatRequest, CompletionChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AIService_ChatClient = grpc.ServerStreamingClient[CompletionChunk]
+
+func (c *aIServiceClient) BuildContext(ctx context.Context, in *BuildContextRequest, opts ...grpc.CallOption) (*BuildContextResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BuildContextResponse)
+	err := c.cc.Invoke(ctx, AIService_BuildContext_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) CodeComplete(ctx context.Context, in *CodeCompleteRequest, opts ...grpc.CallOption) (*CodeCompleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CodeCompleteResponse)
+	err := c.cc.Invoke(ctx, AIService_CodeComplete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*EditProposal, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EditProposal)
+	err := c.cc.Invoke(ctx, AIService_Generate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) Refactor(ctx context.Context, in *RefactorRequest, opts ...grpc.CallOption) (*EditProposal, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EditProposal)
+	err := c.cc.Invoke(ctx, AIService_Refactor_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) Analyze(ctx context.Context, in *AnalyzeRequest, opts ...grpc.CallOption) (*AnalyzeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AnalyzeResponse)
+	err := c.cc.Invoke(ctx, AIService_Analyze_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) AnalyzeTerminal(ctx context.Context, in *AnalyzeTerminalRequest, opts ...grpc.CallOption) (*AnalyzeTerminalResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AnalyzeTerminalResponse)
+	err := c.cc.Invoke(ctx, AIService_AnalyzeTerminal_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) GenerateDocs(ctx context.Context, in *GenerateDocsRequest, opts ...grpc.CallOption) (*GenerateDocsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenerateDocsResponse)
+	err := c.cc.Invoke(ctx, AIService_GenerateDocs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) ApplyEdits(ctx context.Context, in *ApplyEditsRequest, opts ...grpc.CallOption) (*ApplyEditsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ApplyEditsResponse)
+	err := c.cc.Invoke(ctx, AIService_ApplyEdits_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) UndoEdits(ctx context.Context, in *UndoEditsRequest, opts ...grpc.CallOption) (*UndoEditsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UndoEditsResponse)
+	err := c.cc.Invoke(ctx, AIService_UndoEdits_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) RunAgent(ctx context.Context, in *AgentRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AgentEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AIService_ServiceDesc.Streams[2], AIService_RunAgent_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AgentRequest, AgentEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AIService_RunAgentClient = grpc.ServerStreamingClient[AgentEvent]
+
+func (c *aIServiceClient) CancelAgent(ctx context.Context, in *CancelAgentRequest, opts ...grpc.CallOption) (*CancelAgentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelAgentResponse)
+	err := c.cc.Invoke(ctx, AIService_CancelAgent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) ApproveAgentAction(ctx context.Context, in *ApproveAgentActionRequest, opts ...grpc.CallOption) (*ApproveAgentActionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ApproveAgentActionResponse)
+	err := c.cc.Invoke(ctx, AIService_ApproveAgentAction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) CreateMemory(ctx context.Context, in *CreateMemoryRequest, opts ...grpc.CallOption) (*Memory, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Memory)
+	err := c.cc.Invoke(ctx, AIService_CreateMemory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) UpdateMemory(ctx context.Context, in *UpdateMemoryRequest, opts ...grpc.CallOption) (*Memory, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Memory)
+	err := c.cc.Invoke(ctx, AIService_UpdateMemory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) DeleteMemory(ctx context.Context, in *DeleteMemoryRequest, opts ...grpc.CallOption) (*DeleteMemoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteMemoryResponse)
+	err := c.cc.Invoke(ctx, AIService_DeleteMemory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) ListMemories(ctx context.Context, in *ListMemoriesRequest, opts ...grpc.CallOption) (*ListMemoriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMemoriesResponse)
+	err := c.cc.Invoke(ctx, AIService_ListMemories_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) CountTokens(ctx context.Context, in *CountTokensRequest, opts ...grpc.CallOption) (*CountTokensResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CountTokensResponse)
+	err := c.cc.Invoke(ctx, AIService_CountTokens_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) GetUsageSummary(ctx context.Context, in *UsageSummaryRequest, opts ...grpc.CallOption) (*UsageSummaryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UsageSummaryResponse)
+	err := c.cc.Invoke(ctx, AIService_GetUsageSummary_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) GetUsageLimits(ctx context.Context, in *GetUsageLimitsRequest, opts ...grpc.CallOption) (*UsageLimits, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UsageLimits)
+	err := c.cc.Invoke(ctx, AIService_GetUsageLimits_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) SetUsageLimits(ctx context.Context, in *SetUsageLimitsRequest, opts ...grpc.CallOption) (*UsageLimits, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UsageLimits)
+	err := c.cc.Invoke(ctx, AIService_SetUsageLimits_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aIServiceClient) ListPromptTemplates(ctx context.Context, in *ListPromptTemplatesRequest, opts ...grpc.CallOption) (*ListPromptTemplatesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPromptTemplatesResponse)
+	err := c.cc.Invoke(ctx, AIService_ListPromptTemplates_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AIServiceServer is the server API for AIService service.
 // All implementations must embed UnimplementedAIServiceServer
 // for forward compatibility.
@@ -108,6 +463,46 @@ type AIServiceServer interface {
 	GetModels(context.Context, *GetModelsRequest) (*GetModelsResponse, error)
 	// SetActiveModel changes the current model
 	SetActiveModel(context.Context, *SetActiveModelRequest) (*SetActiveModelResponse, error)
+	// Conversation management
+	CreateConversation(context.Context, *CreateConversationRequest) (*Conversation, error)
+	ListConversations(context.Context, *ListConversationsRequest) (*ListConversationsResponse, error)
+	GetConversation(context.Context, *GetConversationRequest) (*GetConversationResponse, error)
+	DeleteConversation(context.Context, *DeleteConversationRequest) (*DeleteConversationResponse, error)
+	AppendMessage(context.Context, *AppendMessageRequest) (*ConversationMessage, error)
+	// Chat sends a message in a conversation and streams the reply
+	Chat(*ChatRequest, grpc.ServerStreamingServer[CompletionChunk]) error
+	// BuildContext previews the workspace context assembled for an editor position
+	BuildContext(context.Context, *BuildContextRequest) (*BuildContextResponse, error)
+	// CodeComplete returns an inline fill-in-the-middle suggestion
+	CodeComplete(context.Context, *CodeCompleteRequest) (*CodeCompleteResponse, error)
+	// Code generation operations return edit proposals previewable as diffs
+	Generate(context.Context, *GenerateRequest) (*EditProposal, error)
+	Refactor(context.Context, *RefactorRequest) (*EditProposal, error)
+	Analyze(context.Context, *AnalyzeRequest) (*AnalyzeResponse, error)
+	// AnalyzeTerminal diagnoses the errors in terminal output and proposes fixes
+	AnalyzeTerminal(context.Context, *AnalyzeTerminalRequest) (*AnalyzeTerminalResponse, error)
+	// GenerateDocs writes doc comments for a symbol, file or package as insert edits
+	GenerateDocs(context.Context, *GenerateDocsRequest) (*GenerateDocsResponse, error)
+	// ApplyEdits writes a proposal as one undoable step; UndoEdits reverts it
+	ApplyEdits(context.Context, *ApplyEditsRequest) (*ApplyEditsResponse, error)
+	UndoEdits(context.Context, *UndoEditsRequest) (*UndoEditsResponse, error)
+	// RunAgent works on a task with workspace tools and streams each step
+	RunAgent(*AgentRequest, grpc.ServerStreamingServer[AgentEvent]) error
+	CancelAgent(context.Context, *CancelAgentRequest) (*CancelAgentResponse, error)
+	ApproveAgentAction(context.Context, *ApproveAgentActionRequest) (*ApproveAgentActionResponse, error)
+	// Memory operations
+	CreateMemory(context.Context, *CreateMemoryRequest) (*Memory, error)
+	UpdateMemory(context.Context, *UpdateMemoryRequest) (*Memory, error)
+	DeleteMemory(context.Context, *DeleteMemoryRequest) (*DeleteMemoryResponse, error)
+	ListMemories(context.Context, *ListMemoriesRequest) (*ListMemoriesResponse, error)
+	// CountTokens measures a prompt against a model's context window
+	CountTokens(context.Context, *CountTokensRequest) (*CountTokensResponse, error)
+	// Usage accounting and spend limits
+	GetUsageSummary(context.Context, *UsageSummaryRequest) (*UsageSummaryResponse, error)
+	GetUsageLimits(context.Context, *GetUsageLimitsRequest) (*UsageLimits, error)
+	SetUsageLimits(context.Context, *SetUsageLimitsRequest) (*UsageLimits, error)
+	// ListPromptTemplates returns the prompt templates selectable for a project
+	ListPromptTemplates(context.Context, *ListPromptTemplatesRequest) (*ListPromptTemplatesResponse, error)
 	mustEmbedUnimplementedAIServiceServer()
 }
 
@@ -130,6 +525,87 @@ func (UnimplementedAIServiceServer) GetModels(context.Context, *GetModelsRequest
 func (UnimplementedAIServiceServer) SetActiveModel(context.Context, *SetActiveModelRequest) (*SetActiveModelResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetActiveModel not implemented")
 }
+func (UnimplementedAIServiceServer) CreateConversation(context.Context, *CreateConversationRequest) (*Conversation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateConversation not implemented")
+}
+func (UnimplementedAIServiceServer) ListConversations(context.Context, *ListConversationsRequest) (*ListConversationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConversations not implemented")
+}
+func (UnimplementedAIServiceServer) GetConversation(context.Context, *GetConversationRequest) (*GetConversationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConversation not implemented")
+}
+func (UnimplementedAIServiceServer) DeleteConversation(context.Context, *DeleteConversationRequest) (*DeleteConversationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteConversation not implemented")
+}
+func (UnimplementedAIServiceServer) AppendMessage(context.Context, *AppendMessageRequest) (*ConversationMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendMessage not implemented")
+}
+func (UnimplementedAIServiceServer) Chat(*ChatRequest, grpc.ServerStreamingServer[CompletionChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedAIServiceServer) BuildContext(context.Context, *BuildContextRequest) (*BuildContextResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BuildContext not implemented")
+}
+func (UnimplementedAIServiceServer) CodeComplete(context.Context, *CodeCompleteRequest) (*CodeCompleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CodeComplete not implemented")
+}
+func (UnimplementedAIServiceServer) Generate(context.Context, *GenerateRequest) (*EditProposal, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Generate not implemented")
+}
+func (UnimplementedAIServiceServer) Refactor(context.Context, *RefactorRequest) (*EditProposal, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refactor not implemented")
+}
+func (UnimplementedAIServiceServer) Analyze(context.Context, *AnalyzeRequest) (*AnalyzeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Analyze not implemented")
+}
+func (UnimplementedAIServiceServer) AnalyzeTerminal(context.Context, *AnalyzeTerminalRequest) (*AnalyzeTerminalResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AnalyzeTerminal not implemented")
+}
+func (UnimplementedAIServiceServer) GenerateDocs(context.Context, *GenerateDocsRequest) (*GenerateDocsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GenerateDocs not implemented")
+}
+func (UnimplementedAIServiceServer) ApplyEdits(context.Context, *ApplyEditsRequest) (*ApplyEditsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApplyEdits not implemented")
+}
+func (UnimplementedAIServiceServer) UndoEdits(context.Context, *UndoEditsRequest) (*UndoEditsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UndoEdits not implemented")
+}
+func (UnimplementedAIServiceServer) RunAgent(*AgentRequest, grpc.ServerStreamingServer[AgentEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method RunAgent not implemented")
+}
+func (UnimplementedAIServiceServer) CancelAgent(context.Context, *CancelAgentRequest) (*CancelAgentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelAgent not implemented")
+}
+func (UnimplementedAIServiceServer) ApproveAgentAction(context.Context, *ApproveAgentActionRequest) (*ApproveAgentActionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApproveAgentAction not implemented")
+}
+func (UnimplementedAIServiceServer) CreateMemory(context.Context, *CreateMemoryRequest) (*Memory, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateMemory not implemented")
+}
+func (UnimplementedAIServiceServer) UpdateMemory(context.Context, *UpdateMemoryRequest) (*Memory, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateMemory not implemented")
+}
+func (UnimplementedAIServiceServer) DeleteMemory(context.Context, *DeleteMemoryRequest) (*DeleteMemoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMemory not implemented")
+}
+func (UnimplementedAIServiceServer) ListMemories(context.Context, *ListMemoriesRequest) (*ListMemoriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMemories not implemented")
+}
+func (UnimplementedAIServiceServer) CountTokens(context.Context, *CountTokensRequest) (*CountTokensResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CountTokens not implemented")
+}
+func (UnimplementedAIServiceServer) GetUsageSummary(context.Context, *UsageSummaryRequest) (*UsageSummaryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsageSummary not implemented")
+}
+func (UnimplementedAIServiceServer) GetUsageLimits(context.Context, *GetUsageLimitsRequest) (*UsageLimits, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsageLimits not implemented")
+}
+func (UnimplementedAIServiceServer) SetUsageLimits(context.Context, *SetUsageLimitsRequest) (*UsageLimits, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUsageLimits not implemented")
+}
+func (UnimplementedAIServiceServer) ListPromptTemplates(context.Context, *ListPromptTemplatesRequest) (*ListPromptTemplatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPromptTemplates not implemented")
+}
 func (UnimplementedAIServiceServer) mustEmbedUnimplementedAIServiceServer() {}
 func (UnimplementedAIServiceServer) testEmbeddedByValue()                   {}
 
@@ -216,30 +692,612 @@ func _AIService_SetActiveModel_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
-// AIService_ServiceDesc is the grpc.ServiceDesc for AIService service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var AIService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "ai.AIService",
-	HandlerType: (*AIServiceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Complete",
-			Handler:    _AIService_Complete_Handler,
-		},
-		{
-			MethodName: "GetModels",
-			Handler:    _AIService_GetModels_Handler,
-		},
-		{
-			MethodName: "SetActiveModel",
-			Handler:    _AIService_SetActiveModel_Handler,
-		},
-	},
-	Streams: []grpc.StreamDesc{
-		{
-			StreamName:    "StreamComplete",
-			Handler:       _AIService_StreamComplete_Handler,
+func _AIService_CreateConversation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateConversationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).CreateConversation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_CreateConversation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).CreateConversation(ctx, req.(*CreateConversationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_ListConversations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConversationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).ListConversations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_ListConversations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).ListConversations(ctx, req.(*ListConversationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_GetConversation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConversationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).GetConversation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_GetConversation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).GetConversation(ctx, req.(*GetConversationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_DeleteConversation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteConversationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).DeleteConversation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_DeleteConversation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).DeleteConversation(ctx, req.(*DeleteConversationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_AppendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).AppendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_AppendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).AppendMessage(ctx, req.(*AppendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChatRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AIServiceServer).Chat(m, &grpc.GenericServerStream[ChatRequest, CompletionChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AIService_ChatServer = grpc.ServerStreamingServer[CompletionChunk]
+
+func _AIService_BuildContext_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BuildContextRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).BuildContext(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_BuildContext_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).BuildContext(ctx, req.(*BuildContextRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_CodeComplete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CodeCompleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).CodeComplete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_CodeComplete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).CodeComplete(ctx, req.(*CodeCompleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_Generate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).Generate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_Generate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).Generate(ctx, req.(*GenerateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_Refactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefactorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).Refactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_Refactor_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).Refactor(ctx, req.(*RefactorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_Analyze_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnalyzeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).Analyze(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_Analyze_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).Analyze(ctx, req.(*AnalyzeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_AnalyzeTerminal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnalyzeTerminalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).AnalyzeTerminal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_AnalyzeTerminal_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).AnalyzeTerminal(ctx, req.(*AnalyzeTerminalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_GenerateDocs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateDocsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).GenerateDocs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_GenerateDocs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).GenerateDocs(ctx, req.(*GenerateDocsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_ApplyEdits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApplyEditsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).ApplyEdits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_ApplyEdits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).ApplyEdits(ctx, req.(*ApplyEditsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_UndoEdits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndoEditsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).UndoEdits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_UndoEdits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).UndoEdits(ctx, req.(*UndoEditsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_RunAgent_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AgentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AIServiceServer).RunAgent(m, &grpc.GenericServerStream[AgentRequest, AgentEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AIService_RunAgentServer = grpc.ServerStreamingServer[AgentEvent]
+
+func _AIService_CancelAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelAgentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).CancelAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_CancelAgent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).CancelAgent(ctx, req.(*CancelAgentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_ApproveAgentAction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApproveAgentActionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).ApproveAgentAction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_ApproveAgentAction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).ApproveAgentAction(ctx, req.(*ApproveAgentActionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_CreateMemory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateMemoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).CreateMemory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_CreateMemory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).CreateMemory(ctx, req.(*CreateMemoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_UpdateMemory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateMemoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).UpdateMemory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_UpdateMemory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).UpdateMemory(ctx, req.(*UpdateMemoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_DeleteMemory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMemoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).DeleteMemory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_DeleteMemory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).DeleteMemory(ctx, req.(*DeleteMemoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_ListMemories_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMemoriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).ListMemories(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_ListMemories_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).ListMemories(ctx, req.(*ListMemoriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_CountTokens_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountTokensRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).CountTokens(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_CountTokens_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).CountTokens(ctx, req.(*CountTokensRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_GetUsageSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UsageSummaryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).GetUsageSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_GetUsageSummary_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).GetUsageSummary(ctx, req.(*UsageSummaryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_GetUsageLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUsageLimitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).GetUsageLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_GetUsageLimits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).GetUsageLimits(ctx, req.(*GetUsageLimitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_SetUsageLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetUsageLimitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).SetUsageLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_SetUsageLimits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).SetUsageLimits(ctx, req.(*SetUsageLimitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AIService_ListPromptTemplates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPromptTemplatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AIServiceServer).ListPromptTemplates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AIService_ListPromptTemplates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AIServiceServer).ListPromptTemplates(ctx, req.(*ListPromptTemplatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AIService_ServiceDesc is the grpc.ServiceDesc for AIService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AIService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ai.AIService",
+	HandlerType: (*AIServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Complete",
+			Handler:    _AIService_Complete_Handler,
+		},
+		{
+			MethodName: "GetModels",
+			Handler:    _AIService_GetModels_Handler,
+		},
+		{
+			MethodName: "SetActiveModel",
+			Handler:    _AIService_SetActiveModel_Handler,
+		},
+		{
+			MethodName: "CreateConversation",
+			Handler:    _AIService_CreateConversation_Handler,
+		},
+		{
+			MethodName: "ListConversations",
+			Handler:    _AIService_ListConversations_Handler,
+		},
+		{
+			MethodName: "GetConversation",
+			Handler:    _AIService_GetConversation_Handler,
+		},
+		{
+			MethodName: "DeleteConversation",
+			Handler:    _AIService_DeleteConversation_Handler,
+		},
+		{
+			MethodName: "AppendMessage",
+			Handler:    _AIService_AppendMessage_Handler,
+		},
+		{
+			MethodName: "BuildContext",
+			Handler:    _AIService_BuildContext_Handler,
+		},
+		{
+			MethodName: "CodeComplete",
+			Handler:    _AIService_CodeComplete_Handler,
+		},
+		{
+			MethodName: "Generate",
+			Handler:    _AIService_Generate_Handler,
+		},
+		{
+			MethodName: "Refactor",
+			Handler:    _AIService_Refactor_Handler,
+		},
+		{
+			MethodName: "Analyze",
+			Handler:    _AIService_Analyze_Handler,
+		},
+		{
+			MethodName: "AnalyzeTerminal",
+			Handler:    _AIService_AnalyzeTerminal_Handler,
+		},
+		{
+			MethodName: "GenerateDocs",
+			Handler:    _AIService_GenerateDocs_Handler,
+		},
+		{
+			MethodName: "ApplyEdits",
+			Handler:    _AIService_ApplyEdits_Handler,
+		},
+		{
+			MethodName: "UndoEdits",
+			Handler:    _AIService_UndoEdits_Handler,
+		},
+		{
+			MethodName: "CancelAgent",
+			Handler:    _AIService_CancelAgent_Handler,
+		},
+		{
+			MethodName: "ApproveAgentAction",
+			Handler:    _AIService_ApproveAgentAction_Handler,
+		},
+		{
+			MethodName: "CreateMemory",
+			Handler:    _AIService_CreateMemory_Handler,
+		},
+		{
+			MethodName: "UpdateMemory",
+			Handler:    _AIService_UpdateMemory_Handler,
+		},
+		{
+			MethodName: "DeleteMemory",
+			Handler:    _AIService_DeleteMemory_Handler,
+		},
+		{
+			MethodName: "ListMemories",
+			Handler:    _AIService_ListMemories_Handler,
+		},
+		{
+			MethodName: "CountTokens",
+			Handler:    _AIService_CountTokens_Handler,
+		},
+		{
+			MethodName: "GetUsageSummary",
+			Handler:    _AIService_GetUsageSummary_Handler,
+		},
+		{
+			MethodName: "GetUsageLimits",
+			Handler:    _AIService_GetUsageLimits_Handler,
+		},
+		{
+			MethodName: "SetUsageLimits",
+			Handler:    _AIService_SetUsageLimits_Handler,
+		},
+		{
+			MethodName: "ListPromptTemplates",
+			Handler:    _AIService_ListPromptTemplates_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamComplete",
+			Handler:       _AIService_StreamComplete_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Chat",
+			Handler:       _AIService_Chat_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "RunAgent",
+			Handler:       _AIService_RunAgent_Handler,
 			ServerStreams: true,
 		},
 	},
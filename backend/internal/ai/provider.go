@@ -0,0 +1,376 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdleTimeout is returned when a provider sends nothing for longer than the idle timeout
+var ErrIdleTimeout = errors.New("model provider stopped responding")
+
+// ProviderConfig controls how requests to model providers are paced, retried and failed over
+type ProviderConfig struct {
+	RequestsPerSecond float64 // Per provider; 0 disables rate limiting
+	MaxRetries        int     // Retries of a request that was rate limited or hit a server error
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	IdleTimeout       time.Duration // Longest wait for the next bytes of a response, so long streams are not cut off
+	Failover          bool          // Retry on another model with the needed capability when a provider fails
+}
+
+// DefaultProviderConfig returns the provider settings used unless configured otherwise
+func DefaultProviderConfig() ProviderConfig {
+	return ProviderConfig{
+		RequestsPerSecond: 20,
+		MaxRetries:        3,
+		InitialBackoff:    500 * time.Millisecond,
+		MaxBackoff:        30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		Failover:          true,
+	}
+}
+
+// featureCapabilities is the model capability each feature needs when failing over
+var featureCapabilities = map[string]string{
+	"chat":     "chat",
+	"generate": "code",
+	"refactor": "code",
+	"analyze":  "code",
+	"agent":    "code",
+	"docs":     "code",
+}
+
+// maxErrorBody bounds how much of a failed response is kept for the error message
+const maxErrorBody = 4096
+
+// ProviderError is a failed request to a model provider
+type ProviderError struct {
+	Provider   string
+	StatusCode int // 0 when the provider could not be reached
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if any
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s request failed: %v", e.Provider, e.Err)
+	}
+	return fmt.Sprintf("%s returned %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// retryable reports whether the same request may succeed later
+func (e *ProviderError) retryable() bool {
+	return e.StatusCode == 0 ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500
+}
+
+// unavailable reports whether the provider cannot serve requests right now,
+// so another provider should be tried
+func (e *ProviderError) unavailable() bool {
+	return e.retryable() || e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// providerCall is a request that reached a provider
+type providerCall struct {
+	resp     *http.Response
+	model    ModelInfo // The model that served the request, after any failover
+	config   Config
+	messages []Message // The prompt as sent
+	budget   PromptBudget
+}
+
+// dispatch fits a prompt to the model and sends it. When the provider fails
+// and failover is enabled, the request moves on to the next model with the
+// capability the feature needs.
+func (s *service) dispatch(ctx context.Context, model ModelInfo, messages []Message, opts Options) (*providerCall, error) {
+	capability, ok := featureCapabilities[opts.Feature]
+	if !ok {
+		capability = "completion"
+	}
+
+	var (
+		tried   []string
+		lastErr error
+	)
+	for {
+		tried = append(tried, model.ID)
+		config := s.modelConfig(model.ID, opts)
+
+		fitted, budget, err := s.fitPrompt(messages, model, config, opts)
+		if err != nil {
+			if lastErr != nil {
+				// The fallback model cannot take this prompt; report why the first one failed
+				return nil, lastErr
+			}
+			return nil, err
+		}
+
+		resp, err := s.send(ctx, model, fitted, config, opts)
+		if err == nil {
+			return &providerCall{resp: resp, model: model, config: config, messages: fitted, budget: budget}, nil
+		}
+
+		var providerErr *ProviderError
+		if !s.providerConfig.Failover || !errors.As(err, &providerErr) || !providerErr.unavailable() || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+
+		next := s.modelManager.GetModelByCapability(capability, tried...)
+		if next.ID == "" || !next.hasCapability(capability) || s.getConfigForModel(next.ID).APIToken == "" {
+			return nil, err
+		}
+		fmt.Printf("Error from %s, failing over to %s: %v\n", model.ID, next.ID, err)
+		model = next
+	}
+}
+
+// send delivers a request to a model's provider. Requests are paced by the
+// provider's rate limiter, and rate limits, server errors and unreachable
+// providers are retried with exponential backoff, honouring Retry-After.
+func (s *service) send(ctx context.Context, model ModelInfo, messages []Message, config Config, opts Options) (*http.Response, error) {
+	limiter := s.limiters[model.Provider]
+
+	var lastErr error
+	for attempt := 0; attempt <= s.providerConfig.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, s.backoff(attempt, lastErr)); err != nil {
+				return nil, err
+			}
+		}
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := s.sendOnce(ctx, model, messages, config, opts)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+
+		var providerErr *ProviderError
+		if !errors.As(err, &providerErr) || !providerErr.retryable() {
+			return nil, err
+		}
+		if providerErr.RetryAfter > 0 && limiter != nil {
+			// Hold back every request to the provider, not only this one
+			limiter.HoldFor(providerErr.RetryAfter)
+		}
+	}
+	return nil, lastErr
+}
+
+// sendOnce makes a single attempt at a request. The response body fails with
+// ErrIdleTimeout when nothing arrives for the idle timeout.
+func (s *service) sendOnce(ctx context.Context, model ModelInfo, messages []Message, config Config, opts Options) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	idle := newIdleTimer(s.providerConfig.IdleTimeout, cancel)
+
+	req, err := s.buildRequest(ctx, messages, config, opts)
+	if err != nil {
+		idle.stop()
+		cancel()
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		idle.stop()
+		cancel()
+		if idle.expired() {
+			err = ErrIdleTimeout
+		}
+		return nil, &ProviderError{Provider: model.Provider, Err: err}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body.Close()
+		idle.stop()
+		cancel()
+		return nil, &ProviderError{
+			Provider:   model.Provider,
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	resp.Body = &idleTimeoutBody{body: resp.Body, idle: idle, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns the delay before a retry: exponential with jitter, or the
+// provider's Retry-After when that is longer
+func (s *service) backoff(attempt int, lastErr error) time.Duration {
+	delay := s.providerConfig.InitialBackoff << (attempt - 1)
+	if delay <= 0 || delay > s.providerConfig.MaxBackoff {
+		delay = s.providerConfig.MaxBackoff
+	}
+	// Spread retries between half and all of the delay so clients do not retry in lockstep
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	var providerErr *ProviderError
+	if errors.As(lastErr, &providerErr) && providerErr.RetryAfter > delay {
+		delay = min(providerErr.RetryAfter, s.providerConfig.MaxBackoff)
+	}
+	return delay
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiter is a token bucket allowing a steady request rate with bursts of up to one second's worth
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens per second
+	burst     float64
+	tokens    float64
+	last      time.Time
+	heldUntil time.Time // Set from Retry-After responses
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := max(rate, 1)
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until a request may be sent
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// Take the token now; a negative balance is the queue of waiting requests
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if held := l.heldUntil.Sub(now); held > wait {
+		wait = held
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	if err := sleepContext(ctx, wait); err != nil {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// HoldFor stops requests from being sent for a while
+func (l *rateLimiter) HoldFor(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.heldUntil) {
+		l.heldUntil = until
+	}
+}
+
+// idleTimer cancels a request when it is not reset within the timeout
+type idleTimer struct {
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newIdleTimer(timeout time.Duration, cancel context.CancelFunc) *idleTimer {
+	t := &idleTimer{timeout: timeout}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			t.timedOut.Store(true)
+			cancel()
+		})
+	}
+	return t
+}
+
+func (t *idleTimer) reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *idleTimer) expired() bool {
+	return t.timedOut.Load()
+}
+
+// idleTimeoutBody is a response body whose idle timer is reset by every read
+type idleTimeoutBody struct {
+	body   io.ReadCloser
+	idle   *idleTimer
+	cancel context.CancelFunc
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.idle.reset()
+	}
+	if err != nil && err != io.EOF && b.idle.expired() {
+		err = ErrIdleTimeout
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.idle.stop()
+	b.cancel()
+	return b.body.Close()
+}
@@ -2,11 +2,16 @@ package ai
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"glask-ide/internal/filesystem"
+	"glask-ide/internal/terminal"
 )
 
 // Service defines the interface for AI model interactions
@@ -14,30 +19,144 @@ type Service interface {
 	Complete(ctx context.Context, prompt string, opts Options) (*Response, error)
 	Stream(ctx context.Context, prompt string, callback func(StreamChunk) error, opts Options) error
 	GetModels() []ModelInfo
-	GetActiveModel() ModelInfo
-	SetActiveModel(modelID string) error
+	GetActiveModel(sessionID string) ModelInfo
+	SetActiveModel(sessionID, modelID string) error
+
+	// Conversation operations
+	CreateConversation(title string) (*Conversation, error)
+	ListConversations() ([]Conversation, error)
+	GetConversation(id string) (*Conversation, []ConversationMessage, error)
+	DeleteConversation(id string) error
+	AppendMessage(conversationID, role, content string) (*ConversationMessage, error)
+	Chat(ctx context.Context, conversationID, content string, callback func(StreamChunk) error, opts Options) error
+
+	// BuildContext assembles workspace context for an editor position, by
+	// default within the budget of the session's model
+	BuildContext(ec EditorContext, budget int, sessionID string) (*ContextBundle, error)
+
+	// CodeComplete returns a fill-in-the-middle suggestion for the cursor position
+	CodeComplete(ctx context.Context, req InlineCompletionRequest) (*InlineCompletion, error)
+
+	// Code generation operations return edits that are previewed before being applied
+	GenerateCode(ctx context.Context, req GenerateRequest) (*EditProposal, error)
+	RefactorCode(ctx context.Context, req RefactorRequest) (*EditProposal, error)
+	AnalyzeCode(ctx context.Context, req AnalyzeRequest) (*CodeAnalysis, error)
+	AnalyzeTerminalOutput(ctx context.Context, req TerminalAnalysisRequest) (*TerminalAnalysis, error)
+	GenerateDocs(ctx context.Context, req DocsRequest) (*DocsResult, error)
+	ApplyEdits(proposalID string, edits []TextEdit) (*AppliedEdits, error)
+	UndoEdits(appliedID string) ([]string, error)
+
+	// Agent operations
+	RunAgent(ctx context.Context, req AgentRequest, callback func(AgentEvent) error) error
+	CancelAgent(runID string) error
+	ApproveAgentAction(runID, callID string, approved bool) error
+
+	// Memory operations
+	CreateMemory(m Memory) (*Memory, error)
+	UpdateMemory(m Memory) (*Memory, error)
+	DeleteMemory(id int64) error
+	ListMemories(ctx context.Context, filter MemoryFilter) ([]Memory, error)
+
+	// CountTokens measures a prompt against a model's context window
+	CountTokens(ctx context.Context, req TokenCountRequest) (*TokenCount, error)
+
+	// Usage accounting
+	GetUsageSummary(req UsageSummaryRequest) (*UsageSummary, error)
+	GetUsageStatus() (*UsageStatus, error)
+	SetUsageLimits(limits UsageLimits) (*UsageStatus, error)
+
+	// ListTemplates returns the prompt templates selectable for a project
+	ListTemplates(project string) []PromptTemplate
 }
 
 // service implements the Service interface
 type service struct {
-	claudeConfig  Config
-	geminiConfig  Config
-	httpClient    *http.Client
-	systemPrompts map[string]string
-	modelManager  *ModelManager
+	claudeConfig   Config
+	geminiConfig   Config
+	httpClient     *http.Client
+	providerConfig ProviderConfig
+	limiters       map[string]*rateLimiter // By provider
+	tokenizers     map[string]Tokenizer    // By provider
+	cache          *responseCache          // Nil when disabled
+	templates      *templateStore
+	modelManager   *ModelManager
+	conversations  *ConversationStore
+	memories       *MemoryStore
+	usage          *UsageStore
+	contextBuilder *ContextBuilder
+	inline         *inlineCompleter
+	edits          *editManager
+	terminals      *terminal.Manager
+	agents         *agentRuns
 }
 
-// NewService creates a new AI service
-func NewService(claudeConfig, geminiConfig Config) Service {
+// NewService creates a new AI service backed by the given database, using the
+// filesystem service for workspace context and the terminal manager for agent
+// commands. User prompt templates are read from promptDir.
+func NewService(claudeConfig, geminiConfig Config, providerConfig ProviderConfig, cacheConfig CacheConfig, promptDir string, db *sql.DB, fs filesystem.Service, terminals *terminal.Manager) (Service, error) {
+	conversations, err := NewConversationStore(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize conversation store: %w", err)
+	}
+
+	// Memories are matched by embedding as well as keyword when Gemini is configured
+	var embedder Embedder
+	if geminiConfig.APIToken != "" {
+		embedder = newGeminiEmbedder(geminiConfig.APIToken)
+	}
+	memories, err := NewMemoryStore(db, embedder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize memory store: %w", err)
+	}
+
+	usage, err := NewUsageStore(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize usage store: %w", err)
+	}
+
+	cache, err := newResponseCache(cacheConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize response cache: %w", err)
+	}
+
+	templates, err := newTemplateStore(promptDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize prompt templates: %w", err)
+	}
+
+	// Completions have no total timeout so long streams survive; requests that
+	// go quiet are cut off by the provider idle timeout instead
+	countClient := &http.Client{
+		Timeout: time.Second * 30,
+	}
+	limiters := make(map[string]*rateLimiter)
+	if providerConfig.RequestsPerSecond > 0 {
+		limiters["anthropic"] = newRateLimiter(providerConfig.RequestsPerSecond)
+		limiters["google"] = newRateLimiter(providerConfig.RequestsPerSecond)
+	}
+
 	return &service{
-		claudeConfig: claudeConfig,
-		geminiConfig: geminiConfig,
-		httpClient: &http.Client{
-			Timeout: time.Second * 30,
+		claudeConfig:   claudeConfig,
+		geminiConfig:   geminiConfig,
+		httpClient:     &http.Client{},
+		providerConfig: providerConfig,
+		limiters:       limiters,
+		cache:          cache,
+		tokenizers: map[string]Tokenizer{
+			"anthropic": newClaudeTokenizer(countClient),
+			"google":    newGeminiTokenizer(countClient),
 		},
-		systemPrompts: make(map[string]string),
-		modelManager:  NewModelManager(),
-	}
+		templates:      templates,
+		modelManager:   NewModelManager(),
+		conversations:  conversations,
+		memories:       memories,
+		usage:          usage,
+		contextBuilder: NewContextBuilder(fs),
+		inline:         newInlineCompleter(),
+		edits:          newEditManager(fs),
+		terminals:      terminals,
+		agents:         newAgentRuns(),
+	}, nil
 }
 
 // GetModels returns all available models
@@ -45,127 +164,314 @@ func (s *service) GetModels() []ModelInfo {
 	return s.modelManager.GetModels()
 }
 
-// GetActiveModel returns the currently active model
-func (s *service) GetActiveModel() ModelInfo {
-	return s.modelManager.GetActiveModel()
+// GetActiveModel returns the model a session uses; the global active model
+// when the session ID is empty or the session has not selected one
+func (s *service) GetActiveModel(sessionID string) ModelInfo {
+	return s.modelManager.GetSessionModel(sessionID)
+}
+
+// SetActiveModel selects a session's model, or the global active model when
+// the session ID is empty
+func (s *service) SetActiveModel(sessionID, modelID string) error {
+	return s.modelManager.SetSessionModel(sessionID, modelID)
 }
 
-// SetActiveModel changes the active model
-func (s *service) SetActiveModel(modelID string) error {
-	return s.modelManager.SetActiveModel(modelID)
+// resolveModel picks the model a request runs on
+func (s *service) resolveModel(opts Options) (ModelInfo, error) {
+	return s.modelManager.ResolveModel(opts.ModelID, opts.SessionID)
 }
 
 // Complete sends a completion request to the appropriate AI model
 func (s *service) Complete(ctx context.Context, prompt string, opts Options) (*Response, error) {
+	if opts.Feature == "" {
+		opts.Feature = "complete"
+	}
+	return s.complete(ctx, []Message{{Role: "user", Content: prompt}}, opts)
+}
+
+// Stream streams the AI response through a callback
+func (s *service) Stream(ctx context.Context, prompt string, callback func(StreamChunk) error, opts Options) error {
+	if opts.Feature == "" {
+		opts.Feature = "stream"
+	}
+	return s.stream(ctx, []Message{{Role: "user", Content: prompt}}, callback, opts)
+}
+
+// complete sends a message list to the active model and waits for the full response
+func (s *service) complete(ctx context.Context, messages []Message, opts Options) (*Response, error) {
 	startTime := time.Now()
 
-	// Get the active model configuration
-	activeModel := s.modelManager.GetActiveModel()
-	config := s.getConfigForModel(activeModel.ID)
+	// Get the model for this request
+	activeModel, err := s.resolveModel(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	// Build the request
-	req, err := s.buildRequest(ctx, prompt, config, opts)
+	// Fill the prompt template, if one was selected
+	messages, opts, err = s.applyTemplateToMessages(messages, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build request: %w", err)
+		return nil, err
+	}
+
+	// Add workspace context
+	messages, contextFiles, err := s.applyEditorContext(messages, activeModel, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deterministic requests are answered from the cache when possible
+	var cacheKey string
+	if s.cache != nil && cacheable(opts) {
+		cacheKey = responseCacheKey(activeModel, s.modelConfig(activeModel.ID, opts), messages, opts)
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			cached.Context = contextFiles
+			cached.Metrics.TotalTime = time.Since(startTime)
+			cached.Metrics.Cost = 0
+			cached.Metrics.CacheHit = true
+			return &cached, nil
+		}
+	}
+
+	if err := s.usage.CheckLimits(); err != nil {
+		return nil, err
 	}
 
-	// Send the request
-	resp, err := s.httpClient.Do(req)
+	// Send the request, failing over to another model if the provider is down
+	call, err := s.dispatch(ctx, activeModel, messages, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	defer call.resp.Body.Close()
 
 	// Parse the response based on the model
 	var result *Response
-	switch activeModel.Provider {
+	switch call.model.Provider {
 	case "anthropic":
 		var claudeResp claudeResponse
-		if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
+		if err := json.NewDecoder(call.resp.Body).Decode(&claudeResp); err != nil {
 			return nil, fmt.Errorf("failed to decode Claude response: %w", err)
 		}
 		result = parseClaudeResponse(&claudeResp)
 	case "google":
 		var geminiResp geminiResponse
-		if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+		if err := json.NewDecoder(call.resp.Body).Decode(&geminiResp); err != nil {
 			return nil, fmt.Errorf("failed to decode Gemini response: %w", err)
 		}
 		result = parseGeminiResponse(&geminiResp)
 	default:
-		return nil, fmt.Errorf("unsupported provider: %s", activeModel.Provider)
+		return nil, fmt.Errorf("unsupported provider: %s", call.model.Provider)
 	}
 
-	// Add metrics
+	// Add metrics, and calibrate the token estimate with the size the provider reports
+	result.Model = call.model.ID
 	result.Metrics.TotalTime = time.Since(startTime)
+	result.Metrics.Budget = call.budget
+	result.Context = contextFiles
+	if result.Metrics.PromptTokens > 0 {
+		s.tokenizer(call.model).Calibrate(promptLength(call.messages, call.config, opts), result.Metrics.PromptTokens)
+	}
+	result.Metrics.Cost = s.recordUsage(call.model, opts, result.Status, result.Metrics, false)
+
+	// Only cache what the requested model said; a failover answer is not its answer
+	if cacheKey != "" && result.Status == "succeeded" && call.model.ID == activeModel.ID {
+		s.cache.Put(cacheKey, *result)
+	}
 
 	return result, nil
 }
 
-// Stream streams the AI response through a callback
-func (s *service) Stream(ctx context.Context, prompt string, callback func(StreamChunk) error, opts Options) error {
+// stream sends a message list to the active model and streams the response through a callback
+func (s *service) stream(ctx context.Context, messages []Message, callback func(StreamChunk) error, opts Options) error {
 	// Set streaming option
 	opts.Stream = true
 
-	// Get the active model configuration
-	activeModel := s.modelManager.GetActiveModel()
-	config := s.getConfigForModel(activeModel.ID)
+	// Get the model for this request
+	activeModel, err := s.resolveModel(opts)
+	if err != nil {
+		return err
+	}
 
-	// Build the request
-	req, err := s.buildRequest(ctx, prompt, config, opts)
+	// Fill the prompt template, if one was selected
+	messages, opts, err = s.applyTemplateToMessages(messages, opts)
 	if err != nil {
-		return fmt.Errorf("failed to build request: %w", err)
+		return err
 	}
 
-	// Send the request
-	resp, err := s.httpClient.Do(req)
+	// Add workspace context and tell the client which files were used
+	messages, contextFiles, err := s.applyEditorContext(messages, activeModel, opts)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
+	if len(contextFiles) > 0 {
+		if err := callback(StreamChunk{Type: "context", Timestamp: time.Now(), ContextFiles: contextFiles}); err != nil {
+			return fmt.Errorf("callback error: %w", err)
+		}
+	}
+
+	if err := s.usage.CheckLimits(); err != nil {
+		return err
+	}
+	startTime := time.Now()
+
+	// Send the request, failing over to another model if the provider is down.
+	// Once text has been streamed a failure can no longer be retried.
+	call, err := s.dispatch(ctx, activeModel, messages, opts)
+	if err != nil {
+		return err
+	}
+	defer call.resp.Body.Close()
+	model := call.model
+
+	// Report how the prompt fitted the serving model's context window
+	if err := callback(StreamChunk{Type: "budget", Timestamp: time.Now(), Budget: &call.budget}); err != nil {
+		return fmt.Errorf("callback error: %w", err)
+	}
+
+	// Streams carry no usage, so the tokens of what was streamed are estimated.
+	// Once the stream ends it is summarized for the client, unless the client
+	// has gone away.
+	var completion strings.Builder
+	streamStatus := "failed"
+	stopReason := "error"
+	defer func() {
+		metrics := Metrics{
+			PromptTokens:     call.budget.PromptTokens,
+			CompletionTokens: s.tokenizer(model).Estimate(completion.String()),
+			TotalTime:        time.Since(startTime),
+			Budget:           call.budget,
+		}
+		metrics.TotalTokens = metrics.PromptTokens + metrics.CompletionTokens
+		metrics.Cost = s.recordUsage(model, opts, streamStatus, metrics, true)
+
+		if streamStatus == "cancelled" || ctx.Err() != nil {
+			return
+		}
+		callback(StreamChunk{
+			Type:      "summary",
+			Timestamp: time.Now(),
+			Summary:   &StreamSummary{Model: model.ID, StopReason: stopReason, Metrics: metrics},
+		})
+	}()
 
 	// Process the stream based on the model
-	reader := json.NewDecoder(resp.Body)
+	reader := json.NewDecoder(call.resp.Body)
 	for {
 		select {
 		case <-ctx.Done():
+			streamStatus = "cancelled"
+			stopReason = "cancelled"
 			return ctx.Err()
 		default:
 			var chunk StreamChunk
-			switch activeModel.Provider {
-			case "anthropic":
-				var claudeChunk claudeStreamChunk
-				if err := reader.Decode(&claudeChunk); err != nil {
-					if err == io.EOF {
-						return nil
-					}
-					return fmt.Errorf("failed to decode Claude stream chunk: %w", err)
-				}
-				chunk = parseClaudeStreamChunk(&claudeChunk)
-			case "google":
-				var geminiChunk geminiStreamChunk
-				if err := reader.Decode(&geminiChunk); err != nil {
-					if err == io.EOF {
-						return nil
-					}
-					return fmt.Errorf("failed to decode Gemini stream chunk: %w", err)
+			err := decodeStreamChunk(reader, model.Provider, &chunk)
+			if err == io.EOF {
+				streamStatus = "succeeded"
+				stopReason = "end"
+				return nil
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					// Cancelling the request broke the connection to the provider
+					streamStatus = "cancelled"
+					stopReason = "cancelled"
+					return ctx.Err()
 				}
-				chunk = parseGeminiStreamChunk(&geminiChunk)
-			default:
-				return fmt.Errorf("unsupported provider: %s", activeModel.Provider)
+				return err
 			}
 
 			chunk.Timestamp = time.Now()
+			if chunk.Type == "text" || chunk.Type == "done" {
+				completion.WriteString(chunk.Content)
+			}
 			if err := callback(chunk); err != nil {
 				return fmt.Errorf("callback error: %w", err)
 			}
 
 			if chunk.Type == "done" {
+				streamStatus = "succeeded"
+				stopReason = chunk.StopReason
 				return nil
 			}
 		}
 	}
 }
 
+// decodeStreamChunk reads the next chunk of a provider's stream
+func decodeStreamChunk(reader *json.Decoder, provider string, chunk *StreamChunk) error {
+	switch provider {
+	case "anthropic":
+		var claudeChunk claudeStreamChunk
+		if err := reader.Decode(&claudeChunk); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			return fmt.Errorf("failed to decode Claude stream chunk: %w", err)
+		}
+		*chunk = parseClaudeStreamChunk(&claudeChunk)
+	case "google":
+		var geminiChunk geminiStreamChunk
+		if err := reader.Decode(&geminiChunk); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			return fmt.Errorf("failed to decode Gemini stream chunk: %w", err)
+		}
+		*chunk = parseGeminiStreamChunk(&geminiChunk)
+	default:
+		return fmt.Errorf("unsupported provider: %s", provider)
+	}
+	return nil
+}
+
+// BuildContext assembles workspace context for an editor position
+func (s *service) BuildContext(ec EditorContext, budget int, sessionID string) (*ContextBundle, error) {
+	if budget <= 0 {
+		model, err := s.modelManager.ResolveModel("", sessionID)
+		if err != nil {
+			return nil, err
+		}
+		budget = defaultContextBudget(model)
+	}
+	return s.contextBuilder.Build(ec, budget)
+}
+
+// applyEditorContext prepends workspace context to the last user message
+// when the request carries editor state
+func (s *service) applyEditorContext(messages []Message, model ModelInfo, opts Options) ([]Message, []ContextFile, error) {
+	if opts.Editor == nil || len(messages) == 0 {
+		return messages, nil, nil
+	}
+
+	budget := opts.ContextBudget
+	if budget <= 0 {
+		budget = defaultContextBudget(model)
+	}
+
+	bundle, err := s.contextBuilder.Build(*opts.Editor, budget)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build context: %w", err)
+	}
+	if bundle.Prompt == "" {
+		return messages, nil, nil
+	}
+
+	withContext := make([]Message, len(messages))
+	copy(withContext, messages)
+	last := &withContext[len(withContext)-1]
+	last.Content = bundle.Prompt + "\n" + last.Content
+
+	return withContext, bundle.Files, nil
+}
+
+// defaultContextBudget is the token budget for workspace context when the request sets none
+func defaultContextBudget(model ModelInfo) int {
+	budget := model.MaxTokens / 4
+	if budget > 8000 {
+		budget = 8000
+	}
+	return budget
+}
+
 // getConfigForModel returns the configuration for a specific model
 func (s *service) getConfigForModel(modelID string) Config {
 	switch modelID {
@@ -178,14 +484,238 @@ func (s *service) getConfigForModel(modelID string) Config {
 	}
 }
 
+// modelConfig returns a model's configuration with the request's system
+// prompt, when a template set one
+func (s *service) modelConfig(modelID string, opts Options) Config {
+	config := s.getConfigForModel(modelID)
+	if opts.systemPrompt != "" {
+		config.SystemPrompt = opts.systemPrompt
+	}
+	return config
+}
+
 // buildRequest creates an HTTP request for the AI API
-func (s *service) buildRequest(ctx context.Context, prompt string, config Config, opts Options) (*http.Request, error) {
+func (s *service) buildRequest(ctx context.Context, messages []Message, config Config, opts Options) (*http.Request, error) {
 	switch config.Model {
 	case "claude-3-haiku-20240307":
-		return buildClaudeRequest(ctx, prompt, config, opts)
+		return buildClaudeRequest(ctx, messages, config, opts)
 	case "gemini-pro":
-		return buildGeminiRequest(ctx, prompt, config, opts)
+		return buildGeminiRequest(ctx, messages, config, opts)
 	default:
 		return nil, fmt.Errorf("unsupported model: %s", config.Model)
 	}
 }
+
+// CreateConversation starts a new conversation
+func (s *service) CreateConversation(title string) (*Conversation, error) {
+	return s.conversations.Create(title)
+}
+
+// ListConversations returns all stored conversations
+func (s *service) ListConversations() ([]Conversation, error) {
+	return s.conversations.List()
+}
+
+// GetConversation returns a conversation together with its messages
+func (s *service) GetConversation(id string) (*Conversation, []ConversationMessage, error) {
+	conv, err := s.conversations.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages, err := s.conversations.Messages(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conv, messages, nil
+}
+
+// DeleteConversation removes a conversation, its history and its model selection
+func (s *service) DeleteConversation(id string) error {
+	if err := s.conversations.Delete(id); err != nil {
+		return err
+	}
+	s.modelManager.ClearSession(id)
+	return nil
+}
+
+// AppendMessage adds a turn to a conversation without calling the model. Its
+// tokens are counted for the model the conversation, as its own session, uses.
+func (s *service) AppendMessage(conversationID, role, content string) (*ConversationMessage, error) {
+	model, err := s.modelManager.ResolveModel("", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return s.appendMessage(conversationID, role, content, model)
+}
+
+// appendMessage adds a turn to a conversation, counting its tokens for the
+// model that answers it
+func (s *service) appendMessage(conversationID, role, content string, model ModelInfo) (*ConversationMessage, error) {
+	tokens := s.tokenizer(model).Estimate(content)
+	return s.conversations.Append(conversationID, role, content, tokens)
+}
+
+// Chat appends a user message to a conversation, streams the model's reply
+// for the full (trimmed) history and persists the reply once it completes
+func (s *service) Chat(ctx context.Context, conversationID, content string, callback func(StreamChunk) error, opts Options) error {
+	// A conversation is its own session unless the client names one, and the
+	// model is pinned so the history is trimmed for the model that answers
+	if opts.SessionID == "" {
+		opts.SessionID = conversationID
+	}
+	model, err := s.resolveModel(opts)
+	if err != nil {
+		return err
+	}
+	opts.ModelID = model.ID
+
+	if _, err := s.appendMessage(conversationID, "user", content, model); err != nil {
+		return err
+	}
+
+	messages, err := s.loadHistory(conversationID, model, opts)
+	if err != nil {
+		return err
+	}
+	messages = s.applyMemories(ctx, messages, opts.Editor.projectPath())
+	opts.Feature = "chat"
+
+	var reply strings.Builder
+	streamErr := s.stream(ctx, messages, func(chunk StreamChunk) error {
+		if chunk.Type == "text" || chunk.Type == "done" {
+			reply.WriteString(chunk.Content)
+		}
+		return callback(chunk)
+	}, opts)
+
+	// Keep whatever the model produced, even if the stream was interrupted,
+	// so the stored history matches what the user saw
+	if reply.Len() > 0 {
+		if _, err := s.appendMessage(conversationID, "assistant", reply.String(), model); err != nil && streamErr == nil {
+			return err
+		}
+	}
+
+	return streamErr
+}
+
+// loadHistory returns a conversation's turns, trimmed to fit the model with
+// room for the reply and any workspace context
+func (s *service) loadHistory(conversationID string, model ModelInfo, opts Options) ([]Message, error) {
+	history, err := s.conversations.Messages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, len(history))
+	for i, msg := range history {
+		messages[i] = Message{Role: msg.Role, Content: msg.Content}
+	}
+
+	reserve := opts.MaxTokens
+	if reserve <= 0 {
+		reserve = defaultCompletionReserve
+	}
+	budget := model.MaxTokens - reserve
+	if opts.Editor != nil {
+		if opts.ContextBudget > 0 {
+			budget -= opts.ContextBudget
+		} else {
+			budget -= defaultContextBudget(model)
+		}
+	}
+	return trimHistory(messages, budget, s.tokenizer(model).Estimate), nil
+}
+
+// CreateMemory stores a new memory
+func (s *service) CreateMemory(m Memory) (*Memory, error) {
+	return s.memories.Create(m)
+}
+
+// UpdateMemory replaces an existing memory
+func (s *service) UpdateMemory(m Memory) (*Memory, error) {
+	return s.memories.Update(m)
+}
+
+// DeleteMemory removes a memory
+func (s *service) DeleteMemory(id int64) error {
+	return s.memories.Delete(id)
+}
+
+// ListMemories returns memories matching a filter, ranked by relevance when it has a query
+func (s *service) ListMemories(ctx context.Context, filter MemoryFilter) ([]Memory, error) {
+	return s.memories.List(ctx, filter)
+}
+
+// GetUsageSummary aggregates recorded usage by day, model, feature or project
+func (s *service) GetUsageSummary(req UsageSummaryRequest) (*UsageSummary, error) {
+	return s.usage.Summary(req)
+}
+
+// GetUsageStatus returns the spend limits with the current spend
+func (s *service) GetUsageStatus() (*UsageStatus, error) {
+	return s.usage.Status()
+}
+
+// SetUsageLimits changes the spend limits
+func (s *service) SetUsageLimits(limits UsageLimits) (*UsageStatus, error) {
+	if err := s.usage.SetLimits(limits); err != nil {
+		return nil, err
+	}
+	return s.usage.Status()
+}
+
+// recordUsage stores the usage of a request and returns its estimated cost.
+// Recording is best-effort; a failure does not fail the request.
+func (s *service) recordUsage(model ModelInfo, opts Options, status string, metrics Metrics, estimated bool) float64 {
+	project := opts.Project
+	if project == "" {
+		project = opts.Editor.projectPath()
+	}
+
+	rec := UsageRecord{
+		Model:            model.ID,
+		Project:          project,
+		Feature:          opts.Feature,
+		Status:           status,
+		PromptTokens:     metrics.PromptTokens,
+		CompletionTokens: metrics.CompletionTokens,
+		TotalTokens:      metrics.TotalTokens,
+		Latency:          metrics.TotalTime,
+		Estimated:        estimated,
+	}
+	if err := s.usage.Record(rec); err != nil {
+		fmt.Printf("Error recording usage: %v\n", err)
+	}
+	return requestCost(rec.Model, rec.PromptTokens, rec.CompletionTokens)
+}
+
+// applyMemories prepends the memories most relevant to the last user message
+func (s *service) applyMemories(ctx context.Context, messages []Message, project string) []Message {
+	if len(messages) == 0 {
+		return messages
+	}
+
+	last := messages[len(messages)-1]
+	memories, err := s.memories.Relevant(ctx, project, last.Content, maxInjectedMemories)
+	if err != nil {
+		// Memories are a best-effort addition to the prompt
+		fmt.Printf("Error loading memories: %v\n", err)
+		return messages
+	}
+	if len(memories) == 0 {
+		return messages
+	}
+
+	withMemories := make([]Message, len(messages))
+	copy(withMemories, messages)
+	withMemories[len(withMemories)-1].Content = memoryPrompt(memories) + "\n" + last.Content
+	return withMemories
+}
+
+// ptr returns a pointer to a copy of v
+func ptr[T any](v T) *T {
+	return &v
+}
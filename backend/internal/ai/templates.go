@@ -0,0 +1,441 @@
+package ai
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	// ErrTemplateNotFound is returned when no template has the requested name and version
+	ErrTemplateNotFound = errors.New("prompt template not found")
+
+	// ErrInvalidTemplate is returned for a malformed template reference or a
+	// template that cannot be rendered
+	ErrInvalidTemplate = errors.New("invalid prompt template")
+)
+
+// builtinPrompts are the templates shipped with the IDE
+//
+//go:embed prompts/*.tmpl
+var builtinPrompts embed.FS
+
+// projectPromptDir is where a project keeps its templates, relative to its root
+var projectPromptDir = filepath.Join(".glask", "prompts")
+
+// PromptTemplate is a named, versioned prompt for an IDE action. The body is
+// a text/template filled from TemplateData; a "system" block defined in it
+// replaces the model's system prompt.
+type PromptTemplate struct {
+	Name        string
+	Version     int
+	Description string
+	Source      string // "builtin", "user" or "project"
+	Path        string // File the template was loaded from; empty for built-ins
+
+	tmpl *template.Template
+}
+
+// TemplateData holds the variables a template is filled with
+type TemplateData struct {
+	Input      string // The request's own text: the prompt, message, task or instruction
+	FilePath   string
+	Language   string
+	Project    string
+	CursorLine int
+	Selection  string            // Text selected in the editor
+	Code       string            // Contents of the active file
+	Vars       map[string]string // Values supplied by the client, such as "error" or "diff"
+}
+
+// templateDir is the templates loaded from one directory
+type templateDir struct {
+	templates []*PromptTemplate
+	loaded    bool // Cleared when the directory changes so it is read again
+	watched   bool
+}
+
+// templateStore finds templates in the project, then the user's prompt
+// directory, then the built-ins. Directories are read when first used and
+// again after the watcher reports a change.
+type templateStore struct {
+	builtin []*PromptTemplate
+	userDir string
+	watcher *fsnotify.Watcher // Nil when changes cannot be watched
+
+	mu   sync.Mutex
+	dirs map[string]*templateDir
+}
+
+// newTemplateStore loads the built-in templates and watches the user's
+// prompt directory, which is created if needed
+func newTemplateStore(userDir string) (*templateStore, error) {
+	s := &templateStore{
+		userDir: userDir,
+		dirs:    make(map[string]*templateDir),
+	}
+
+	entries, err := builtinPrompts.ReadDir("prompts")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		path := "prompts/" + entry.Name()
+		data, err := builtinPrompts.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		t, err := parsePromptTemplate(entry.Name(), string(data))
+		if err != nil {
+			return nil, fmt.Errorf("built-in template %s: %w", entry.Name(), err)
+		}
+		t.Source = "builtin"
+		s.builtin = append(s.builtin, t)
+	}
+
+	if userDir != "" {
+		if err := os.MkdirAll(userDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create prompt directory: %w", err)
+		}
+	}
+
+	// Without a watcher templates still load, but edits need a restart
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Printf("Error watching prompt templates: %v\n", err)
+		return s, nil
+	}
+	s.watcher = watcher
+	go s.watchLoop()
+
+	return s, nil
+}
+
+// Resolve finds a template by "name" or "name@version" in the first source
+// that has it. Without a version the source's highest version is used.
+func (s *templateStore) Resolve(ref, project string) (*PromptTemplate, error) {
+	name, version := ref, 0
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		v, err := strconv.Atoi(ref[i+1:])
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("%w: bad version in %q", ErrInvalidTemplate, ref)
+		}
+		name, version = ref[:i], v
+	}
+
+	for _, templates := range s.sources(project) {
+		var best *PromptTemplate
+		for _, t := range templates {
+			if t.Name != name || version > 0 && t.Version != version {
+				continue
+			}
+			if best == nil || t.Version > best.Version {
+				best = t
+			}
+		}
+		if best != nil {
+			return best, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, ref)
+}
+
+// List returns the selectable templates: every version of each name from the
+// source that defines it first, sorted by name and newest version first
+func (s *templateStore) List(project string) []PromptTemplate {
+	var result []PromptTemplate
+	seen := make(map[string]bool)
+	for _, templates := range s.sources(project) {
+		defined := make(map[string]bool)
+		for _, t := range templates {
+			if seen[t.Name] {
+				continue
+			}
+			defined[t.Name] = true
+			result = append(result, *t)
+		}
+		for name := range defined {
+			seen[name] = true
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Version > result[j].Version
+	})
+	return result
+}
+
+// sources returns the templates of each source in order of precedence
+func (s *templateStore) sources(project string) [][]*PromptTemplate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sources [][]*PromptTemplate
+	if project != "" {
+		sources = append(sources, s.loadDir(filepath.Join(project, projectPromptDir), "project"))
+	}
+	if s.userDir != "" {
+		sources = append(sources, s.loadDir(s.userDir, "user"))
+	}
+	return append(sources, s.builtin)
+}
+
+// loadDir returns a directory's templates, reading it if it changed since it
+// was last read. A missing directory is checked again on the next call.
+// Callers must hold s.mu.
+func (s *templateStore) loadDir(dir, source string) []*PromptTemplate {
+	d := s.dirs[dir]
+	if d == nil {
+		d = &templateDir{}
+		s.dirs[dir] = d
+	}
+	if d.loaded {
+		return d.templates
+	}
+
+	d.templates = nil
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("Error reading prompt templates: %v\n", err)
+		}
+		d.watched = false
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tmpl") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading prompt template %s: %v\n", path, err)
+			continue
+		}
+		t, err := parsePromptTemplate(entry.Name(), string(data))
+		if err != nil {
+			// A broken file must not hide the other templates
+			fmt.Printf("Error loading prompt template %s: %v\n", path, err)
+			continue
+		}
+		t.Source = source
+		t.Path = path
+		d.templates = append(d.templates, t)
+	}
+
+	if s.watcher != nil && !d.watched {
+		if err := s.watcher.Add(dir); err != nil {
+			fmt.Printf("Error watching prompt templates: %v\n", err)
+		} else {
+			d.watched = true
+		}
+	}
+	// Unwatched directories are read on every call so edits are still seen
+	d.loaded = d.watched
+	return d.templates
+}
+
+// watchLoop marks directories for reloading when their templates change
+func (s *templateStore) watchLoop() {
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			// The event names either a file in a watched directory or the directory itself
+			for _, dir := range []string{filepath.Dir(event.Name), event.Name} {
+				if d, ok := s.dirs[dir]; ok {
+					d.loaded = false
+					if dir == event.Name && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+						d.watched = false
+					}
+				}
+			}
+			s.mu.Unlock()
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("Error watching prompt templates: %v\n", err)
+		}
+	}
+}
+
+// parsePromptTemplate reads a template file: an optional front matter block
+// of "key: value" lines between "---" lines, followed by the template body.
+// The name defaults to the file name and the version to 1.
+func parsePromptTemplate(fileName, content string) (*PromptTemplate, error) {
+	t := &PromptTemplate{
+		Name:    strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+		Version: 1,
+	}
+
+	body := content
+	if rest, ok := strings.CutPrefix(content, "---\n"); ok {
+		header, after, found := strings.Cut(rest, "\n---\n")
+		if !found {
+			return nil, fmt.Errorf("unterminated front matter")
+		}
+		body = after
+
+		scanner := bufio.NewScanner(strings.NewReader(header))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("bad front matter line %q", line)
+			}
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "name":
+				t.Name = value
+			case "version":
+				v, err := strconv.Atoi(value)
+				if err != nil || v < 1 {
+					return nil, fmt.Errorf("bad version %q", value)
+				}
+				t.Version = v
+			case "description":
+				t.Description = value
+			}
+		}
+	}
+	if t.Name == "" || strings.Contains(t.Name, "@") {
+		return nil, fmt.Errorf("bad template name %q", t.Name)
+	}
+
+	tmpl, err := template.New(t.Name).Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// Render fills the template, returning the prompt and the system prompt it
+// defines, which is empty when it defines none
+func (t *PromptTemplate) Render(data TemplateData) (string, string, error) {
+	var prompt strings.Builder
+	if err := t.tmpl.Execute(&prompt, data); err != nil {
+		return "", "", fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, t.Name, err)
+	}
+
+	var system strings.Builder
+	if block := t.tmpl.Lookup("system"); block != nil {
+		if err := block.Execute(&system, data); err != nil {
+			return "", "", fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, t.Name, err)
+		}
+	}
+	return strings.TrimSpace(prompt.String()), strings.TrimSpace(system.String()), nil
+}
+
+// applyTemplate renders the request's template around input, filling the
+// other variables from the editor. The returned options carry the template's
+// system prompt and no longer name the template, so it is applied only once.
+func (s *service) applyTemplate(input, code string, opts Options) (string, Options, error) {
+	if opts.Template == "" {
+		return input, opts, nil
+	}
+
+	project := opts.Project
+	if project == "" {
+		project = opts.Editor.projectPath()
+	}
+	t, err := s.templates.Resolve(opts.Template, project)
+	if err != nil {
+		return "", opts, err
+	}
+
+	data := TemplateData{
+		Input:   input,
+		Project: project,
+		Code:    code,
+		Vars:    opts.TemplateVars,
+	}
+	if ec := opts.Editor; ec != nil {
+		data.FilePath = ec.FilePath
+		data.Language = ec.Language
+		data.CursorLine = ec.CursorLine
+		if ec.FilePath != "" && (data.Code == "" || ec.Selection != nil) {
+			content, err := s.readSource(ec.FilePath)
+			if err != nil {
+				return "", opts, err
+			}
+			if data.Code == "" {
+				data.Code = content
+			}
+			if ec.Selection != nil {
+				data.Selection = selectedText(content, *ec.Selection)
+			}
+		}
+	}
+
+	prompt, system, err := t.Render(data)
+	if err != nil {
+		return "", opts, err
+	}
+	opts.Template = ""
+	if system != "" {
+		opts.systemPrompt = system
+	}
+	return prompt, opts, nil
+}
+
+// applyTemplateToMessages renders the request's template around the last message
+func (s *service) applyTemplateToMessages(messages []Message, opts Options) ([]Message, Options, error) {
+	if opts.Template == "" || len(messages) == 0 {
+		return messages, opts, nil
+	}
+
+	prompt, opts, err := s.applyTemplate(messages[len(messages)-1].Content, "", opts)
+	if err != nil {
+		return nil, opts, err
+	}
+	rendered := make([]Message, len(messages))
+	copy(rendered, messages)
+	rendered[len(rendered)-1].Content = prompt
+	return rendered, opts, nil
+}
+
+// selectedText returns the text within a range, or "" when it is out of bounds
+func selectedText(content string, r TextRange) string {
+	lineStarts := []int{0}
+	for i, c := range content {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	start, err := rangeOffset(content, lineStarts, r.StartLine, r.StartColumn)
+	if err != nil {
+		return ""
+	}
+	end, err := rangeOffset(content, lineStarts, r.EndLine, r.EndColumn)
+	if err != nil || end < start {
+		return ""
+	}
+	return content[start:end]
+}
+
+// ListTemplates returns the prompt templates selectable for a project
+func (s *service) ListTemplates(project string) []PromptTemplate {
+	return s.templates.List(project)
+}
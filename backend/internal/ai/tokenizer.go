@@ -0,0 +1,351 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	claudeCountTokensURL = "https://api.anthropic.com/v1/messages/count_tokens"
+	geminiCountTokensURL = "https://generativelanguage.googleapis.com/v1/models/%s:countTokens"
+
+	// minCalibrationChars is the smallest prompt used to recalibrate an
+	// estimator; short prompts are dominated by per-message overhead
+	minCalibrationChars = 200
+)
+
+// ErrPromptTooLarge is returned when a prompt does not fit in the model's
+// context window even after trimming the conversation history
+var ErrPromptTooLarge = errors.New("prompt exceeds the model's context window")
+
+// Tokenizer counts tokens the way a provider's models do
+type Tokenizer interface {
+	// Estimate approximates the token count of a text without a network call
+	Estimate(text string) int
+	// Count asks the provider for the exact token count of a prompt
+	Count(ctx context.Context, messages []Message, config Config, opts Options) (int, error)
+	// Calibrate adjusts the estimate with the real token count of a prompt
+	Calibrate(chars, tokens int)
+}
+
+// PromptBudget reports how a prompt fits in a model's context window
+type PromptBudget struct {
+	ContextWindow   int
+	ReserveTokens   int // Kept free for the completion
+	PromptBudget    int // Available to the prompt
+	PromptTokens    int // Estimated size of the prompt as sent
+	TrimmedMessages int // Oldest turns dropped to make the prompt fit
+}
+
+// TokenCountRequest asks for the size of a prompt on a model
+type TokenCountRequest struct {
+	ModelID   string // The session's model when empty
+	SessionID string // Client session whose model selection applies
+	Messages  []Message
+	MaxTokens int // Completion reserve; the default reserve when 0
+}
+
+// TokenCount is the size of a prompt and how it fits the model's budget
+type TokenCount struct {
+	ModelID string
+	Tokens  int
+	Exact   bool // False when the count is a local estimate
+	Fits    bool
+	Budget  PromptBudget
+}
+
+// estimator approximates tokens from the text length. The characters per
+// token ratio starts at a per-provider default and follows the prompt sizes
+// the provider reports.
+type estimator struct {
+	mu            sync.Mutex
+	charsPerToken float64
+}
+
+func (e *estimator) Estimate(text string) int {
+	if text == "" {
+		return 0
+	}
+	e.mu.Lock()
+	ratio := e.charsPerToken
+	e.mu.Unlock()
+	return int(float64(len(text))/ratio) + 1
+}
+
+func (e *estimator) Calibrate(chars, tokens int) {
+	if chars < minCalibrationChars || tokens <= 0 {
+		return
+	}
+	observed := float64(chars) / float64(tokens)
+	observed = min(max(observed, 1.5), 8)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// Move gradually so a single unusual prompt does not skew later estimates
+	e.charsPerToken = e.charsPerToken*0.8 + observed*0.2
+}
+
+// claudeTokenizer counts with Anthropic's token counting endpoint
+type claudeTokenizer struct {
+	estimator
+	httpClient *http.Client
+}
+
+func newClaudeTokenizer(httpClient *http.Client) *claudeTokenizer {
+	return &claudeTokenizer{estimator: estimator{charsPerToken: 3.5}, httpClient: httpClient}
+}
+
+func (t *claudeTokenizer) Count(ctx context.Context, messages []Message, config Config, opts Options) (int, error) {
+	reqBody := struct {
+		Model    string       `json:"model"`
+		Messages []message    `json:"messages"`
+		Tools    []claudeTool `json:"tools,omitempty"`
+	}{
+		Model:    config.Model,
+		Messages: claudeMessages(messages, config),
+		Tools:    claudeTools(opts.Tools),
+	}
+
+	var countResp struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	err := postCount(ctx, t.httpClient, claudeCountTokensURL, reqBody, &countResp, func(req *http.Request) {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.APIToken))
+		req.Header.Set("Anthropic-Version", "2023-06-01")
+	})
+	if err != nil {
+		return 0, err
+	}
+	return countResp.InputTokens, nil
+}
+
+// geminiTokenizer counts with Gemini's countTokens endpoint
+type geminiTokenizer struct {
+	estimator
+	httpClient *http.Client
+}
+
+func newGeminiTokenizer(httpClient *http.Client) *geminiTokenizer {
+	return &geminiTokenizer{estimator: estimator{charsPerToken: 4}, httpClient: httpClient}
+}
+
+func (t *geminiTokenizer) Count(ctx context.Context, messages []Message, config Config, opts Options) (int, error) {
+	reqBody := struct {
+		Contents []geminiContent `json:"contents"`
+	}{
+		Contents: geminiContents(messages, config),
+	}
+
+	var countResp struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	err := postCount(ctx, t.httpClient, fmt.Sprintf(geminiCountTokensURL, config.Model), reqBody, &countResp, func(req *http.Request) {
+		req.Header.Set("x-goog-api-key", config.APIToken)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return countResp.TotalTokens, nil
+}
+
+// postCount sends a token counting request and decodes the reply
+func postCount(ctx context.Context, client *http.Client, url string, body, result any, auth func(*http.Request)) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token count request failed: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode token count response: %w", err)
+	}
+	return nil
+}
+
+// tokenizer returns the tokenizer for a model's provider
+func (s *service) tokenizer(model ModelInfo) Tokenizer {
+	if tok, ok := s.tokenizers[model.Provider]; ok {
+		return tok
+	}
+	return s.tokenizers["anthropic"]
+}
+
+// CountTokens measures a prompt on a model, exactly when the provider can
+// count it and with the calibrated estimate otherwise
+func (s *service) CountTokens(ctx context.Context, req TokenCountRequest) (*TokenCount, error) {
+	model, err := s.modelManager.ResolveModel(req.ModelID, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	config := s.getConfigForModel(model.ID)
+	opts := Options{MaxTokens: req.MaxTokens}
+	tok := s.tokenizer(model)
+
+	budget, err := newPromptBudget(model, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	chars := promptLength(req.Messages, config, opts)
+	count := &TokenCount{ModelID: model.ID}
+	if config.APIToken != "" {
+		if tokens, err := tok.Count(ctx, req.Messages, config, opts); err == nil {
+			count.Tokens = tokens
+			count.Exact = true
+			tok.Calibrate(chars, tokens)
+		} else {
+			fmt.Printf("Error counting tokens with %s: %v\n", model.Provider, err)
+		}
+	}
+	if !count.Exact {
+		count.Tokens = estimatePrompt(tok, req.Messages, config, opts)
+	}
+
+	budget.PromptTokens = count.Tokens
+	count.Budget = budget
+	count.Fits = count.Tokens <= budget.PromptBudget
+	return count, nil
+}
+
+// fitPrompt checks a prompt against the model's context window, dropping the
+// oldest turns when it is too large. It fails with ErrPromptTooLarge when the
+// latest turn alone does not fit.
+func (s *service) fitPrompt(messages []Message, model ModelInfo, config Config, opts Options) ([]Message, PromptBudget, error) {
+	budget, err := newPromptBudget(model, opts)
+	if err != nil {
+		return nil, budget, err
+	}
+
+	tok := s.tokenizer(model)
+	fixed := estimatePrompt(tok, nil, config, opts)
+	sizes := make([]int, len(messages))
+	total := fixed
+	for i, msg := range messages {
+		sizes[i] = estimatePrompt(tok, []Message{msg}, Config{}, Options{})
+		total += sizes[i]
+	}
+
+	// Turns before a pinned message go first, then the ones after it
+	pinned := opts.pinnedMessage - 1
+	trimmed := messages
+	for total > budget.PromptBudget {
+		first := 0
+		if pinned == 0 {
+			first = 1
+		}
+		if len(trimmed) <= first+1 {
+			break
+		}
+
+		n := droppableTurns(trimmed, first)
+		if pinned > 0 {
+			n = min(n, pinned)
+			pinned -= n
+		}
+		for i := first; i < first+n; i++ {
+			total -= sizes[i]
+		}
+		trimmed = append(trimmed[:first:first], trimmed[first+n:]...)
+		sizes = append(sizes[:first:first], sizes[first+n:]...)
+		budget.TrimmedMessages += n
+	}
+
+	budget.PromptTokens = total
+	if total > budget.PromptBudget {
+		return nil, budget, fmt.Errorf("%w: about %d tokens for a budget of %d", ErrPromptTooLarge, total, budget.PromptBudget)
+	}
+	return trimmed, budget, nil
+}
+
+// newPromptBudget splits a model's context window between prompt and completion
+func newPromptBudget(model ModelInfo, opts Options) (PromptBudget, error) {
+	reserve := opts.MaxTokens
+	if reserve <= 0 {
+		reserve = defaultCompletionReserve
+	}
+
+	budget := PromptBudget{
+		ContextWindow: model.MaxTokens,
+		ReserveTokens: reserve,
+		PromptBudget:  model.MaxTokens - reserve,
+	}
+	if budget.PromptBudget <= 0 {
+		return budget, fmt.Errorf("%w: %d tokens reserved for the completion leave no room in %d",
+			ErrPromptTooLarge, reserve, model.MaxTokens)
+	}
+	return budget, nil
+}
+
+// droppableTurns returns how many turns from index first can be removed
+// together. A tool call's results are removed with it, and a conversation
+// never starts with an assistant turn.
+func droppableTurns(messages []Message, first int) int {
+	n := 1
+	for first+n < len(messages)-1 {
+		next := messages[first+n]
+		if len(next.ToolResults) == 0 && (first > 0 || next.Role == "user") {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// estimatePrompt approximates the tokens of a prompt with its system prompt and tools
+func estimatePrompt(tok Tokenizer, messages []Message, config Config, opts Options) int {
+	return tok.Estimate(promptText(messages, config, opts))
+}
+
+// promptLength is the length of the text a prompt's token count is estimated from
+func promptLength(messages []Message, config Config, opts Options) int {
+	return len(promptText(messages, config, opts))
+}
+
+// promptText concatenates everything in a prompt that costs tokens
+func promptText(messages []Message, config Config, opts Options) string {
+	var b strings.Builder
+	b.WriteString(config.SystemPrompt)
+	for _, tool := range opts.Tools {
+		b.WriteString(tool.Name)
+		b.WriteString(tool.Description)
+		b.Write(tool.Parameters)
+	}
+	for _, msg := range messages {
+		b.WriteString(msg.Content)
+		for _, call := range msg.ToolCalls {
+			b.WriteString(call.Name)
+			b.Write(call.Arguments)
+		}
+		for _, result := range msg.ToolResults {
+			b.WriteString(result.Content)
+		}
+	}
+	return b.String()
+}
+
+// estimateTokens approximates the token count of a text (~4 characters per
+// token) where no model is involved, such as sizing workspace context
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -1,6 +1,9 @@
 package ai
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Config holds the configuration for an AI model
 type Config struct {
@@ -14,10 +17,15 @@ type Config struct {
 // Response represents a response from the AI model
 type Response struct {
 	ID      string
+	Model   string // The model that served the request, which differs from the active one after a failover
 	Status  string // "starting", "processing", "succeeded", "failed"
 	Output  string
 	Error   string
 	Metrics Metrics
+	Context []ContextFile // Workspace files included in the prompt
+
+	// ToolCalls holds the tools the model asked to call, if any
+	ToolCalls []ToolCall
 }
 
 // Metrics holds performance metrics for an AI response
@@ -26,21 +34,160 @@ type Metrics struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTime        time.Duration
+	Budget           PromptBudget // How the prompt was fitted to the context window
+	Cost             float64      // Estimated from the price table, in USD
+	CacheHit         bool         // Served from the response cache without calling the model
 }
 
 // StreamChunk represents a chunk of streaming response
 type StreamChunk struct {
-	Type      string // "text", "error", "done"
-	Content   string
-	Timestamp time.Time
+	Type         string // "context", "budget", "text", "error", "done", "summary"
+	Content      string
+	Timestamp    time.Time
+	ContextFiles []ContextFile  // Set on "context" chunks
+	Budget       *PromptBudget  // Set on "budget" chunks
+	StopReason   string         // Set on "done" chunks
+	Summary      *StreamSummary // Set on the "summary" chunk that ends a stream
+}
+
+// StreamSummary describes a finished stream
+type StreamSummary struct {
+	Model      string
+	StopReason string  // "end", "max_tokens", "stop_sequence", "filtered", "error" or "cancelled"
+	Metrics    Metrics // Token counts are estimated
 }
 
 // Options represents optional parameters for AI requests
 type Options struct {
 	Stream        bool
-	Temperature   float64
+	Temperature   *float64 // The provider's default when nil
 	MaxTokens     int
 	StopSequences []string
 	TopP          float64
 	TopK          int
+
+	// Editor, when set, adds relevant workspace context to the prompt
+	Editor *EditorContext
+	// ContextBudget caps the tokens spent on workspace context (0 = default)
+	ContextBudget int
+
+	// Tools the model may call instead of answering directly
+	Tools []ToolDefinition
+
+	// ModelID overrides the model for this request; otherwise the session's
+	// selection, or the active model, is used
+	ModelID   string
+	SessionID string
+
+	// NoCache skips the response cache; deterministic requests are cached otherwise
+	NoCache bool
+
+	// Template names the prompt template the request's text is filled into, as
+	// "name" or "name@version"; TemplateVars are extra variables for it
+	Template     string
+	TemplateVars map[string]string
+
+	// systemPrompt replaces the model's system prompt; set by the template
+	systemPrompt string
+
+	// Feature and Project attribute the request's usage; Project defaults to the editor's
+	Feature string
+	Project string
+
+	// pinnedMessage is the 1-based position of a message prompt trimming must
+	// keep, such as an agent's task; 0 when none
+	pinnedMessage int
+}
+
+// TextRange is a span of text in a file. Lines and columns are 1-based.
+type TextRange struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// EditorContext describes the editor state an AI request originates from
+type EditorContext struct {
+	FilePath     string     `json:"filePath"`
+	ProjectPath  string     `json:"projectPath,omitempty"`
+	Language     string     `json:"language,omitempty"`
+	CursorLine   int        `json:"cursorLine,omitempty"`
+	CursorColumn int        `json:"cursorColumn,omitempty"`
+	Selection    *TextRange `json:"selection,omitempty"`
+}
+
+// projectPath returns the editor's project path, or "" without an editor
+func (ec *EditorContext) projectPath() string {
+	if ec == nil {
+		return ""
+	}
+	return ec.ProjectPath
+}
+
+// ContextFile describes a file (or part of one) included in a prompt
+type ContextFile struct {
+	Path      string `json:"path"`
+	Reason    string `json:"reason"` // "active", "import", "symbol", "recent"
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Tokens    int    `json:"tokens"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// ContextBundle is the workspace context assembled for a request
+type ContextBundle struct {
+	Files  []ContextFile `json:"files"`
+	Prompt string        `json:"prompt"`
+	Tokens int           `json:"tokens"`
+}
+
+// Message represents a single turn in a conversation with the model
+type Message struct {
+	Role    string // "user" or "assistant"
+	Content string
+
+	ToolCalls   []ToolCall   // Set on assistant turns that call tools
+	ToolResults []ToolResult // Set on user turns answering those calls
+}
+
+// ToolDefinition describes a function the model may call
+type ToolDefinition struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // JSON schema of the arguments object
+}
+
+// ToolCall is a model's request to run a tool
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// ToolResult is the output of a tool call sent back to the model
+type ToolResult struct {
+	CallID  string `json:"callId"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	IsError bool   `json:"isError,omitempty"`
+}
+
+// Conversation holds metadata about a persisted chat conversation
+type Conversation struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	MessageCount int       `json:"messageCount"`
+}
+
+// ConversationMessage is a stored turn of a conversation
+type ConversationMessage struct {
+	Index      int       `json:"index"`
+	Role       string    `json:"role"`
+	Content    string    `json:"content"`
+	TokenCount int       `json:"tokenCount"`
+	Timestamp  time.Time `json:"timestamp"`
+	Metadata   string    `json:"metadata,omitempty"`
 }
@@ -0,0 +1,313 @@
+package ai
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"glask-ide/internal/storage"
+)
+
+// ErrBudgetExceeded is returned when a daily or monthly spend cap has been reached
+var ErrBudgetExceeded = errors.New("AI usage budget exceeded")
+
+// ErrInvalidUsageQuery is returned for an unknown summary grouping or negative limits
+var ErrInvalidUsageQuery = errors.New("invalid usage query")
+
+// ModelPrice is what a model costs in USD per million tokens
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// modelPrices is used to estimate the cost of each request
+var modelPrices = map[string]ModelPrice{
+	"claude-3-haiku-20240307": {Input: 0.25, Output: 1.25},
+	"gemini-pro":              {Input: 0.50, Output: 1.50},
+}
+
+const usageSchema = `
+CREATE TABLE IF NOT EXISTS ai_usage (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME NOT NULL,
+	model TEXT NOT NULL,
+	project TEXT NOT NULL DEFAULT '',
+	feature TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT '',
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	total_tokens INTEGER NOT NULL DEFAULT 0,
+	latency_ms INTEGER NOT NULL DEFAULT 0,
+	cost REAL NOT NULL DEFAULT 0,
+	estimated BOOLEAN NOT NULL DEFAULT 0
+)`
+
+const usageTimestampIndex = `CREATE INDEX IF NOT EXISTS idx_usage_timestamp ON ai_usage(timestamp)`
+
+const usageLimitsSchema = `
+CREATE TABLE IF NOT EXISTS ai_usage_limits (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	daily_cost REAL NOT NULL DEFAULT 0,
+	monthly_cost REAL NOT NULL DEFAULT 0
+)`
+
+// usageGroups maps a summary grouping to the column expression it groups by
+var usageGroups = map[string]string{
+	"day":     "date(timestamp, 'localtime')",
+	"model":   "model",
+	"feature": "feature",
+	"project": "project",
+}
+
+// UsageRecord is the usage of a single model request
+type UsageRecord struct {
+	Timestamp        time.Time
+	Model            string
+	Project          string
+	Feature          string // "complete", "stream", "chat", "inline", "generate", "refactor", "analyze", "agent"
+	Status           string // "succeeded", "failed", "cancelled"
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Latency          time.Duration
+	Cost             float64 // Estimated from the price table, in USD
+	Estimated        bool    // Token counts are local estimates, e.g. for streams
+}
+
+// UsageSummaryRequest selects and groups usage records
+type UsageSummaryRequest struct {
+	GroupBy string    // "day", "model", "feature" or "project"
+	From    time.Time // Inclusive; unbounded when zero
+	To      time.Time // Exclusive; unbounded when zero
+	Project string    // All projects when empty
+}
+
+// UsageSummaryRow aggregates the usage of one group
+type UsageSummaryRow struct {
+	Key              string
+	Requests         int
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	Cost             float64
+	AvgLatency       time.Duration
+}
+
+// UsageSummary is usage grouped by day, model, feature or project
+type UsageSummary struct {
+	Rows  []UsageSummaryRow
+	Total UsageSummaryRow
+}
+
+// UsageLimits caps spend in USD; a zero limit means no cap
+type UsageLimits struct {
+	DailyCost   float64
+	MonthlyCost float64
+}
+
+// UsageStatus is the configured limits together with the current spend
+type UsageStatus struct {
+	Limits       UsageLimits
+	DailySpend   float64
+	MonthlySpend float64
+}
+
+// UsageStore records model usage in SQLite and enforces spend limits
+type UsageStore struct {
+	db *sql.DB
+
+	mu     sync.RWMutex
+	limits UsageLimits
+}
+
+// NewUsageStore creates a usage store, creating its tables if needed
+func NewUsageStore(db *sql.DB) (*UsageStore, error) {
+	if err := storage.Migrate(db, usageSchema, usageTimestampIndex, usageLimitsSchema); err != nil {
+		return nil, err
+	}
+
+	store := &UsageStore{db: db}
+	err := db.QueryRow(`SELECT daily_cost, monthly_cost FROM ai_usage_limits WHERE id = 1`).
+		Scan(&store.limits.DailyCost, &store.limits.MonthlyCost)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to load usage limits: %w", err)
+	}
+	return store, nil
+}
+
+// Record stores the usage of a request, pricing it from the price table
+func (s *UsageStore) Record(rec UsageRecord) error {
+	if rec.TotalTokens == 0 {
+		rec.TotalTokens = rec.PromptTokens + rec.CompletionTokens
+	}
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+	rec.Cost = requestCost(rec.Model, rec.PromptTokens, rec.CompletionTokens)
+
+	if _, err := s.db.Exec(`
+		INSERT INTO ai_usage (timestamp, model, project, feature, status, prompt_tokens, completion_tokens,
+			total_tokens, latency_ms, cost, estimated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.Timestamp.UTC(), rec.Model, rec.Project, rec.Feature, rec.Status, rec.PromptTokens,
+		rec.CompletionTokens, rec.TotalTokens, rec.Latency.Milliseconds(), rec.Cost, rec.Estimated,
+	); err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// Summary aggregates usage by the requested grouping, most expensive groups first
+func (s *UsageStore) Summary(req UsageSummaryRequest) (*UsageSummary, error) {
+	if req.GroupBy == "" {
+		req.GroupBy = "day"
+	}
+	group, ok := usageGroups[req.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot group by %q", ErrInvalidUsageQuery, req.GroupBy)
+	}
+
+	where, args := usageWhere(req)
+	order := "cost DESC"
+	if req.GroupBy == "day" {
+		order = "key"
+	}
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT %s AS key, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens),
+			SUM(cost) AS cost, AVG(latency_ms)
+		FROM ai_usage %s
+		GROUP BY key
+		ORDER BY %s`, group, where, order), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize usage: %w", err)
+	}
+	defer rows.Close()
+
+	summary := &UsageSummary{Rows: []UsageSummaryRow{}, Total: UsageSummaryRow{Key: "total"}}
+	var latencyTotal float64
+	for rows.Next() {
+		var (
+			row     UsageSummaryRow
+			latency float64
+		)
+		if err := rows.Scan(&row.Key, &row.Requests, &row.PromptTokens, &row.CompletionTokens,
+			&row.TotalTokens, &row.Cost, &latency); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		row.AvgLatency = time.Duration(latency) * time.Millisecond
+		summary.Rows = append(summary.Rows, row)
+
+		summary.Total.Requests += row.Requests
+		summary.Total.PromptTokens += row.PromptTokens
+		summary.Total.CompletionTokens += row.CompletionTokens
+		summary.Total.TotalTokens += row.TotalTokens
+		summary.Total.Cost += row.Cost
+		latencyTotal += latency * float64(row.Requests)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to summarize usage: %w", err)
+	}
+	if summary.Total.Requests > 0 {
+		summary.Total.AvgLatency = time.Duration(latencyTotal/float64(summary.Total.Requests)) * time.Millisecond
+	}
+
+	return summary, nil
+}
+
+// Limits returns the configured spend caps
+func (s *UsageStore) Limits() UsageLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limits
+}
+
+// SetLimits stores new spend caps
+func (s *UsageStore) SetLimits(limits UsageLimits) error {
+	if limits.DailyCost < 0 || limits.MonthlyCost < 0 {
+		return fmt.Errorf("%w: limits cannot be negative", ErrInvalidUsageQuery)
+	}
+
+	if _, err := s.db.Exec(`
+		INSERT INTO ai_usage_limits (id, daily_cost, monthly_cost) VALUES (1, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET daily_cost = excluded.daily_cost, monthly_cost = excluded.monthly_cost`,
+		limits.DailyCost, limits.MonthlyCost,
+	); err != nil {
+		return fmt.Errorf("failed to save usage limits: %w", err)
+	}
+
+	s.mu.Lock()
+	s.limits = limits
+	s.mu.Unlock()
+	return nil
+}
+
+// Status returns the limits with today's and this month's spend
+func (s *UsageStore) Status() (*UsageStatus, error) {
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	status := &UsageStatus{Limits: s.Limits()}
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN timestamp >= ? THEN cost END), 0), COALESCE(SUM(cost), 0)
+		FROM ai_usage WHERE timestamp >= ?`,
+		day.UTC(), month.UTC(),
+	).Scan(&status.DailySpend, &status.MonthlySpend); err != nil {
+		return nil, fmt.Errorf("failed to load usage spend: %w", err)
+	}
+	return status, nil
+}
+
+// CheckLimits fails with ErrBudgetExceeded once a spend cap has been reached
+func (s *UsageStore) CheckLimits() error {
+	limits := s.Limits()
+	if limits.DailyCost <= 0 && limits.MonthlyCost <= 0 {
+		return nil
+	}
+
+	status, err := s.Status()
+	if err != nil {
+		return err
+	}
+	if limits.DailyCost > 0 && status.DailySpend >= limits.DailyCost {
+		return fmt.Errorf("%w: spent $%.4f of the $%.4f daily limit", ErrBudgetExceeded, status.DailySpend, limits.DailyCost)
+	}
+	if limits.MonthlyCost > 0 && status.MonthlySpend >= limits.MonthlyCost {
+		return fmt.Errorf("%w: spent $%.4f of the $%.4f monthly limit", ErrBudgetExceeded, status.MonthlySpend, limits.MonthlyCost)
+	}
+	return nil
+}
+
+// usageWhere builds the filter clause of a summary query
+func usageWhere(req UsageSummaryRequest) (string, []any) {
+	var (
+		clauses []string
+		args    []any
+	)
+	if !req.From.IsZero() {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, req.From.UTC())
+	}
+	if !req.To.IsZero() {
+		clauses = append(clauses, "timestamp < ?")
+		args = append(args, req.To.UTC())
+	}
+	if req.Project != "" {
+		clauses = append(clauses, "project = ?")
+		args = append(args, req.Project)
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// requestCost estimates the cost of a request in USD
+func requestCost(model string, promptTokens, completionTokens int) float64 {
+	price := modelPrices[model]
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	pb "glask-ide/internal/ai/proto"
 
 	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var upgrader = websocket.Upgrader{
@@ -17,6 +25,50 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// textRangeRequest is the JSON form of a text range (1-based lines and columns)
+type textRangeRequest struct {
+	StartLine   int32 `json:"startLine"`
+	StartColumn int32 `json:"startColumn"`
+	EndLine     int32 `json:"endLine"`
+	EndColumn   int32 `json:"endColumn"`
+}
+
+func (r *textRangeRequest) toProto() *pb.TextRange {
+	if r == nil {
+		return nil
+	}
+	return &pb.TextRange{
+		StartLine:   r.StartLine,
+		StartColumn: r.StartColumn,
+		EndLine:     r.EndLine,
+		EndColumn:   r.EndColumn,
+	}
+}
+
+// editorContextRequest is the JSON form of the editor state sent with AI requests
+type editorContextRequest struct {
+	FilePath     string            `json:"filePath"`
+	ProjectPath  string            `json:"projectPath,omitempty"`
+	Language     string            `json:"language,omitempty"`
+	CursorLine   int32             `json:"cursorLine,omitempty"`
+	CursorColumn int32             `json:"cursorColumn,omitempty"`
+	Selection    *textRangeRequest `json:"selection,omitempty"`
+}
+
+func (e *editorContextRequest) toProto() *pb.EditorContext {
+	if e == nil {
+		return nil
+	}
+	return &pb.EditorContext{
+		FilePath:     e.FilePath,
+		ProjectPath:  e.ProjectPath,
+		Language:     e.Language,
+		CursorLine:   e.CursorLine,
+		CursorColumn: e.CursorColumn,
+		Selection:    e.Selection.toProto(),
+	}
+}
+
 type AIHandler struct {
 	aiService pb.AIServiceClient
 }
@@ -35,12 +87,19 @@ func (h *AIHandler) HandleComplete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Prompt        string   `json:"prompt"`
-		MaxTokens     *int32   `json:"maxTokens,omitempty"`
-		Temperature   *float32 `json:"temperature,omitempty"`
-		StopSequences []string `json:"stopSequences,omitempty"`
-		TopP          *float32 `json:"topP,omitempty"`
-		TopK          *int32   `json:"topK,omitempty"`
+		Prompt        string                `json:"prompt"`
+		MaxTokens     *int32                `json:"maxTokens,omitempty"`
+		Temperature   *float32              `json:"temperature,omitempty"`
+		StopSequences []string              `json:"stopSequences,omitempty"`
+		TopP          *float32              `json:"topP,omitempty"`
+		TopK          *int32                `json:"topK,omitempty"`
+		Editor        *editorContextRequest `json:"editor,omitempty"`
+		ContextBudget *int32                `json:"contextBudget,omitempty"`
+		ModelID       string                `json:"modelId,omitempty"`
+		SessionID     string                `json:"sessionId,omitempty"`
+		NoCache       bool                  `json:"noCache,omitempty"`
+		Template      string                `json:"template,omitempty"`
+		TemplateVars  map[string]string     `json:"templateVars,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -56,12 +115,19 @@ func (h *AIHandler) HandleComplete(w http.ResponseWriter, r *http.Request) {
 		StopSequences: req.StopSequences,
 		TopP:          req.TopP,
 		TopK:          req.TopK,
+		Editor:        req.Editor.toProto(),
+		ContextBudget: req.ContextBudget,
+		ModelId:       req.ModelID,
+		SessionId:     req.SessionID,
+		NoCache:       req.NoCache,
+		Template:      req.Template,
+		TemplateVars:  req.TemplateVars,
 	}
 
 	// Call gRPC service
 	resp, err := h.aiService.Complete(r.Context(), grpcReq)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGRPCError(w, err)
 		return
 	}
 
@@ -69,7 +135,39 @@ func (h *AIHandler) HandleComplete(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// HandleStream handles streaming completion requests via WebSocket
+// maxStreamRequests bounds the requests running at once on one stream connection
+const maxStreamRequests = 8
+
+// streamMessage is a frame sent by the client on /api/ai/stream
+type streamMessage struct {
+	Type string `json:"type"` // "start" (the default), "cancel" or "ping"
+	ID   string `json:"id"`   // Client-chosen ID of the request the frame belongs to
+
+	// Completion parameters of a "start" frame
+	Prompt        string                `json:"prompt"`
+	MaxTokens     *int32                `json:"maxTokens,omitempty"`
+	Temperature   *float32              `json:"temperature,omitempty"`
+	StopSequences []string              `json:"stopSequences,omitempty"`
+	TopP          *float32              `json:"topP,omitempty"`
+	TopK          *int32                `json:"topK,omitempty"`
+	Editor        *editorContextRequest `json:"editor,omitempty"`
+	ContextBudget *int32                `json:"contextBudget,omitempty"`
+	ModelID       string                `json:"modelId,omitempty"`
+	SessionID     string                `json:"sessionId,omitempty"`
+	Template      string                `json:"template,omitempty"`
+	TemplateVars  map[string]string     `json:"templateVars,omitempty"`
+}
+
+// streamFrame is a chunk of one request's stream, tagged with the request ID
+type streamFrame struct {
+	ID string `json:"id"`
+	*pb.CompletionChunk
+}
+
+// HandleStream runs streaming completions over a WebSocket. Clients start
+// requests under their own IDs, may run several at once, cancel them and
+// ping the connection. Every request ends with a "summary" frame carrying
+// its metrics and stop reason.
 func (h *AIHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
 	// Upgrade to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -79,14 +177,316 @@ func (h *AIHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
+	ctx, cancel := context.WithCancel(r.Context())
+	var (
+		writeMu  sync.Mutex
+		mu       sync.Mutex
+		requests = make(map[string]context.CancelFunc)
+		wg       sync.WaitGroup
+	)
+	defer func() {
+		// Stop whatever the client left running before closing the connection
+		cancel()
+		wg.Wait()
+	}()
+
+	writeJSON := func(v any) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(v)
+	}
+	writeError := func(id, message string) {
+		writeJSON(map[string]string{"id": id, "error": message})
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return // Client went away
+		}
+		var msg streamMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			writeError("", "Invalid request")
+			continue
+		}
+
+		switch msg.Type {
+		case "", "start":
+			mu.Lock()
+			_, running := requests[msg.ID]
+			full := len(requests) >= maxStreamRequests
+			var reqCtx context.Context
+			if !running && !full {
+				var reqCancel context.CancelFunc
+				reqCtx, reqCancel = context.WithCancel(ctx)
+				requests[msg.ID] = reqCancel
+			}
+			mu.Unlock()
+
+			if running {
+				writeError(msg.ID, "A request with this ID is already running")
+				continue
+			}
+			if full {
+				writeError(msg.ID, "Too many requests running on this connection")
+				continue
+			}
+
+			grpcReq := &pb.CompletionRequest{
+				Prompt:        msg.Prompt,
+				MaxTokens:     msg.MaxTokens,
+				Temperature:   msg.Temperature,
+				StopSequences: msg.StopSequences,
+				TopP:          msg.TopP,
+				TopK:          msg.TopK,
+				Stream:        ptr(true),
+				Editor:        msg.Editor.toProto(),
+				ContextBudget: msg.ContextBudget,
+				ModelId:       msg.ModelID,
+				SessionId:     msg.SessionID,
+				Template:      msg.Template,
+				TemplateVars:  msg.TemplateVars,
+			}
+			id := msg.ID
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.runStream(reqCtx, id, grpcReq, writeJSON, func() {
+					mu.Lock()
+					requests[id]()
+					delete(requests, id)
+					mu.Unlock()
+				})
+			}()
+
+		case "cancel":
+			mu.Lock()
+			reqCancel, ok := requests[msg.ID]
+			mu.Unlock()
+			if !ok {
+				writeError(msg.ID, "No request with this ID is running")
+				continue
+			}
+			// Cancelling the context aborts the provider request; the stream
+			// then ends with a "cancelled" summary
+			reqCancel()
+
+		case "ping":
+			writeJSON(map[string]string{"type": "pong", "id": msg.ID})
+
+		default:
+			writeError(msg.ID, "Unknown message type")
+		}
+	}
+}
+
+// runStream streams one request to the client. finish is called once the
+// request is over, before its summary is sent, so the ID can be reused as
+// soon as the client sees the summary.
+func (h *AIHandler) runStream(ctx context.Context, id string, req *pb.CompletionRequest, writeJSON func(any) error, finish func()) {
+	startTime := time.Now()
+
+	var summary *pb.CompletionChunk
+	stream, err := h.aiService.StreamComplete(ctx, req)
+	for err == nil {
+		var chunk *pb.CompletionChunk
+		if chunk, err = stream.Recv(); err != nil {
+			break
+		}
+		// The summary goes out last, after any error that ended the stream
+		if chunk.Type == "summary" {
+			summary = chunk
+			continue
+		}
+		if writeJSON(streamFrame{ID: id, CompletionChunk: chunk}) != nil {
+			break
+		}
+	}
+	cancelled := ctx.Err() != nil
+	finish()
+
+	stopReason := "end"
+	switch {
+	case cancelled:
+		stopReason = "cancelled"
+	case err != nil && err != io.EOF:
+		stopReason = "error"
+		if st, ok := status.FromError(err); ok {
+			writeJSON(map[string]string{"id": id, "error": st.Message()})
+		}
+	}
+	if summary == nil {
+		// The stream ended before the service could summarize it
+		summary = &pb.CompletionChunk{
+			Type:      "summary",
+			Timestamp: time.Now().UnixMilli(),
+			Summary: &pb.StreamSummary{
+				StopReason: stopReason,
+				Metrics:    &pb.CompletionMetrics{TotalTimeMs: time.Since(startTime).Milliseconds()},
+			},
+		}
+	}
+	writeJSON(streamFrame{ID: id, CompletionChunk: summary})
+}
+
+// HandleGetModels returns available models with the session's active model
+func (h *AIHandler) HandleGetModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := h.aiService.GetModels(r.Context(), &pb.GetModelsRequest{
+		SessionId: r.URL.Query().Get("session_id"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleSetActiveModel changes a session's model, or the global one without a session
+func (h *AIHandler) HandleSetActiveModel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ModelID   string `json:"modelId"`
+		SessionID string `json:"sessionId,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.SetActiveModel(r.Context(), &pb.SetActiveModelRequest{
+		ModelId:   req.ModelID,
+		SessionId: req.SessionID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleConversations lists (GET), creates (POST) or deletes (DELETE) conversations
+func (h *AIHandler) HandleConversations(w http.ResponseWriter, r *http.Request) {
+	var (
+		resp interface{}
+		err  error
+	)
+
+	switch r.Method {
+	case http.MethodGet:
+		resp, err = h.aiService.ListConversations(r.Context(), &pb.ListConversationsRequest{})
+	case http.MethodPost:
+		var req struct {
+			Title string `json:"title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.aiService.CreateConversation(r.Context(), &pb.CreateConversationRequest{Title: req.Title})
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Conversation ID is required", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.aiService.DeleteConversation(r.Context(), &pb.DeleteConversationRequest{ConversationId: id})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleConversationMessages returns a conversation's history (GET) or appends a message to it (POST)
+func (h *AIHandler) HandleConversationMessages(w http.ResponseWriter, r *http.Request) {
+	var (
+		resp interface{}
+		err  error
+	)
+
+	switch r.Method {
+	case http.MethodGet:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Conversation ID is required", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.aiService.GetConversation(r.Context(), &pb.GetConversationRequest{ConversationId: id})
+	case http.MethodPost:
+		var req struct {
+			ConversationID string `json:"conversationId"`
+			Role           string `json:"role"`
+			Content        string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.aiService.AppendMessage(r.Context(), &pb.AppendMessageRequest{
+			ConversationId: req.ConversationID,
+			Role:           req.Role,
+			Content:        req.Content,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleChat sends a chat message and streams the reply via WebSocket
+func (h *AIHandler) HandleChat(w http.ResponseWriter, r *http.Request) {
+	// Upgrade to WebSocket
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
 	// Read request from WebSocket
 	var req struct {
-		Prompt        string   `json:"prompt"`
-		MaxTokens     *int32   `json:"maxTokens,omitempty"`
-		Temperature   *float32 `json:"temperature,omitempty"`
-		StopSequences []string `json:"stopSequences,omitempty"`
-		TopP          *float32 `json:"topP,omitempty"`
-		TopK          *int32   `json:"topK,omitempty"`
+		ConversationID string                `json:"conversationId"`
+		Message        string                `json:"message"`
+		MaxTokens      *int32                `json:"maxTokens,omitempty"`
+		Temperature    *float32              `json:"temperature,omitempty"`
+		StopSequences  []string              `json:"stopSequences,omitempty"`
+		TopP           *float32              `json:"topP,omitempty"`
+		TopK           *int32                `json:"topK,omitempty"`
+		Editor         *editorContextRequest `json:"editor,omitempty"`
+		ContextBudget  *int32                `json:"contextBudget,omitempty"`
+		ModelID        string                `json:"modelId,omitempty"`
+		SessionID      string                `json:"sessionId,omitempty"`
+		Template       string                `json:"template,omitempty"`
+		TemplateVars   map[string]string     `json:"templateVars,omitempty"`
 	}
 
 	if err := conn.ReadJSON(&req); err != nil {
@@ -94,19 +494,21 @@ func (h *AIHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert to gRPC request
-	grpcReq := &pb.CompletionRequest{
-		Prompt:        req.Prompt,
-		MaxTokens:     req.MaxTokens,
-		Temperature:   req.Temperature,
-		StopSequences: req.StopSequences,
-		TopP:          req.TopP,
-		TopK:          req.TopK,
-		Stream:        ptr(true),
-	}
-
-	// Start streaming
-	stream, err := h.aiService.StreamComplete(r.Context(), grpcReq)
+	stream, err := h.aiService.Chat(r.Context(), &pb.ChatRequest{
+		ConversationId: req.ConversationID,
+		Message:        req.Message,
+		MaxTokens:      req.MaxTokens,
+		Temperature:    req.Temperature,
+		StopSequences:  req.StopSequences,
+		TopP:           req.TopP,
+		TopK:           req.TopK,
+		Editor:         req.Editor.toProto(),
+		ContextBudget:  req.ContextBudget,
+		ModelId:        req.ModelID,
+		SessionId:      req.SessionID,
+		Template:       req.Template,
+		TemplateVars:   req.TemplateVars,
+	})
 	if err != nil {
 		conn.WriteJSON(map[string]string{"error": err.Error()})
 		return
@@ -116,6 +518,9 @@ func (h *AIHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
 	for {
 		chunk, err := stream.Recv()
 		if err != nil {
+			if st, ok := status.FromError(err); ok && st.Code() != codes.OK {
+				conn.WriteJSON(map[string]string{"error": st.Message()})
+			}
 			break
 		}
 
@@ -129,16 +534,140 @@ func (h *AIHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleGetModels returns available models
-func (h *AIHandler) HandleGetModels(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// HandleAgent runs an agent over WebSocket. The first message starts the run;
+// later messages cancel it or answer approval requests while events stream back.
+func (h *AIHandler) HandleAgent(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	var req struct {
+		Task           string                `json:"task"`
+		ProjectPath    string                `json:"projectPath,omitempty"`
+		ConversationID string                `json:"conversationId,omitempty"`
+		Editor         *editorContextRequest `json:"editor,omitempty"`
+		MaxSteps       *int32                `json:"maxSteps,omitempty"`
+		ModelID        string                `json:"modelId,omitempty"`
+		SessionID      string                `json:"sessionId,omitempty"`
+		Template       string                `json:"template,omitempty"`
+		TemplateVars   map[string]string     `json:"templateVars,omitempty"`
+	}
+
+	if err := conn.ReadJSON(&req); err != nil {
+		conn.WriteJSON(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err := h.aiService.RunAgent(ctx, &pb.AgentRequest{
+		Task:           req.Task,
+		ProjectPath:    req.ProjectPath,
+		ConversationId: req.ConversationID,
+		Editor:         req.Editor.toProto(),
+		MaxSteps:       req.MaxSteps,
+		ModelId:        req.ModelID,
+		SessionId:      req.SessionID,
+		Template:       req.Template,
+		TemplateVars:   req.TemplateVars,
+	})
+	if err != nil {
+		conn.WriteJSON(map[string]string{"error": err.Error()})
+		return
+	}
+
+	var (
+		writeMu sync.Mutex
+		runID   atomic.Value
+	)
+	writeJSON := func(v any) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(v)
+	}
+
+	// Handle control messages from the client
+	go func() {
+		for {
+			var msg struct {
+				Type     string `json:"type"` // "cancel" or "approve"
+				CallID   string `json:"callId,omitempty"`
+				Approved bool   `json:"approved,omitempty"`
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				cancel() // Client went away
+				return
+			}
+
+			id, _ := runID.Load().(string)
+			var err error
+			switch msg.Type {
+			case "cancel":
+				_, err = h.aiService.CancelAgent(ctx, &pb.CancelAgentRequest{RunId: id})
+			case "approve":
+				_, err = h.aiService.ApproveAgentAction(ctx, &pb.ApproveAgentActionRequest{
+					RunId:    id,
+					CallId:   msg.CallID,
+					Approved: msg.Approved,
+				})
+			default:
+				writeJSON(map[string]string{"error": "Unknown message type"})
+				continue
+			}
+			if st, ok := status.FromError(err); ok && st.Code() != codes.OK {
+				writeJSON(map[string]string{"error": st.Message()})
+			}
+		}
+	}()
+
+	// Stream events back to WebSocket
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if st, ok := status.FromError(err); ok && st.Code() != codes.OK && st.Code() != codes.Canceled {
+				writeJSON(map[string]string{"error": st.Message()})
+			}
+			break
+		}
+
+		if event.Type == "started" {
+			runID.Store(event.RunId)
+		}
+		if err := writeJSON(event); err != nil {
+			break
+		}
+	}
+}
+
+// HandleBuildContext previews the workspace context for an editor position
+func (h *AIHandler) HandleBuildContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	resp, err := h.aiService.GetModels(r.Context(), &pb.GetModelsRequest{})
+	var req struct {
+		Editor    *editorContextRequest `json:"editor"`
+		Budget    *int32                `json:"budget,omitempty"`
+		SessionID string                `json:"sessionId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Editor == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.BuildContext(r.Context(), &pb.BuildContextRequest{
+		Editor:    req.Editor.toProto(),
+		Budget:    req.Budget,
+		SessionId: req.SessionID,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGRPCError(w, err)
 		return
 	}
 
@@ -146,15 +675,21 @@ func (h *AIHandler) HandleGetModels(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// HandleSetActiveModel changes the active model
-func (h *AIHandler) HandleSetActiveModel(w http.ResponseWriter, r *http.Request) {
+// HandleCompleteInline returns an inline code suggestion for the cursor position
+func (h *AIHandler) HandleCompleteInline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		ModelID string `json:"modelId"`
+		SessionID string `json:"sessionId"`
+		FilePath  string `json:"filePath"`
+		Language  string `json:"language"`
+		Prefix    string `json:"prefix"`
+		Suffix    string `json:"suffix"`
+		MaxTokens *int32 `json:"maxTokens,omitempty"`
+		ModelID   string `json:"modelId,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -162,11 +697,424 @@ func (h *AIHandler) HandleSetActiveModel(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	resp, err := h.aiService.SetActiveModel(r.Context(), &pb.SetActiveModelRequest{
-		ModelId: req.ModelID,
+	resp, err := h.aiService.CodeComplete(r.Context(), &pb.CodeCompleteRequest{
+		SessionId: req.SessionID,
+		FilePath:  req.FilePath,
+		Language:  req.Language,
+		Prefix:    req.Prefix,
+		Suffix:    req.Suffix,
+		MaxTokens: req.MaxTokens,
+		ModelId:   req.ModelID,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleGenerate generates code for a prompt and returns it as previewable edits
+func (h *AIHandler) HandleGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Prompt       string                `json:"prompt"`
+		FilePath     string                `json:"filePath"`
+		Language     string                `json:"language"`
+		Editor       *editorContextRequest `json:"editor,omitempty"`
+		ModelID      string                `json:"modelId,omitempty"`
+		SessionID    string                `json:"sessionId,omitempty"`
+		Template     string                `json:"template,omitempty"`
+		TemplateVars map[string]string     `json:"templateVars,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.Generate(r.Context(), &pb.GenerateRequest{
+		Prompt:       req.Prompt,
+		FilePath:     req.FilePath,
+		Language:     req.Language,
+		Editor:       req.Editor.toProto(),
+		ModelId:      req.ModelID,
+		SessionId:    req.SessionID,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleRefactor refactors existing code and returns the change as previewable edits
+func (h *AIHandler) HandleRefactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		FilePath     string                `json:"filePath"`
+		Selection    *textRangeRequest     `json:"selection,omitempty"`
+		Instruction  string                `json:"instruction"`
+		Editor       *editorContextRequest `json:"editor,omitempty"`
+		ModelID      string                `json:"modelId,omitempty"`
+		SessionID    string                `json:"sessionId,omitempty"`
+		Template     string                `json:"template,omitempty"`
+		TemplateVars map[string]string     `json:"templateVars,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.Refactor(r.Context(), &pb.RefactorRequest{
+		FilePath:     req.FilePath,
+		Selection:    req.Selection.toProto(),
+		Instruction:  req.Instruction,
+		Editor:       req.Editor.toProto(),
+		ModelId:      req.ModelID,
+		SessionId:    req.SessionID,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleAnalyze reviews a file and returns its issues with suggested fixes
+func (h *AIHandler) HandleAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		FilePath     string                `json:"filePath"`
+		Code         string                `json:"code,omitempty"`
+		Editor       *editorContextRequest `json:"editor,omitempty"`
+		ModelID      string                `json:"modelId,omitempty"`
+		SessionID    string                `json:"sessionId,omitempty"`
+		NoCache      bool                  `json:"noCache,omitempty"`
+		Template     string                `json:"template,omitempty"`
+		TemplateVars map[string]string     `json:"templateVars,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.Analyze(r.Context(), &pb.AnalyzeRequest{
+		FilePath:     req.FilePath,
+		Code:         req.Code,
+		Editor:       req.Editor.toProto(),
+		ModelId:      req.ModelID,
+		SessionId:    req.SessionID,
+		NoCache:      req.NoCache,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleAnalyzeTerminal diagnoses the errors in a terminal's output and returns suggested fixes
+func (h *AIHandler) HandleAnalyzeTerminal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TerminalID   string                `json:"terminalId,omitempty"`
+		Output       string                `json:"output,omitempty"`
+		ProjectPath  string                `json:"projectPath,omitempty"`
+		Editor       *editorContextRequest `json:"editor,omitempty"`
+		ModelID      string                `json:"modelId,omitempty"`
+		SessionID    string                `json:"sessionId,omitempty"`
+		Template     string                `json:"template,omitempty"`
+		TemplateVars map[string]string     `json:"templateVars,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.AnalyzeTerminal(r.Context(), &pb.AnalyzeTerminalRequest{
+		TerminalId:   req.TerminalID,
+		Output:       req.Output,
+		ProjectPath:  req.ProjectPath,
+		Editor:       req.Editor.toProto(),
+		ModelId:      req.ModelID,
+		SessionId:    req.SessionID,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleGenerateDocs writes doc comments for a symbol, file or package and returns them as insert edits
+func (h *AIHandler) HandleGenerateDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		FilePath     string                `json:"filePath,omitempty"`
+		Symbol       string                `json:"symbol,omitempty"`
+		PackagePath  string                `json:"packagePath,omitempty"`
+		ProjectPath  string                `json:"projectPath,omitempty"`
+		Editor       *editorContextRequest `json:"editor,omitempty"`
+		ModelID      string                `json:"modelId,omitempty"`
+		SessionID    string                `json:"sessionId,omitempty"`
+		Template     string                `json:"template,omitempty"`
+		TemplateVars map[string]string     `json:"templateVars,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.GenerateDocs(r.Context(), &pb.GenerateDocsRequest{
+		FilePath:     req.FilePath,
+		Symbol:       req.Symbol,
+		PackagePath:  req.PackagePath,
+		ProjectPath:  req.ProjectPath,
+		Editor:       req.Editor.toProto(),
+		ModelId:      req.ModelID,
+		SessionId:    req.SessionID,
+		Template:     req.Template,
+		TemplateVars: req.TemplateVars,
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleApplyEdits applies a proposal or explicit edits as one undoable step
+func (h *AIHandler) HandleApplyEdits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ProposalID string `json:"proposalId"`
+		Edits      []struct {
+			FilePath string            `json:"filePath"`
+			Range    *textRangeRequest `json:"range"`
+			NewText  string            `json:"newText"`
+		} `json:"edits,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pbReq := &pb.ApplyEditsRequest{ProposalId: req.ProposalID}
+	for _, e := range req.Edits {
+		pbReq.Edits = append(pbReq.Edits, &pb.TextEdit{
+			FilePath: e.FilePath,
+			Range:    e.Range.toProto(),
+			NewText:  e.NewText,
+		})
+	}
+
+	resp, err := h.aiService.ApplyEdits(r.Context(), pbReq)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleUndoEdits reverts a previously applied edit set
+func (h *AIHandler) HandleUndoEdits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.aiService.UndoEdits(r.Context(), &pb.UndoEditsRequest{Id: req.ID})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// memoryRequest is the JSON body for creating or updating a memory
+type memoryRequest struct {
+	MemoryKey  string          `json:"memory_key"`
+	MemoryType string          `json:"memory_type"`
+	Project    string          `json:"project,omitempty"`
+	Content    string          `json:"content"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+}
+
+// HandleMemory lists and searches (GET), creates (POST), updates (PUT) and deletes (DELETE) AI memories
+func (h *AIHandler) HandleMemory(w http.ResponseWriter, r *http.Request) {
+	var (
+		resp interface{}
+		err  error
+	)
+
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		req := &pb.ListMemoriesRequest{
+			MemoryKey:  query.Get("memory_key"),
+			MemoryType: query.Get("memory_type"),
+			Project:    query.Get("project"),
+			Query:      query.Get("query"),
+		}
+		if limit, convErr := strconv.Atoi(query.Get("limit")); convErr == nil {
+			req.Limit = ptr(int32(limit))
+		}
+		resp, err = h.aiService.ListMemories(r.Context(), req)
+	case http.MethodPost:
+		var req memoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var memory *pb.Memory
+		memory, err = h.aiService.CreateMemory(r.Context(), &pb.CreateMemoryRequest{
+			MemoryKey:  req.MemoryKey,
+			MemoryType: req.MemoryType,
+			Project:    req.Project,
+			Content:    req.Content,
+			Metadata:   string(req.Metadata),
+		})
+		if err == nil {
+			resp = map[string]interface{}{"id": memory.Id, "success": true}
+		}
+	case http.MethodPut:
+		id, convErr := strconv.ParseInt(query.Get("id"), 10, 64)
+		if convErr != nil {
+			http.Error(w, "Memory ID is required", http.StatusBadRequest)
+			return
+		}
+		var req memoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.aiService.UpdateMemory(r.Context(), &pb.UpdateMemoryRequest{
+			Id:         id,
+			MemoryKey:  req.MemoryKey,
+			MemoryType: req.MemoryType,
+			Project:    req.Project,
+			Content:    req.Content,
+			Metadata:   string(req.Metadata),
+		})
+	case http.MethodDelete:
+		id, convErr := strconv.ParseInt(query.Get("id"), 10, 64)
+		if convErr != nil {
+			http.Error(w, "Memory ID is required", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.aiService.DeleteMemory(r.Context(), &pb.DeleteMemoryRequest{Id: id})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleCountTokens measures a prompt against a model's context window
+func (h *AIHandler) HandleCountTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Text     string `json:"text"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+		ModelID   string `json:"modelId"`
+		SessionID string `json:"sessionId"`
+		MaxTokens *int32 `json:"maxTokens,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	grpcReq := &pb.CountTokensRequest{
+		Text:      req.Text,
+		ModelId:   req.ModelID,
+		SessionId: req.SessionID,
+		MaxTokens: req.MaxTokens,
+	}
+	for _, msg := range req.Messages {
+		grpcReq.Messages = append(grpcReq.Messages, &pb.PromptMessage{Role: msg.Role, Content: msg.Content})
+	}
+
+	resp, err := h.aiService.CountTokens(r.Context(), grpcReq)
+	if err != nil {
+		writeGRPCError(w, err)
 		return
 	}
 
@@ -174,6 +1122,128 @@ func (h *AIHandler) HandleSetActiveModel(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(resp)
 }
 
+// HandleTemplates lists the prompt templates selectable for a project
+func (h *AIHandler) HandleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := h.aiService.ListPromptTemplates(r.Context(), &pb.ListPromptTemplatesRequest{
+		ProjectPath: r.URL.Query().Get("project_path"),
+	})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleUsage summarizes AI usage grouped by day, model, feature or project
+func (h *AIHandler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	req := &pb.UsageSummaryRequest{
+		GroupBy: query.Get("group_by"),
+		Project: query.Get("project"),
+	}
+
+	// Days are local dates; "to" includes the whole day
+	if from := query.Get("from"); from != "" {
+		day, err := time.ParseInLocation(time.DateOnly, from, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		req.From = day.Unix()
+	}
+	if to := query.Get("to"); to != "" {
+		day, err := time.ParseInLocation(time.DateOnly, to, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		req.To = day.AddDate(0, 0, 1).Unix()
+	}
+
+	resp, err := h.aiService.GetUsageSummary(r.Context(), req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleUsageLimits returns (GET) or changes (PUT) the AI spend limits
+func (h *AIHandler) HandleUsageLimits(w http.ResponseWriter, r *http.Request) {
+	var (
+		resp *pb.UsageLimits
+		err  error
+	)
+
+	switch r.Method {
+	case http.MethodGet:
+		resp, err = h.aiService.GetUsageLimits(r.Context(), &pb.GetUsageLimitsRequest{})
+	case http.MethodPut:
+		var req struct {
+			DailyCostLimit   float64 `json:"daily_cost_limit"`
+			MonthlyCostLimit float64 `json:"monthly_cost_limit"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.aiService.SetUsageLimits(r.Context(), &pb.SetUsageLimitsRequest{
+			DailyCostLimit:   req.DailyCostLimit,
+			MonthlyCostLimit: req.MonthlyCostLimit,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeGRPCError translates a gRPC status error into an HTTP error response
+func writeGRPCError(w http.ResponseWriter, err error) {
+	st, _ := status.FromError(err)
+
+	code := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.Canceled:
+		code = http.StatusConflict // Superseded by a newer request
+	case codes.FailedPrecondition:
+		code = http.StatusConflict // Files changed since the edits were computed
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests // Usage budget exceeded
+	case codes.Unavailable:
+		code = http.StatusBadGateway // Every capable provider failed
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout // Provider stopped responding
+	}
+
+	http.Error(w, st.Message(), code)
+}
+
 // Helper function to create bool pointer
 func ptr[T any](v T) *T {
 	return &v
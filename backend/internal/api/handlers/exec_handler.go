@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	pb "glask-ide/internal/terminal/proto"
+)
+
+// ExecHandler runs commands without a terminal, with their output captured
+type ExecHandler struct {
+	terminalService pb.TerminalServiceClient
+}
+
+func NewExecHandler(terminalService pb.TerminalServiceClient) *ExecHandler {
+	return &ExecHandler{
+		terminalService: terminalService,
+	}
+}
+
+// execRequest is the JSON form of a command to run
+type execRequest struct {
+	Command        string            `json:"command"`
+	Args           []string          `json:"args,omitempty"`
+	Cwd            string            `json:"cwd,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	TimeoutMs      int64             `json:"timeoutMs,omitempty"`
+	MaxOutputBytes int64             `json:"maxOutputBytes,omitempty"`
+}
+
+func (r *execRequest) toProto() *pb.ExecRequest {
+	return &pb.ExecRequest{
+		Command:        r.Command,
+		Args:           r.Args,
+		Cwd:            r.Cwd,
+		Env:            r.Env,
+		TimeoutMs:      r.TimeoutMs,
+		MaxOutputBytes: r.MaxOutputBytes,
+	}
+}
+
+// execOutput is a chunk of a command's stdout or stderr
+type execOutput struct {
+	Stream    string `json:"stream"`
+	Data      string `json:"data"`
+	Timestamp int64  `json:"timestamp"` // Unix milliseconds
+}
+
+// execExit is how a command finished
+type execExit struct {
+	ExitCode        int32  `json:"exitCode"`
+	Signal          string `json:"signal,omitempty"`
+	TimedOut        bool   `json:"timedOut,omitempty"`
+	Canceled        bool   `json:"canceled,omitempty"`
+	OutputTruncated bool   `json:"outputTruncated,omitempty"`
+	DurationMs      int64  `json:"durationMs"`
+}
+
+func fromPBExecExit(e *pb.ExecExit) execExit {
+	return execExit{
+		ExitCode:        e.GetExitCode(),
+		Signal:          e.GetSignal(),
+		TimedOut:        e.GetTimedOut(),
+		Canceled:        e.GetCanceled(),
+		OutputTruncated: e.GetOutputTruncated(),
+		DurationMs:      e.GetDurationMs(),
+	}
+}
+
+// execStdinChunk is how much of a request's stdin is sent in one message
+const execStdinChunk = 32 * 1024
+
+// HandleExec runs a command to completion and returns its output
+func (h *ExecHandler) HandleExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		execRequest
+		Stdin string `json:"stdin,omitempty"` // Sent before stdin is closed
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// The command is killed if the client goes away
+	stream, err := h.terminalService.Exec(r.Context())
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+	stream.Send(&pb.ExecInput{Type: "start", Request: req.toProto()})
+
+	// Send stdin while taking output, so a command that writes before it
+	// has read all its input doesn't wait on a full pipe
+	go func() {
+		for data := []byte(req.Stdin); len(data) > 0; {
+			n := min(len(data), execStdinChunk)
+			if err := stream.Send(&pb.ExecInput{Type: "stdin", Data: data[:n]}); err != nil {
+				return
+			}
+			data = data[n:]
+		}
+		stream.Send(&pb.ExecInput{Type: "close_stdin"})
+		stream.CloseSend()
+	}()
+
+	var resp struct {
+		execExit
+		Stdout string `json:"stdout"`
+		Stderr string `json:"stderr"`
+	}
+	var stdout, stderr strings.Builder
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			writeGRPCError(w, err)
+			return
+		}
+
+		switch event.Type {
+		case "output":
+			if event.Stream == "stderr" {
+				stderr.Write(event.Data)
+			} else {
+				stdout.Write(event.Data)
+			}
+		case "exit":
+			resp.execExit = fromPBExecExit(event.Exit)
+			resp.Stdout, resp.Stderr = stdout.String(), stderr.String()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+	}
+}
+
+// HandleExecStream runs a command over a WebSocket, streaming its output as
+// it is written and taking stdin and cancellation from the client
+func (h *ExecHandler) HandleExecStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Could not upgrade connection", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	var req execRequest
+	if err := conn.ReadJSON(&req); err != nil {
+		conn.WriteJSON(map[string]string{"error": "Invalid request"})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err := h.terminalService.Exec(ctx)
+	if err != nil {
+		conn.WriteJSON(map[string]string{"error": err.Error()})
+		return
+	}
+	stream.Send(&pb.ExecInput{Type: "start", Request: req.toProto()})
+
+	var writeMu sync.Mutex
+	writeJSON := func(v any) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(v)
+	}
+
+	// Handle input from the client
+	go func() {
+		for {
+			var msg struct {
+				Type string `json:"type"` // "stdin", "close_stdin" or "cancel"
+				Data string `json:"data,omitempty"`
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				cancel() // Client went away
+				return
+			}
+
+			switch msg.Type {
+			case "stdin":
+				stream.Send(&pb.ExecInput{Type: "stdin", Data: []byte(msg.Data)})
+			case "close_stdin", "cancel":
+				stream.Send(&pb.ExecInput{Type: msg.Type})
+			default:
+				writeJSON(map[string]string{"error": "Unknown message type"})
+			}
+		}
+	}()
+
+	// Stream output to the client until the command exits
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			writeJSON(map[string]string{"error": err.Error()})
+			return
+		}
+
+		switch event.Type {
+		case "output":
+			writeJSON(struct {
+				Type string `json:"type"`
+				execOutput
+			}{"output", execOutput{Stream: event.Stream, Data: string(event.Data), Timestamp: event.Timestamp}})
+		case "exit":
+			writeJSON(struct {
+				Type string `json:"type"`
+				execExit
+			}{"exit", fromPBExecExit(event.Exit)})
+			return
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package filesystem
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxIndexedFileSize is the largest file the indexer will parse
+const maxIndexedFileSize = 1 << 20
+
+// skippedDirs are directories that are never indexed
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"out":          true,
+	"target":       true,
+	"__pycache__":  true,
+}
+
+// LanguageForPath returns the language identifier for a file based on its extension
+func LanguageForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return "go"
+	case ".ts", ".tsx":
+		return "typescript"
+	case ".js", ".jsx", ".mjs", ".cjs":
+		return "javascript"
+	case ".py":
+		return "python"
+	case ".rs":
+		return "rust"
+	default:
+		return ""
+	}
+}
+
+// lineExtractor matches a single-line declaration and describes the symbol it declares
+type lineExtractor struct {
+	pattern *regexp.Regexp
+	kind    string
+}
+
+var (
+	jsImportPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*import\s+(?:[^'"]+\s+from\s+)?['"]([^'"]+)['"]`),
+		regexp.MustCompile(`^\s*export\s+[^'"]+\s+from\s+['"]([^'"]+)['"]`),
+		regexp.MustCompile(`require\(\s*['"]([^'"]+)['"]\s*\)`),
+	}
+	jsSymbolExtractors = []lineExtractor{
+		{regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+([A-Za-z_$][\w$]*)`), "function"},
+		{regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`), "class"},
+		{regexp.MustCompile(`^(?:export\s+)?interface\s+([A-Za-z_$][\w$]*)`), "interface"},
+		{regexp.MustCompile(`^(?:export\s+)?type\s+([A-Za-z_$][\w$]*)\s*(?:<[^=]*>)?\s*=`), "type"},
+		{regexp.MustCompile(`^(?:export\s+)?enum\s+([A-Za-z_$][\w$]*)`), "enum"},
+		{regexp.MustCompile(`^(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)`), "variable"},
+	}
+
+	pyImportPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*import\s+([\w.]+)`),
+		regexp.MustCompile(`^\s*from\s+([\w.]+)\s+import\s`),
+	}
+	pyClassPattern  = regexp.MustCompile(`^class\s+([A-Za-z_]\w*)`)
+	pyDefPattern    = regexp.MustCompile(`^(\s*)(?:async\s+)?def\s+([A-Za-z_]\w*)`)
+	pyAssignPattern = regexp.MustCompile(`^([A-Z_][A-Z0-9_]*)\s*=`)
+
+	rustImportPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*(?:pub\s+)?use\s+([\w:]+)`),
+		regexp.MustCompile(`^\s*(?:pub\s+)?mod\s+(\w+)\s*;`),
+	}
+	rustSymbolExtractors = []lineExtractor{
+		{regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:unsafe\s+)?(?:const\s+)?fn\s+(\w+)`), "function"},
+		{regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?struct\s+(\w+)`), "struct"},
+		{regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?enum\s+(\w+)`), "enum"},
+		{regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?trait\s+(\w+)`), "trait"},
+		{regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?type\s+(\w+)`), "type"},
+		{regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const|static)\s+(\w+)`), "constant"},
+	}
+)
+
+// extractMetadata parses a source file and returns its imports and symbols
+func extractMetadata(path string, content []byte) Metadata {
+	var meta Metadata
+	switch LanguageForPath(path) {
+	case "go":
+		meta = extractGoMetadata(path, content)
+	case "typescript", "javascript":
+		meta = extractLineMetadata(path, content, jsImportPatterns, jsSymbolExtractors)
+	case "python":
+		meta = extractPythonMetadata(path, content)
+	case "rust":
+		meta = extractLineMetadata(path, content, rustImportPatterns, rustSymbolExtractors)
+	}
+	meta.LastIndexed = time.Now()
+	return meta
+}
+
+// extractGoMetadata uses the Go parser to collect imports and top-level declarations
+func extractGoMetadata(path string, content []byte) Metadata {
+	var meta Metadata
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.ParseComments|parser.SkipObjectResolution)
+	if file == nil {
+		return meta
+	}
+	_ = err // Partial ASTs are still useful for indexing
+
+	for _, imp := range file.Imports {
+		meta.Imports = append(meta.Imports, strings.Trim(imp.Path.Value, `"`))
+	}
+
+	addSymbol := func(name *ast.Ident, kind, parent string) {
+		pos := fset.Position(name.Pos())
+		meta.Symbols = append(meta.Symbols, Symbol{
+			Name:   name.Name,
+			Kind:   kind,
+			Path:   path,
+			Line:   pos.Line,
+			Column: pos.Column,
+			Parent: parent,
+		})
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				addSymbol(d.Name, "method", receiverTypeName(d.Recv.List[0].Type))
+			} else {
+				addSymbol(d.Name, "function", "")
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					kind := "type"
+					switch sp.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+					}
+					addSymbol(sp.Name, kind, "")
+				case *ast.ValueSpec:
+					kind := "variable"
+					if d.Tok == token.CONST {
+						kind = "constant"
+					}
+					for _, name := range sp.Names {
+						if name.Name != "_" {
+							addSymbol(name, kind, "")
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return meta
+}
+
+// receiverTypeName returns the bare type name of a method receiver
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// extractLineMetadata scans a file line by line with regular expressions
+func extractLineMetadata(path string, content []byte, importPatterns []*regexp.Regexp, extractors []lineExtractor) Metadata {
+	var meta Metadata
+
+	for i, line := range strings.Split(string(content), "\n") {
+		for _, pattern := range importPatterns {
+			if m := pattern.FindStringSubmatch(line); m != nil {
+				meta.Imports = append(meta.Imports, m[1])
+				break
+			}
+		}
+
+		for _, ex := range extractors {
+			if loc := ex.pattern.FindStringSubmatchIndex(line); loc != nil {
+				meta.Symbols = append(meta.Symbols, Symbol{
+					Name:   line[loc[2]:loc[3]],
+					Kind:   ex.kind,
+					Path:   path,
+					Line:   i + 1,
+					Column: loc[2] + 1,
+				})
+				break
+			}
+		}
+	}
+
+	return meta
+}
+
+// extractPythonMetadata tracks class nesting so methods record their parent
+func extractPythonMetadata(path string, content []byte) Metadata {
+	var meta Metadata
+	currentClass := ""
+
+	for i, line := range strings.Split(string(content), "\n") {
+		for _, pattern := range pyImportPatterns {
+			if m := pattern.FindStringSubmatch(line); m != nil {
+				meta.Imports = append(meta.Imports, m[1])
+				break
+			}
+		}
+
+		// Any non-indented statement ends the current class body
+		if line != "" && line[0] != ' ' && line[0] != '\t' && !strings.HasPrefix(line, "#") {
+			currentClass = ""
+		}
+
+		if loc := pyClassPattern.FindStringSubmatchIndex(line); loc != nil {
+			currentClass = line[loc[2]:loc[3]]
+			meta.Symbols = append(meta.Symbols, Symbol{
+				Name: currentClass, Kind: "class", Path: path, Line: i + 1, Column: loc[2] + 1,
+			})
+			continue
+		}
+
+		if loc := pyDefPattern.FindStringSubmatchIndex(line); loc != nil {
+			indented := loc[3] > loc[2]
+			kind, parent := "function", ""
+			if indented {
+				if currentClass == "" {
+					continue // Nested helper functions are not indexed
+				}
+				kind, parent = "method", currentClass
+			}
+			meta.Symbols = append(meta.Symbols, Symbol{
+				Name: line[loc[4]:loc[5]], Kind: kind, Path: path, Line: i + 1, Column: loc[4] + 1, Parent: parent,
+			})
+			continue
+		}
+
+		if loc := pyAssignPattern.FindStringSubmatchIndex(line); loc != nil {
+			meta.Symbols = append(meta.Symbols, Symbol{
+				Name: line[loc[2]:loc[3]], Kind: "constant", Path: path, Line: i + 1, Column: 1,
+			})
+		}
+	}
+
+	return meta
+}
+
+// indexFile parses a file and stores its metadata in the in-memory index
+func (s *service) indexFile(path string) (Metadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	if info.IsDir() || info.Size() > maxIndexedFileSize || LanguageForPath(path) == "" {
+		return Metadata{LastIndexed: time.Now()}, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	meta := extractMetadata(path, content)
+	fileInfo := FileInfo{
+		Path:    path,
+		Name:    info.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime().Unix(),
+	}
+	for i := range meta.Symbols {
+		meta.Symbols[i].FileInfo = fileInfo
+	}
+
+	s.indexMutex.Lock()
+	s.index[path] = meta
+	s.indexMutex.Unlock()
+
+	return meta, nil
+}
+
+// indexDirectory indexes every supported source file below root and
+// remembers that the tree has been indexed
+func (s *service) indexDirectory(root string) error {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Keep indexing the rest of the tree
+		}
+
+		if info.IsDir() {
+			if path != root && (strings.HasPrefix(info.Name(), ".") || skippedDirs[info.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if LanguageForPath(path) == "" {
+			return nil
+		}
+
+		s.indexMutex.RLock()
+		existing, ok := s.index[path]
+		s.indexMutex.RUnlock()
+		if ok && !existing.LastIndexed.Before(info.ModTime()) {
+			return nil
+		}
+
+		_, err = s.indexFile(path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.indexMutex.Lock()
+	s.indexed[filepath.Clean(root)] = true
+	s.indexMutex.Unlock()
+	return nil
+}
+
+// isIndexed reports whether root's whole tree has been indexed, by itself or
+// as part of a directory above it. Files indexed one at a time, such as an
+// open editor's, don't count.
+func (s *service) isIndexed(root string) bool {
+	s.indexMutex.RLock()
+	defer s.indexMutex.RUnlock()
+
+	for dir := range s.indexed {
+		if isWithin(dir, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin reports whether path is root or lies below it
+func isWithin(root, path string) bool {
+	if root == "" {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -1,12 +1,16 @@
 package filesystem
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -17,8 +21,21 @@ type service struct {
 	callbacks  map[string][]func(FileInfo)
 	dirPaths   map[string]string // Maps directory names to their absolute paths
 	pathMutex  sync.RWMutex
+	index      map[string]Metadata // Maps file paths to their indexed metadata
+	indexed    map[string]bool     // Directories whose whole tree has been indexed
+	indexMutex sync.RWMutex
+	recent     []FileInfo // Recently written files, most recent first
+	recentMu   sync.Mutex
 }
 
+const (
+	// maxRecentFiles is the number of recently edited files remembered
+	maxRecentFiles = 50
+
+	// defaultMaxContentResults caps content search results when no limit is given
+	defaultMaxContentResults = 200
+)
+
 func NewService() (Service, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -30,6 +47,8 @@ func NewService() (Service, error) {
 		callbacks: make(map[string][]func(FileInfo)),
 		dirPaths:  make(map[string]string),
 		pathMutex: sync.RWMutex{},
+		index:     make(map[string]Metadata),
+		indexed:   make(map[string]bool),
 	}
 
 	// Start watching for filesystem events
@@ -150,7 +169,59 @@ func (s *service) WriteFile(path string, content []byte) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(absPath, content, 0644)
+	if err := os.WriteFile(absPath, content, 0644); err != nil {
+		return err
+	}
+
+	s.trackRecent(absPath, int64(len(content)))
+
+	// Keep the index fresh for files that were already indexed
+	s.indexMutex.RLock()
+	_, indexed := s.index[absPath]
+	s.indexMutex.RUnlock()
+	if indexed {
+		if _, err := s.indexFile(absPath); err != nil {
+			fmt.Printf("Error re-indexing %s: %v\n", absPath, err)
+		}
+	}
+
+	return nil
+}
+
+// trackRecent records a write so it shows up in RecentFiles
+func (s *service) trackRecent(path string, size int64) {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+
+	for i, f := range s.recent {
+		if f.Path == path {
+			s.recent = append(s.recent[:i], s.recent[i+1:]...)
+			break
+		}
+	}
+
+	s.recent = append([]FileInfo{{
+		Path:    path,
+		Name:    filepath.Base(path),
+		Size:    size,
+		ModTime: time.Now().Unix(),
+	}}, s.recent...)
+	if len(s.recent) > maxRecentFiles {
+		s.recent = s.recent[:maxRecentFiles]
+	}
+}
+
+// RecentFiles returns the most recently written files, newest first
+func (s *service) RecentFiles(limit int) []FileInfo {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+
+	if limit <= 0 || limit > len(s.recent) {
+		limit = len(s.recent)
+	}
+	files := make([]FileInfo, limit)
+	copy(files, s.recent[:limit])
+	return files
 }
 
 func (s *service) DeleteFile(path string) error {
@@ -299,16 +370,18 @@ func (s *service) SearchFiles(opts SearchOptions) ([]FileInfo, error) {
 		searchPath = "/" + opts.Path
 	}
 
+	errLimitReached := errors.New("result limit reached")
 	walkFn := func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
 
-		// Skip hidden files
-		if strings.HasPrefix(info.Name(), ".") {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
+		// Skip hidden files and dependency directories
+		hidden := strings.HasPrefix(info.Name(), ".") && !opts.IncludeHidden
+		if info.IsDir() && path != searchPath && (hidden || skippedDirs[info.Name()]) {
+			return filepath.SkipDir
+		}
+		if hidden || !matchesFilePatterns(info.Name(), opts.FilePatterns) {
 			return nil
 		}
 
@@ -320,11 +393,14 @@ func (s *service) SearchFiles(opts SearchOptions) ([]FileInfo, error) {
 			ModTime: info.ModTime().Unix(),
 			IsDir:   info.IsDir(),
 		})
+		if opts.MaxResults > 0 && len(results) >= opts.MaxResults {
+			return errLimitReached
+		}
 
 		return nil
 	}
 
-	if err := filepath.Walk(searchPath, walkFn); err != nil {
+	if err := filepath.Walk(searchPath, walkFn); err != nil && err != errLimitReached {
 		return nil, err
 	}
 
@@ -332,26 +408,170 @@ func (s *service) SearchFiles(opts SearchOptions) ([]FileInfo, error) {
 }
 
 func (s *service) SearchContent(opts SearchOptions) ([]Reference, error) {
-	// This will be implemented later when we add code indexing
-	return nil, nil
+	if opts.Query == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+
+	root := s.resolvePath(opts.Path)
+	query := strings.ToLower(opts.Query)
+	maxResults := opts.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultMaxContentResults
+	}
+
+	var results []Reference
+	errLimitReached := errors.New("result limit reached")
+
+	err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		hidden := strings.HasPrefix(info.Name(), ".") && !opts.IncludeHidden
+		if info.IsDir() {
+			if path != root && (hidden || skippedDirs[info.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hidden || info.Size() > maxIndexedFileSize || !matchesFilePatterns(info.Name(), opts.FilePatterns) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil || isBinary(content) {
+			return nil
+		}
+
+		lines := strings.Split(string(content), "\n")
+		for i, line := range lines {
+			col := strings.Index(strings.ToLower(line), query)
+			if col < 0 {
+				continue
+			}
+
+			// Include the surrounding lines as a snippet
+			start, end := max(i-1, 0), min(i+2, len(lines))
+			results = append(results, Reference{
+				Path:    path,
+				Line:    i + 1,
+				Column:  col + 1,
+				Context: strings.TrimSpace(line),
+				Snippet: strings.Join(lines[start:end], "\n"),
+				FileInfo: FileInfo{
+					Path:    path,
+					Name:    info.Name(),
+					Size:    info.Size(),
+					ModTime: info.ModTime().Unix(),
+				},
+			})
+			if len(results) >= maxResults {
+				return errLimitReached
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errLimitReached {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// matchesFilePatterns reports whether name matches any of the patterns, or there are none
+func matchesFilePatterns(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary reports whether content looks like a binary file
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
 }
 
 func (s *service) SearchSymbols(opts SearchOptions) ([]Symbol, error) {
-	// This will be implemented later when we add code indexing
-	return nil, nil
+	root := ""
+	if opts.Path != "" {
+		root = s.resolvePath(opts.Path)
+		if !s.isIndexed(root) {
+			if err := s.indexDirectory(root); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	query := strings.ToLower(opts.Query)
+
+	s.indexMutex.RLock()
+	var results []Symbol
+	for path, meta := range s.index {
+		if !isWithin(root, path) {
+			continue
+		}
+		for _, sym := range meta.Symbols {
+			if query == "" || strings.Contains(strings.ToLower(sym.Name), query) {
+				results = append(results, sym)
+			}
+		}
+	}
+	s.indexMutex.RUnlock()
+
+	// Exact matches first, then shorter names, then by location
+	sort.Slice(results, func(i, j int) bool {
+		ei := strings.EqualFold(results[i].Name, opts.Query)
+		ej := strings.EqualFold(results[j].Name, opts.Query)
+		if ei != ej {
+			return ei
+		}
+		if len(results[i].Name) != len(results[j].Name) {
+			return len(results[i].Name) < len(results[j].Name)
+		}
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].Line < results[j].Line
+	})
+
+	if opts.MaxResults > 0 && len(results) > opts.MaxResults {
+		results = results[:opts.MaxResults]
+	}
+
+	return results, nil
 }
 
 func (s *service) IndexFile(path string) error {
-	// This will be implemented later when we add code indexing
-	return nil
+	_, err := s.indexFile(s.resolvePath(path))
+	return err
 }
 
 func (s *service) IndexDirectory(path string) error {
-	// This will be implemented later when we add code indexing
-	return nil
+	return s.indexDirectory(s.resolvePath(path))
 }
 
 func (s *service) GetFileMetadata(path string) (Metadata, error) {
-	// This will be implemented later when we add code indexing
-	return Metadata{}, nil
+	absPath := s.resolvePath(path)
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	s.indexMutex.RLock()
+	meta, ok := s.index[absPath]
+	s.indexMutex.RUnlock()
+	if ok && !meta.LastIndexed.Before(info.ModTime()) {
+		return meta, nil
+	}
+
+	return s.indexFile(absPath)
 }
@@ -80,4 +80,7 @@ type Service interface {
 
 	// New method
 	RegisterDirectory(name, absPath string)
+
+	// RecentFiles returns the most recently written files, newest first
+	RecentFiles(limit int) []FileInfo
 }
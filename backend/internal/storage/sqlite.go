@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// DefaultDataDir returns the directory used for persistent IDE data.
+// It honours IDE_DATA_DIR and falls back to ~/.glassmorphic-ide.
+func DefaultDataDir() string {
+	if dir := os.Getenv("IDE_DATA_DIR"); dir != "" {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".glassmorphic-ide"
+	}
+	return filepath.Join(home, ".glassmorphic-ide")
+}
+
+// DefaultPath returns the path of the main SQLite database
+func DefaultPath() string {
+	return filepath.Join(DefaultDataDir(), "data.db")
+}
+
+// Open opens the SQLite database at path, creating it if needed.
+// The database is opened in WAL mode for better concurrency.
+func Open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Migrate executes schema statements in order. Statements must be idempotent
+// (CREATE ... IF NOT EXISTS) since they run on every startup.
+func Migrate(db *sql.DB, statements ...string) error {
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to apply schema: %w", err)
+		}
+	}
+	return nil
+}
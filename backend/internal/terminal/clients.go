@@ -0,0 +1,475 @@
+package terminal
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client roles. One client at a time controls a session and can type into it;
+// the others observe.
+const (
+	RoleController = "controller"
+	RoleObserver   = "observer"
+)
+
+const (
+	// writeWait is how long a write to a client may take before it is dropped
+	writeWait = 10 * time.Second
+
+	// pongWait is how long a client may go without answering a ping
+	pongWait = 60 * time.Second
+
+	// pingPeriod is how often clients are pinged; shorter than pongWait
+	pingPeriod = pongWait * 9 / 10
+
+	// maxQueuedBytes is how much output may wait for a slow client before it
+	// is disconnected. It matches the scrollback, so a client resuming by
+	// offset can still catch up on everything it missed.
+	maxQueuedBytes = scrollbackSize
+
+	// queueLength bounds the frames waiting for a client
+	queueLength = 1024
+)
+
+var (
+	// errNotController is returned when a client without control sends input
+	errNotController = errors.New("client does not control the session")
+
+	// errClientNotFound is returned when control is handed to an unknown client
+	errClientNotFound = errors.New("client not found")
+
+	// errViewportsAttached is returned when resizing a session whose size
+	// its clients decide
+	errViewportsAttached = errors.New("the terminal follows the size of its clients")
+)
+
+// client is a WebSocket attached to a session. Only its writer goroutine
+// writes to the connection, so a stalled browser never holds up the session
+// or the other clients.
+type client struct {
+	id       string
+	conn     *websocket.Conn
+	mode     clientMode
+	observer bool // Joined to watch, so is never handed control automatically
+	joined   int  // Join order, for passing control to the longest-connected client
+
+	// Viewport the client last reported; 0 until it sends a resize
+	rows, cols uint16
+
+	queue     chan frame
+	queued    atomic.Int64 // Bytes in the queue
+	quit      chan struct{}
+	quitOnce  sync.Once
+	closeOnce sync.Once
+	slow      atomic.Bool // Dropped for falling behind
+}
+
+// clientMode is how output and events are sent to a client
+type clientMode int
+
+const (
+	modeText   clientMode = iota // Output as plain text frames, no events
+	modeJSON                     // Output and events as JSON messages
+	modeBinary                   // Output and events as binary frames
+)
+
+// frame is a WebSocket message waiting to be written
+type frame struct {
+	messageType int
+	data        []byte
+}
+
+func newClient(id string, conn *websocket.Conn, opts ClientOptions) *client {
+	c := &client{
+		id:       id,
+		conn:     conn,
+		mode:     modeText,
+		observer: opts.Role == RoleObserver,
+		queue:    make(chan frame, queueLength),
+		quit:     make(chan struct{}),
+	}
+	switch {
+	case opts.Binary:
+		c.mode = modeBinary
+	case opts.Offset >= 0:
+		c.mode = modeJSON
+	}
+
+	// Browsers answer pings by themselves; a client that stops answering is gone
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	return c
+}
+
+// enqueue queues a frame for the writer. A client that falls too far behind
+// is disconnected rather than allowed to hold output back or grow without
+// bound. A frame is always accepted into an empty queue, since a replay can
+// be larger than the limit once escaped as JSON.
+func (c *client) enqueue(f frame) {
+	size := int64(len(f.data))
+	if queued := c.queued.Add(size); queued > maxQueuedBytes && queued > size {
+		c.drop()
+		return
+	}
+	select {
+	case c.queue <- f:
+	case <-c.quit:
+	default:
+		c.drop()
+	}
+}
+
+// drop disconnects a client that can't keep up. It is called while output is
+// broadcast, so it only stops the writer, which tells the client to try again
+// and closes the connection without holding up the session.
+func (c *client) drop() {
+	if c.slow.CompareAndSwap(false, true) {
+		logger.Printf("🐢 Disconnecting slow client %s", c.id)
+		c.stop()
+	}
+}
+
+// writeLoop writes queued frames and keepalive pings until the client closes
+// or is dropped
+func (c *client) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		if c.slow.Load() {
+			msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow")
+			c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+		}
+		c.close()
+	}()
+
+	for {
+		// A dropped client gets nothing more, even with frames still queued
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+
+		select {
+		case f := <-c.queue:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(f.messageType, f.data); err != nil {
+				logger.Printf("⚠️ Failed to write to client %s: %v", c.id, err)
+				return
+			}
+			c.queued.Add(-int64(len(f.data)))
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// stop tells the writer to finish
+func (c *client) stop() {
+	c.quitOnce.Do(func() { close(c.quit) })
+}
+
+// close stops the writer and closes the connection, which also ends the
+// handler's read loop
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		c.stop()
+		c.conn.Close()
+	})
+}
+
+// ClientOptions configures how a client joins a session
+type ClientOptions struct {
+	// Offset resumes the output from this position, with output and events
+	// sent as JSON messages. A negative offset gets a screen snapshot and
+	// then plain text frames.
+	Offset int64
+
+	// Role asks to control or observe. A client that doesn't ask to observe
+	// gets control when nobody has it.
+	Role string
+
+	// Binary sends output and events as binary frames; see BinarySubprotocol.
+	// Binary clients always get offsets, and without one start with a snapshot.
+	Binary bool
+}
+
+// ControlMessage tells JSON and binary clients who controls the session
+type ControlMessage struct {
+	Type       string `json:"type"`                 // "role" or "control_requested"
+	ClientID   string `json:"clientId"`             // The receiving client for "role", the requester otherwise
+	Role       string `json:"role,omitempty"`       // The receiving client's role
+	Controller string `json:"controller,omitempty"` // The controlling client, if any
+}
+
+// AddClient adds a new client to the session, brings its screen up to date
+// and returns the role it was given. With a negative offset the client gets a
+// snapshot of the screen and then live output. Otherwise it gets the output
+// from that offset onwards, so it can reconnect without losing or repeating
+// anything; if that output is no longer kept it gets a snapshot.
+func (s *Session) AddClient(clientID string, conn *websocket.Conn, opts ClientOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Exited() {
+		return "", errSessionClosed
+	}
+
+	// The replay is queued under the lock, so live output follows it exactly
+	c := newClient(clientID, conn, opts)
+	f, err := s.replay(c, opts.Offset)
+	if err != nil {
+		return "", err
+	}
+	c.enqueue(f)
+	go c.writeLoop()
+
+	s.joins++
+	c.joined = s.joins
+	s.clients[clientID] = c
+	if s.controller == "" && !c.observer {
+		s.controller = clientID
+	}
+	logger.Printf("👤 Client %s joined session %s as %s", clientID, s.ID, s.role(clientID))
+
+	s.notifyRoles()
+	return s.role(clientID), nil
+}
+
+// replay builds the first frame a client gets: a snapshot of the screen, or
+// the output from offset onwards. Callers hold s.mu.
+func (s *Session) replay(c *client, offset int64) (frame, error) {
+	if offset < 0 {
+		snapshot := s.screen.Snapshot()
+		if c.mode == modeBinary {
+			return frame{websocket.BinaryMessage, encodeSnapshotFrame(s.scrollback.offset(), 0, snapshot)}, nil
+		}
+		return frame{websocket.TextMessage, snapshot}, nil
+	}
+
+	replay, start := s.scrollback.since(uint64(offset))
+	next := start + uint64(len(replay))
+	if start > uint64(offset) {
+		snapshot, missed := s.screen.Snapshot(), start-uint64(offset)
+		if c.mode == modeBinary {
+			return frame{websocket.BinaryMessage, encodeSnapshotFrame(next, missed, snapshot)}, nil
+		}
+		return jsonFrame(OutputMessage{Type: "output", Offset: next, Next: next, Data: string(snapshot), Missed: missed, Snapshot: true})
+	}
+	if c.mode == modeBinary {
+		return frame{websocket.BinaryMessage, encodeOutputFrame(start, replay)}, nil
+	}
+	return jsonFrame(OutputMessage{Type: "output", Offset: start, Next: next, Data: string(replay)})
+}
+
+// jsonFrame encodes a message for a JSON client
+func jsonFrame(msg any) (frame, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return frame{}, err
+	}
+	return frame{websocket.TextMessage, data}, nil
+}
+
+// RemoveClient removes a client from the session. If it had control, control
+// passes to the longest-connected client that isn't only observing.
+func (s *Session) RemoveClient(clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, exists := s.clients[clientID]
+	if !exists {
+		return
+	}
+	c.close()
+	delete(s.clients, clientID)
+	logger.Printf("👋 Client %s left session %s", clientID, s.ID)
+
+	if s.controller == clientID {
+		s.controller = s.nextController("")
+		s.notifyRoles()
+	}
+	s.resizeToViewers()
+}
+
+// Input writes a client's keystrokes to the terminal. Observers can't type.
+func (s *Session) Input(clientID string, data []byte) error {
+	s.mu.RLock()
+	controller := s.controller
+	s.mu.RUnlock()
+
+	if controller != clientID {
+		return errNotController
+	}
+	s.captureInput(data)
+	return s.Write(data)
+}
+
+// RequestControl gives a client control if nobody has it. Otherwise the
+// controlling client is asked to hand it over, and false is returned.
+func (s *Session) RequestControl(clientID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[clientID]; !ok {
+		return false
+	}
+	switch s.controller {
+	case clientID:
+		return true
+	case "":
+		s.controller = clientID
+		s.notifyRoles()
+		return true
+	}
+	s.send(s.clients[s.controller], ControlMessage{Type: "control_requested", ClientID: clientID, Controller: s.controller})
+	return false
+}
+
+// GrantControl hands control from the controlling client to another client
+func (s *Session) GrantControl(fromID, toID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.controller != fromID {
+		return errNotController
+	}
+	if _, ok := s.clients[toID]; !ok {
+		return errClientNotFound
+	}
+	s.controller = toID
+	s.notifyRoles()
+	return nil
+}
+
+// ReleaseControl gives up control, passing it to the longest-connected other
+// client that isn't only observing
+func (s *Session) ReleaseControl(clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.controller != clientID {
+		return errNotController
+	}
+	s.controller = s.nextController(clientID)
+	s.notifyRoles()
+	return nil
+}
+
+// SetViewport records the size of a client's terminal view. The terminal
+// follows the smallest viewer, so every client can show the whole screen.
+func (s *Session) SetViewport(clientID string, rows, cols uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.clients[clientID]
+	if !ok {
+		return errClientNotFound
+	}
+	c.rows, c.cols = rows, cols
+	return s.resizeToViewers()
+}
+
+// SetSize resizes the terminal for callers without a view of their own. While
+// any client has reported a viewport the terminal follows the smallest one,
+// so it fails with errViewportsAttached instead.
+func (s *Session) SetSize(rows, cols uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.clients {
+		if c.rows != 0 && c.cols != 0 {
+			return errViewportsAttached
+		}
+	}
+	return s.Resize(rows, cols)
+}
+
+// resizeToViewers sizes the terminal to the smallest viewport any client
+// reported. Callers hold s.mu.
+func (s *Session) resizeToViewers() error {
+	var rows, cols uint16
+	for _, c := range s.clients {
+		if c.rows == 0 || c.cols == 0 {
+			continue
+		}
+		if rows == 0 || c.rows < rows {
+			rows = c.rows
+		}
+		if cols == 0 || c.cols < cols {
+			cols = c.cols
+		}
+	}
+	if rows == 0 || s.Exited() {
+		return nil
+	}
+	if r, c := s.screen.Size(); r == int(rows) && c == int(cols) {
+		return nil
+	}
+	return s.Resize(rows, cols)
+}
+
+// nextController picks the longest-connected client, other than skip, that
+// didn't join only to observe. Callers hold s.mu.
+func (s *Session) nextController(skip string) string {
+	var next *client
+	for _, c := range s.clients {
+		if c.id != skip && !c.observer && (next == nil || c.joined < next.joined) {
+			next = c
+		}
+	}
+	if next == nil {
+		return ""
+	}
+	return next.id
+}
+
+// role returns a client's role. Callers hold s.mu.
+func (s *Session) role(clientID string) string {
+	if s.controller == clientID {
+		return RoleController
+	}
+	return RoleObserver
+}
+
+// notifyRoles tells every JSON and binary client its role and who has
+// control. Callers hold s.mu.
+func (s *Session) notifyRoles() {
+	for _, c := range s.clients {
+		s.send(c, ControlMessage{Type: "role", ClientID: c.id, Role: s.role(c.id), Controller: s.controller})
+	}
+}
+
+// send queues an event for a JSON or binary client; plain text clients only
+// get output. Callers hold s.mu.
+func (s *Session) send(c *client, msg any) {
+	if c == nil || c.mode == modeText {
+		return
+	}
+
+	var f frame
+	var err error
+	if c.mode == modeBinary {
+		f.messageType = websocket.BinaryMessage
+		f.data, err = encodeControlFrame(msg)
+	} else {
+		f, err = jsonFrame(msg)
+	}
+	if err != nil {
+		logger.Printf("⚠️ Failed to encode message for client %s: %v", c.id, err)
+		return
+	}
+	c.enqueue(f)
+}
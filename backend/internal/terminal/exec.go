@@ -0,0 +1,281 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Limits on commands run with Exec
+const (
+	// maxConcurrentExecs is how many commands may run at once
+	maxConcurrentExecs = 8
+
+	// defaultExecTimeout and maxExecTimeout bound how long a command may run
+	defaultExecTimeout = 10 * time.Minute
+	maxExecTimeout     = time.Hour
+
+	// defaultExecOutput and maxExecOutput bound how much a command may write
+	// to stdout and stderr together before it is stopped
+	defaultExecOutput = 10 * 1024 * 1024
+	maxExecOutput     = 64 * 1024 * 1024
+
+	// maxPendingStdin is how much input may wait for a command to read it.
+	// Sending more cancels the command, since holding the input back would
+	// also hold back a cancellation sent after it.
+	maxPendingStdin = 16 * 1024 * 1024
+
+	// execWaitDelay is how long to wait for output after a command exits,
+	// in case something it started is still holding stdout or stderr open
+	execWaitDelay = 2 * time.Second
+)
+
+var (
+	// errTooManyExecs is returned when maxConcurrentExecs commands are running
+	errTooManyExecs = errors.New("too many commands are running")
+
+	// errInvalidExec is wrapped by errors for requests that can't be run
+	errInvalidExec = errors.New("invalid exec request")
+)
+
+// Output streams
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// ExecRequest describes a command to run without a terminal
+type ExecRequest struct {
+	Command string
+	Args    []string
+	Dir     string            // Relative to the workspace root, which is the default
+	Env     map[string]string // Added to the server's environment
+	Timeout time.Duration     // 0 for defaultExecTimeout; capped at maxExecTimeout
+
+	// MaxOutput is how many bytes of stdout and stderr together the command
+	// may write; 0 for defaultExecOutput, capped at maxExecOutput
+	MaxOutput int64
+}
+
+// ExecOutput is a chunk a command wrote to stdout or stderr
+type ExecOutput struct {
+	Stream string // StreamStdout or StreamStderr
+	Data   []byte
+	Time   time.Time
+}
+
+// ExecResult is how a command finished
+type ExecResult struct {
+	ExitCode        int    // -1 when the command was killed by a signal
+	Signal          string // The signal that killed it, if any
+	TimedOut        bool
+	Canceled        bool
+	OutputTruncated bool // Stopped for writing more than its output limit
+	Duration        time.Duration
+}
+
+// Executor runs commands in the workspace with their output captured,
+// limiting how many run at once
+type Executor struct {
+	workspaceRoot string
+	slots         chan struct{}
+}
+
+// NewExecutor creates an executor for commands in workspaceRoot or below it
+func NewExecutor(workspaceRoot string) *Executor {
+	return &Executor{
+		workspaceRoot: workspaceRoot,
+		slots:         make(chan struct{}, maxConcurrentExecs),
+	}
+}
+
+// Execution is a running command
+type Execution struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	ctx    context.Context // Canceled with the caller's context
+	cancel context.CancelFunc
+	start  time.Time
+
+	// mu serializes calls to output and guards the fields below
+	mu        sync.Mutex
+	output    func(ExecOutput)
+	written   int64
+	limit     int64
+	truncated bool
+	finished  bool
+
+	canceled atomic.Bool
+
+	done   chan struct{}
+	result ExecResult
+}
+
+// Start runs a command. Its output is passed to output one chunk at a time,
+// as it is written; output is never called concurrently or after Wait
+// returns. Canceling ctx kills the command, like Cancel.
+func (e *Executor) Start(ctx context.Context, req ExecRequest, output func(ExecOutput)) (*Execution, error) {
+	if req.Command == "" {
+		return nil, fmt.Errorf("%w: command is required", errInvalidExec)
+	}
+	if err := checkEnv(req.Env); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidExec, err)
+	}
+	dir, err := workspaceDir(e.workspaceRoot, req.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidExec, err)
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	timeout = min(timeout, maxExecTimeout)
+	limit := req.MaxOutput
+	if limit <= 0 {
+		limit = defaultExecOutput
+	}
+	limit = min(limit, maxExecOutput)
+
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		return nil, errTooManyExecs
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	cmd := exec.CommandContext(runCtx, req.Command, req.Args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for key, value := range req.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	// Run the command in its own process group, so stopping it also stops
+	// anything it started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = execWaitDelay
+
+	x := &Execution{
+		cmd:    cmd,
+		ctx:    ctx,
+		cancel: cancel,
+		output: output,
+		limit:  limit,
+		done:   make(chan struct{}),
+	}
+	cmd.Stdout = &execWriter{x, StreamStdout}
+	cmd.Stderr = &execWriter{x, StreamStderr}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		<-e.slots
+		return nil, err
+	}
+	x.stdin = stdin
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		<-e.slots
+		return nil, err
+	}
+	x.start = time.Now()
+	logger.Printf("⚙️ Running %s (pid %d) in %s", req.Command, cmd.Process.Pid, dir)
+
+	go func() {
+		defer func() { <-e.slots }()
+		x.wait(runCtx)
+	}()
+	return x, nil
+}
+
+// Write sends input to the command's stdin
+func (x *Execution) Write(p []byte) (int, error) {
+	return x.stdin.Write(p)
+}
+
+// CloseStdin closes the command's stdin, so it reads end of file
+func (x *Execution) CloseStdin() error {
+	return x.stdin.Close()
+}
+
+// Cancel kills the command and anything it started
+func (x *Execution) Cancel() {
+	x.canceled.Store(true)
+	x.cancel()
+}
+
+// Wait waits for the command to finish and returns how it did
+func (x *Execution) Wait() ExecResult {
+	<-x.done
+	return x.result
+}
+
+// wait reaps the command and records its result
+func (x *Execution) wait(runCtx context.Context) {
+	defer close(x.done)
+	defer x.cancel()
+
+	x.cmd.Wait()
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.finished = true
+
+	result := ExecResult{ExitCode: -1, Duration: time.Since(x.start)}
+	if state := x.cmd.ProcessState; state != nil {
+		result.ExitCode = state.ExitCode()
+		if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			result.Signal = status.Signal().String()
+		}
+	}
+	switch {
+	case x.truncated:
+		result.OutputTruncated = true
+	case x.canceled.Load() || x.ctx.Err() != nil:
+		result.Canceled = true
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		result.TimedOut = true
+	}
+	x.result = result
+	logger.Printf("⚙️ Command %s exited with %d after %s", x.cmd.Path, result.ExitCode, result.Duration.Round(time.Millisecond))
+}
+
+// execWriter passes what a command writes to one of its streams on to the
+// execution's output, stopping the command once it passes its limit
+type execWriter struct {
+	x      *Execution
+	stream string
+}
+
+func (w *execWriter) Write(p []byte) (int, error) {
+	x := w.x
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.finished || x.truncated {
+		return len(p), nil
+	}
+	data := p
+	if remaining := x.limit - x.written; int64(len(data)) > remaining {
+		data = data[:remaining]
+		x.truncated = true
+		x.cancel()
+	}
+	x.written += int64(len(data))
+	if len(data) > 0 {
+		// The pipe's buffer is reused, so the output gets its own copy
+		x.output(ExecOutput{Stream: w.stream, Data: append([]byte(nil), data...), Time: time.Now()})
+	}
+	return len(p), nil
+}
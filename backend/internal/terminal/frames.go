@@ -0,0 +1,82 @@
+package terminal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// BinarySubprotocol is the WebSocket subprotocol for binary framing. Clients
+// that offer it exchange binary frames, so terminal I/O is passed through
+// byte for byte, even when it isn't valid UTF-8.
+const BinarySubprotocol = "glask.terminal.v1"
+
+// Binary frame types. Every frame is one type byte followed by its payload;
+// integers are big-endian.
+const (
+	FrameInput    byte = 0x01 // Client to server: bytes to type
+	FrameOutput   byte = 0x02 // Server to client: 8-byte offset, then output
+	FrameResize   byte = 0x03 // Client to server: 2-byte rows, then 2-byte cols
+	FrameControl  byte = 0x04 // Either way: a JSON control message
+	FrameSnapshot byte = 0x05 // Server to client: 8-byte offset, 8-byte missed, then a screen redraw
+)
+
+// errInvalidFrame is returned for a binary frame that can't be decoded
+var errInvalidFrame = errors.New("invalid frame")
+
+// encodeOutputFrame frames output starting at offset
+func encodeOutputFrame(offset uint64, data []byte) []byte {
+	p := make([]byte, 9, 9+len(data))
+	p[0] = FrameOutput
+	binary.BigEndian.PutUint64(p[1:], offset)
+	return append(p, data...)
+}
+
+// encodeSnapshotFrame frames a redraw of the screen. Live output continues
+// from offset; missed is how much output before it is no longer kept.
+func encodeSnapshotFrame(offset, missed uint64, data []byte) []byte {
+	p := make([]byte, 17, 17+len(data))
+	p[0] = FrameSnapshot
+	binary.BigEndian.PutUint64(p[1:], offset)
+	binary.BigEndian.PutUint64(p[9:], missed)
+	return append(p, data...)
+}
+
+// encodeControlFrame frames a control message as JSON
+func encodeControlFrame(msg any) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{FrameControl}, data...), nil
+}
+
+// decodeFrame turns a frame from a client into the message a JSON client
+// would have sent
+func decodeFrame(p []byte) (TerminalMessage, error) {
+	if len(p) == 0 {
+		return TerminalMessage{}, errInvalidFrame
+	}
+	payload := p[1:]
+
+	switch p[0] {
+	case FrameInput:
+		return TerminalMessage{Type: "input", Data: string(payload)}, nil
+	case FrameResize:
+		if len(payload) != 4 {
+			return TerminalMessage{}, errInvalidFrame
+		}
+		return TerminalMessage{
+			Type: "resize",
+			Rows: binary.BigEndian.Uint16(payload),
+			Cols: binary.BigEndian.Uint16(payload[2:]),
+		}, nil
+	case FrameControl:
+		var msg TerminalMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return TerminalMessage{}, errInvalidFrame
+		}
+		return msg, nil
+	}
+	return TerminalMessage{}, errInvalidFrame
+}
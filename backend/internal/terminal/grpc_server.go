@@ -0,0 +1,200 @@
+package terminal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	pb "glask-ide/internal/terminal/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer exposes command execution over gRPC
+type GRPCServer struct {
+	pb.UnimplementedTerminalServiceServer
+	executor *Executor
+}
+
+// NewGRPCServer creates a new gRPC server
+func NewGRPCServer(executor *Executor) *GRPCServer {
+	return &GRPCServer{
+		executor: executor,
+	}
+}
+
+// Exec runs a command, streaming its output while taking stdin and
+// cancellation from the client
+func (s *GRPCServer) Exec(stream pb.TerminalService_ExecServer) error {
+	in, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if in.Type != "start" || in.Request == nil {
+		return status.Error(codes.InvalidArgument, "the first message must start a command")
+	}
+
+	req := in.Request
+	x, err := s.executor.Start(stream.Context(), ExecRequest{
+		Command:   req.Command,
+		Args:      req.Args,
+		Dir:       req.Cwd,
+		Env:       req.Env,
+		Timeout:   time.Duration(req.TimeoutMs) * time.Millisecond,
+		MaxOutput: req.MaxOutputBytes,
+	}, func(out ExecOutput) {
+		// A failed send means the client is gone, which cancels the stream's
+		// context and with it the command
+		stream.Send(&pb.ExecEvent{
+			Type:      "output",
+			Stream:    out.Stream,
+			Data:      out.Data,
+			Timestamp: out.Time.UnixMilli(),
+		})
+	})
+	if err != nil {
+		return execError(err)
+	}
+
+	// Take input until the client stops sending; the command keeps running
+	// after the client closes its side of the stream. Stdin is written from
+	// its own goroutine, so a command that stops reading it can't keep a
+	// cancellation from being read.
+	stdin := newStdinQueue(x)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			switch in.Type {
+			case "stdin":
+				if !stdin.push(in.Data) {
+					logger.Printf("⚠️ Canceling %s: more than %d bytes of stdin are waiting to be read", req.Command, maxPendingStdin)
+					x.Cancel()
+				}
+			case "close_stdin":
+				stdin.close()
+			case "cancel":
+				x.Cancel()
+			}
+		}
+	}()
+
+	result := x.Wait()
+	return stream.Send(&pb.ExecEvent{
+		Type:      "exit",
+		Timestamp: time.Now().UnixMilli(),
+		Exit: &pb.ExecExit{
+			ExitCode:        int32(result.ExitCode),
+			Signal:          result.Signal,
+			TimedOut:        result.TimedOut,
+			Canceled:        result.Canceled,
+			OutputTruncated: result.OutputTruncated,
+			DurationMs:      result.Duration.Milliseconds(),
+		},
+	})
+}
+
+// stdinQueue holds input for a command until it reads it
+type stdinQueue struct {
+	x       *Execution
+	mu      sync.Mutex
+	ready   chan struct{} // Signaled when data is queued or stdin is closed
+	data    [][]byte
+	pending int
+	closed  bool
+}
+
+// newStdinQueue starts writing queued input to a command's stdin
+func newStdinQueue(x *Execution) *stdinQueue {
+	q := &stdinQueue{x: x, ready: make(chan struct{}, 1)}
+	go q.writeLoop()
+	return q
+}
+
+// push queues input, reporting false if it would leave more than
+// maxPendingStdin bytes waiting
+func (q *stdinQueue) push(data []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return true
+	}
+	if q.pending+len(data) > maxPendingStdin {
+		return false
+	}
+	q.data = append(q.data, data)
+	q.pending += len(data)
+	q.signal()
+	return true
+}
+
+// close closes stdin once the queued input has been written
+func (q *stdinQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.signal()
+}
+
+func (q *stdinQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop writes queued input until stdin is closed or the command exits.
+// A write blocks while the command isn't reading; it fails once the command
+// exits and its stdin is closed.
+func (q *stdinQueue) writeLoop() {
+	for {
+		select {
+		case <-q.ready:
+		case <-q.x.done:
+			return
+		}
+
+		for {
+			q.mu.Lock()
+			if len(q.data) == 0 {
+				closed := q.closed
+				q.mu.Unlock()
+				if closed {
+					q.x.CloseStdin()
+					return
+				}
+				break
+			}
+			data := q.data[0]
+			q.data = q.data[1:]
+			q.mu.Unlock()
+
+			_, err := q.x.Write(data)
+			q.mu.Lock()
+			q.pending -= len(data)
+			q.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// execError maps errors starting a command to gRPC status errors
+func execError(err error) error {
+	switch {
+	case errors.Is(err, errInvalidExec):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errTooManyExecs):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -2,8 +2,15 @@ package terminal
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,6 +24,12 @@ const (
 	ErrInvalidOperation = "INVALID_OPERATION"
 	ErrMissingSessionId = "MISSING_SESSION_ID"
 	ErrInvalidSessionId = "INVALID_SESSION_ID"
+	ErrInvalidOffset    = "INVALID_OFFSET"
+	ErrInvalidDirectory = "INVALID_DIRECTORY"
+	ErrInvalidRole      = "INVALID_ROLE"
+	ErrSizeControlled   = "SIZE_CONTROLLED_BY_CLIENTS"
+	ErrInvalidQuery     = "INVALID_QUERY"
+	ErrHistoryFailed    = "HISTORY_FAILED"
 )
 
 var upgrader = websocket.Upgrader{
@@ -26,24 +39,59 @@ var upgrader = websocket.Upgrader{
 	ReadBufferSize:   32 * 1024,
 	WriteBufferSize:  32 * 1024,
 	HandshakeTimeout: 10 * time.Second,
+	Subprotocols:     []string{BinarySubprotocol},
 }
 
 // TerminalMessage represents a message from the client
 type TerminalMessage struct {
-	Type string `json:"type"`
-	Data string `json:"data,omitempty"`
-	Rows uint16 `json:"rows,omitempty"`
-	Cols uint16 `json:"cols,omitempty"`
+	Type     string `json:"type"`
+	Data     string `json:"data,omitempty"`
+	Rows     uint16 `json:"rows,omitempty"`
+	Cols     uint16 `json:"cols,omitempty"`
+	ClientID string `json:"clientId,omitempty"` // Client given control by "grant_control"
+}
+
+// OutputMessage carries terminal output to JSON clients that resume by offset.
+// Offsets count bytes of output since the session started.
+type OutputMessage struct {
+	Type   string `json:"type"`             // Always "output"
+	Offset uint64 `json:"offset"`           // Offset of the first byte of Data
+	Next   uint64 `json:"next"`             // Offset to reconnect with after this message
+	Data   string `json:"data"`             // May be empty for a replay with nothing new
+	Missed uint64 `json:"missed,omitempty"` // Bytes before Offset that are no longer kept
+
+	// Snapshot marks Data as a redraw of the current screen, sent in place of
+	// output that is no longer kept
+	Snapshot bool `json:"snapshot,omitempty"`
 }
 
 // Handler represents the terminal HTTP handler
 type Handler struct {
 	manager *Manager
+
+	// workspaceRoot is the directory sessions may be started in, with its subdirectories
+	workspaceRoot string
 }
 
-// NewHandler creates a new terminal handler
-func NewHandler(manager *Manager) *Handler {
-	return &Handler{manager: manager}
+// NewHandler creates a new terminal handler. Sessions can only be started in
+// workspaceRoot or below it.
+func NewHandler(manager *Manager, workspaceRoot string) *Handler {
+	return &Handler{manager: manager, workspaceRoot: workspaceRoot}
+}
+
+// CreateSessionRequest configures a new session; every field is optional
+type CreateSessionRequest struct {
+	Command   string            `json:"command,omitempty"` // Shell or program; $SHELL by default
+	Args      []string          `json:"args,omitempty"`
+	Cwd       string            `json:"cwd,omitempty"` // Relative paths are resolved against the workspace root
+	Env       map[string]string `json:"env,omitempty"`
+	Rows      uint16            `json:"rows,omitempty"`
+	Cols      uint16            `json:"cols,omitempty"`
+	ProjectID string            `json:"projectId,omitempty"`
+
+	// ShellIntegration false starts bash, zsh or fish without the scripts
+	// that report commands
+	ShellIntegration *bool `json:"shellIntegration,omitempty"`
 }
 
 // TerminalResponse represents the API response structure
@@ -67,9 +115,38 @@ func (h *Handler) HandleTerminalSession(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Create new session if POST request
+	// Create new session if POST request; an empty body starts the default shell
 	if r.Method == "POST" {
-		session, err := h.manager.NewSession()
+		var req CreateSessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			h.sendError(w, ErrInvalidOperation, "Invalid request body")
+			return
+		}
+
+		opts := SessionOptions{
+			Command:   req.Command,
+			Args:      req.Args,
+			Env:       req.Env,
+			Rows:      req.Rows,
+			Cols:      req.Cols,
+			ProjectID: req.ProjectID,
+
+			NoShellIntegration: req.ShellIntegration != nil && !*req.ShellIntegration,
+		}
+		if err := checkEnv(req.Env); err != nil {
+			h.sendError(w, ErrInvalidOperation, err.Error())
+			return
+		}
+		if req.Cwd != "" {
+			dir, err := workspaceDir(h.workspaceRoot, req.Cwd)
+			if err != nil {
+				h.sendError(w, ErrInvalidDirectory, err.Error())
+				return
+			}
+			opts.Dir = dir
+		}
+
+		session, err := h.manager.NewSession(opts)
 		if err != nil {
 			h.sendError(w, ErrConnectionFailed, err.Error())
 			return
@@ -97,6 +174,28 @@ func (h *Handler) HandleTerminalSession(w http.ResponseWriter, r *http.Request)
 		h.sendError(w, ErrSessionNotFound, "Session not found")
 		return
 	}
+	if session.Exited() {
+		h.sendError(w, ErrTerminalClosed, "Terminal session has exited")
+		return
+	}
+
+	// Clients that send an offset resume from it; others start from a snapshot
+	// of the screen
+	offset := int64(-1)
+	if v := r.URL.Query().Get("offset"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			h.sendError(w, ErrInvalidOffset, "Offset must be a non-negative integer")
+			return
+		}
+		offset = parsed
+	}
+
+	role := r.URL.Query().Get("role")
+	if role != "" && role != RoleController && role != RoleObserver {
+		h.sendError(w, ErrInvalidRole, "Role must be controller or observer")
+		return
+	}
 
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -105,35 +204,333 @@ func (h *Handler) HandleTerminalSession(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Add client to session
-	session.AddClient(sessionID, conn)
-	defer session.RemoveClient(sessionID)
+	// Add client to session; each connection is its own client, so several
+	// tabs can share a session
+	clientID := generateID()
+	binary := conn.Subprotocol() == BinarySubprotocol
+	if _, err := session.AddClient(clientID, conn, ClientOptions{Offset: offset, Role: role, Binary: binary}); err != nil {
+		log.Printf("Failed to add terminal client: %v", err)
+		conn.Close()
+		return
+	}
+	defer session.RemoveClient(clientID)
 
 	// Handle WebSocket messages
 	for {
 		var msg TerminalMessage
-		err := conn.ReadJSON(&msg)
-		if err != nil {
+		if binary {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			if msg, err = decodeFrame(data); err != nil {
+				log.Printf("Ignoring terminal frame: %v", err)
+				continue
+			}
+		} else if err := conn.ReadJSON(&msg); err != nil {
 			break
 		}
 
 		switch msg.Type {
 		case "input":
-			if _, err := session.PTY.Write([]byte(msg.Data)); err != nil {
+			// Input from observers is dropped
+			if err := session.Input(clientID, []byte(msg.Data)); err != nil && err != errNotController {
 				log.Printf("Failed to write to PTY: %v", err)
 			}
 		case "resize":
-			if err := session.Resize(msg.Rows, msg.Cols); err != nil {
+			if msg.Rows == 0 || msg.Cols == 0 {
+				continue
+			}
+			if err := session.SetViewport(clientID, msg.Rows, msg.Cols); err != nil {
 				log.Printf("Failed to resize terminal: %v", err)
 			}
+		case "request_control":
+			session.RequestControl(clientID)
+		case "grant_control":
+			session.GrantControl(clientID, msg.ClientID)
+		case "release_control":
+			session.ReleaseControl(clientID)
 		}
 	}
 }
 
+// HandleScreen returns the visible text of a session's terminal
+func (h *Handler) HandleScreen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := h.lookup(w, r.URL.Query().Get("sessionId"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session.GetScreen())
+}
+
+// HandleCommands lists the commands run at a session's prompt, as reported
+// by shell integration
+func (h *Handler) HandleCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := h.lookup(w, r.URL.Query().Get("sessionId"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"commands": session.Commands()})
+}
+
+// HandleHistory searches the commands run in terminals, newest first, across
+// sessions and restarts
+func (h *Handler) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history := h.manager.History()
+	if history == nil {
+		h.sendError(w, ErrHistoryFailed, "Command history is not kept")
+		return
+	}
+	query := r.URL.Query()
+	limit, ok := h.limit(w, query.Get("limit"))
+	if !ok {
+		return
+	}
+
+	commands, err := history.Search(HistoryQuery{
+		ProjectID: query.Get("projectId"),
+		SessionID: query.Get("sessionId"),
+		Cwd:       query.Get("cwd"),
+		Query:     query.Get("q"),
+		Limit:     limit,
+	})
+	if err != nil {
+		h.sendError(w, ErrHistoryFailed, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"commands": commands})
+}
+
+// HandleSuggestions returns the commands from the history most likely to
+// complete what has been typed, best first
+func (h *Handler) HandleSuggestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history := h.manager.History()
+	if history == nil {
+		h.sendError(w, ErrHistoryFailed, "Command history is not kept")
+		return
+	}
+	query := r.URL.Query()
+	limit, ok := h.limit(w, query.Get("limit"))
+	if !ok {
+		return
+	}
+
+	suggestions, err := history.Suggest(SuggestQuery{
+		ProjectID: query.Get("projectId"),
+		Prefix:    query.Get("prefix"),
+		Cwd:       query.Get("cwd"),
+		Limit:     limit,
+	})
+	if err != nil {
+		h.sendError(w, ErrHistoryFailed, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"suggestions": suggestions})
+}
+
+// limit parses a limit query parameter, sending the error response when it
+// is invalid. An empty one is 0, for the default.
+func (h *Handler) limit(w http.ResponseWriter, value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		h.sendError(w, ErrInvalidQuery, "Limit must be a non-negative number")
+		return 0, false
+	}
+	return limit, true
+}
+
+// HandleList lists all terminal sessions, including recently exited ones
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions := []SessionInfo{}
+	for _, session := range h.manager.ListSessions(r.URL.Query().Get("projectId")) {
+		sessions = append(sessions, session.Info())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"sessions": sessions})
+}
+
+// HandleGet describes one terminal session
+func (h *Handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := h.lookup(w, r.URL.Query().Get("sessionId"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session.Info())
+}
+
+// HandleTerminate kills a session's shell and removes the session
+func (h *Handler) HandleTerminate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, ErrInvalidOperation, "Invalid request body")
+		return
+	}
+
+	if _, ok := h.lookup(w, req.SessionID); !ok {
+		return
+	}
+	h.manager.CloseSession(req.SessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// HandleResize sets the size of a session's terminal while no client is viewing it
+func (h *Handler) HandleResize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		SessionID string `json:"sessionId"`
+		Rows      uint16 `json:"rows"`
+		Cols      uint16 `json:"cols"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, ErrInvalidOperation, "Invalid request body")
+		return
+	}
+	if req.Rows == 0 || req.Cols == 0 {
+		h.sendError(w, ErrInvalidOperation, "Rows and cols are required")
+		return
+	}
+
+	session, ok := h.lookup(w, req.SessionID)
+	if !ok {
+		return
+	}
+	if session.Exited() {
+		h.sendError(w, ErrTerminalClosed, "Terminal session has exited")
+		return
+	}
+	if err := session.SetSize(req.Rows, req.Cols); errors.Is(err, errViewportsAttached) {
+		h.sendError(w, ErrSizeControlled, "The terminal follows the size of its connected clients")
+		return
+	} else if err != nil {
+		h.sendError(w, ErrInvalidOperation, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// workspaceDir resolves a working directory and checks that it is an existing
+// directory inside the workspace root, following symlinks
+func workspaceDir(workspaceRoot, dir string) (string, error) {
+	root, err := filepath.EvalSymlinks(workspaceRoot)
+	if err != nil {
+		return "", fmt.Errorf("workspace root is not available: %v", err)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("working directory %s does not exist", dir)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("working directory %s is outside the workspace", dir)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("working directory %s is not a directory", dir)
+	}
+	return resolved, nil
+}
+
+// checkEnv checks that environment variable names can be passed to a process
+func checkEnv(env map[string]string) error {
+	for key := range env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("Invalid environment variable name %q", key)
+		}
+	}
+	return nil
+}
+
+// lookup finds a session, sending the error response when there is none
+func (h *Handler) lookup(w http.ResponseWriter, sessionID string) (*Session, bool) {
+	if sessionID == "" {
+		h.sendError(w, ErrMissingSessionId, "Session ID is required")
+		return nil, false
+	}
+	session, ok := h.manager.GetSession(sessionID)
+	if !ok || session == nil {
+		h.sendError(w, ErrSessionNotFound, "Session not found")
+		return nil, false
+	}
+	return session, true
+}
+
 // sendError sends an error response
 func (h *Handler) sendError(w http.ResponseWriter, code string, message string) {
+	status := http.StatusBadRequest
+	switch code {
+	case ErrSessionNotFound:
+		status = http.StatusNotFound
+	case ErrTerminalClosed, ErrSizeControlled:
+		status = http.StatusConflict
+	case ErrHistoryFailed:
+		status = http.StatusServiceUnavailable
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(TerminalResponse{
 		Error:   code,
 		Message: message,
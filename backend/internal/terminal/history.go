@@ -0,0 +1,411 @@
+package terminal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"glask-ide/internal/storage"
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS terminal_commands (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	project_id TEXT NOT NULL DEFAULT '',
+	command TEXT NOT NULL,
+	cwd TEXT NOT NULL DEFAULT '',
+	executed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	exit_code INTEGER,
+	duration_ms INTEGER
+)`
+
+const (
+	historySessionIndex = `CREATE INDEX IF NOT EXISTS idx_terminal_commands_session ON terminal_commands(session_id)`
+	historyProjectIndex = `CREATE INDEX IF NOT EXISTS idx_terminal_commands_project ON terminal_commands(project_id, id)`
+)
+
+// Limits on the command history
+const (
+	// maxHistoryPerProject is how many commands are kept for each project;
+	// older ones are forgotten
+	maxHistoryPerProject = 10000
+
+	// maxHistoryCommandLength skips command lines longer than this, which are
+	// usually pasted scripts rather than commands worth recalling
+	maxHistoryCommandLength = 4096
+
+	// defaultHistoryLimit and maxHistoryLimit bound how many results a query returns
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+
+	// historyQueueLength is how many commands may wait to be written before
+	// more are dropped
+	historyQueueLength = 256
+)
+
+// errInvalidHistoryQuery is wrapped by errors for queries that can't be run
+var errInvalidHistoryQuery = errors.New("invalid history query")
+
+// HistoryEntry is a command run in a terminal, as kept in the history
+type HistoryEntry struct {
+	ID         int64  `json:"id"`
+	SessionID  string `json:"sessionId"`
+	ProjectID  string `json:"projectId,omitempty"`
+	Command    string `json:"command"`
+	Cwd        string `json:"cwd,omitempty"`
+	ExecutedAt int64  `json:"executedAt"` // Unix milliseconds
+
+	// ExitCode and DurationMs are only known for commands reported by
+	// shell integration
+	ExitCode   *int   `json:"exitCode,omitempty"`
+	DurationMs *int64 `json:"durationMs,omitempty"`
+}
+
+// HistoryQuery selects commands from the history, newest first
+type HistoryQuery struct {
+	ProjectID string // All projects when empty
+	SessionID string // All sessions when empty
+	Cwd       string // All directories when empty
+	Query     string // Text the command must contain; case-sensitive
+	Limit     int    // defaultHistoryLimit when 0; capped at maxHistoryLimit
+}
+
+// SuggestQuery asks for the commands most likely to be wanted next
+type SuggestQuery struct {
+	ProjectID string // All projects when empty
+	Prefix    string // Text the command must start with; case-sensitive
+	Cwd       string // Commands run in this directory rank higher
+	Limit     int    // defaultHistoryLimit when 0; capped at maxHistoryLimit
+}
+
+// Suggestion is a distinct command from the history with how it has been used
+type Suggestion struct {
+	Command  string  `json:"command"`
+	Uses     int     `json:"uses"`
+	Failures int     `json:"failures,omitempty"` // Uses that exited with a non-zero code
+	LastUsed int64   `json:"lastUsed"`           // Unix milliseconds
+	Score    float64 `json:"score"`
+}
+
+// HistoryStore keeps the commands run in terminals in SQLite, so they can be
+// searched and suggested across sessions and restarts
+type HistoryStore struct {
+	db      *sql.DB
+	records chan HistoryEntry
+}
+
+// NewHistoryStore creates a history store, creating its table if needed
+func NewHistoryStore(db *sql.DB) (*HistoryStore, error) {
+	if err := storage.Migrate(db, historySchema, historySessionIndex, historyProjectIndex); err != nil {
+		return nil, err
+	}
+
+	store := &HistoryStore{db: db, records: make(chan HistoryEntry, historyQueueLength)}
+	go store.writeLoop()
+	return store, nil
+}
+
+// Add queues a command to be recorded without waiting for the database.
+// Blank commands, those starting with a space (which shells keep out of their
+// own history when asked to) and overly long ones are skipped.
+func (s *HistoryStore) Add(entry HistoryEntry) {
+	entry.Command = strings.TrimRight(entry.Command, " \t")
+	if strings.TrimSpace(entry.Command) == "" || strings.HasPrefix(entry.Command, " ") ||
+		len(entry.Command) > maxHistoryCommandLength {
+		return
+	}
+	select {
+	case s.records <- entry:
+	default:
+		logger.Printf("⚠️ Command history is falling behind; dropped a command from session %s", entry.SessionID)
+	}
+}
+
+func (s *HistoryStore) writeLoop() {
+	for entry := range s.records {
+		if err := s.Record(entry); err != nil {
+			logger.Printf("⚠️ %v", err)
+		}
+	}
+}
+
+// Record stores a command, forgetting the project's oldest ones beyond
+// maxHistoryPerProject
+func (s *HistoryStore) Record(entry HistoryEntry) error {
+	executedAt := time.Now()
+	if entry.ExecutedAt != 0 {
+		executedAt = time.UnixMilli(entry.ExecutedAt)
+	}
+
+	if _, err := s.db.Exec(`
+		INSERT INTO terminal_commands (session_id, project_id, command, cwd, executed_at, exit_code, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.SessionID, entry.ProjectID, entry.Command, entry.Cwd, executedAt.UTC(), entry.ExitCode, entry.DurationMs,
+	); err != nil {
+		return fmt.Errorf("failed to record command: %w", err)
+	}
+
+	if _, err := s.db.Exec(`
+		DELETE FROM terminal_commands WHERE project_id = ? AND id <= (
+			SELECT id FROM terminal_commands WHERE project_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`,
+		entry.ProjectID, entry.ProjectID, maxHistoryPerProject,
+	); err != nil {
+		return fmt.Errorf("failed to trim command history: %w", err)
+	}
+	return nil
+}
+
+// Search returns the commands matching a query, newest first
+func (s *HistoryStore) Search(q HistoryQuery) ([]HistoryEntry, error) {
+	limit, err := historyLimit(q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		clauses []string
+		args    []any
+	)
+	if q.ProjectID != "" {
+		clauses = append(clauses, "project_id = ?")
+		args = append(args, q.ProjectID)
+	}
+	if q.SessionID != "" {
+		clauses = append(clauses, "session_id = ?")
+		args = append(args, q.SessionID)
+	}
+	if q.Cwd != "" {
+		clauses = append(clauses, "cwd = ?")
+		args = append(args, q.Cwd)
+	}
+	if q.Query != "" {
+		clauses = append(clauses, "instr(command, ?) > 0")
+		args = append(args, q.Query)
+	}
+	where := ""
+	if len(clauses) > 0 {
+		where = "WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT id, session_id, project_id, command, cwd, executed_at, exit_code, duration_ms
+		FROM terminal_commands %s
+		ORDER BY id DESC
+		LIMIT ?`, where), append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search command history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var (
+			entry      HistoryEntry
+			executedAt time.Time
+			exitCode   sql.NullInt64
+			duration   sql.NullInt64
+		)
+		if err := rows.Scan(&entry.ID, &entry.SessionID, &entry.ProjectID, &entry.Command, &entry.Cwd,
+			&executedAt, &exitCode, &duration); err != nil {
+			return nil, fmt.Errorf("failed to scan command history: %w", err)
+		}
+		entry.ExecutedAt = executedAt.UnixMilli()
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			entry.ExitCode = &code
+		}
+		if duration.Valid {
+			entry.DurationMs = &duration.Int64
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search command history: %w", err)
+	}
+	return entries, nil
+}
+
+// Suggest returns the distinct commands starting with a prefix, best first.
+// Each use counts for less as it ages, halving after a week; uses in the
+// given directory count double and failed ones a quarter.
+func (s *HistoryStore) Suggest(q SuggestQuery) ([]Suggestion, error) {
+	limit, err := historyLimit(q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var clauses []string
+	args := []any{q.Cwd} // ?1, weighing uses in the directory
+	if q.ProjectID != "" {
+		clauses = append(clauses, "project_id = ?")
+		args = append(args, q.ProjectID)
+	}
+	if q.Prefix != "" {
+		// The prefix itself is already typed, so it is no use as a suggestion
+		clauses = append(clauses, "substr(command, 1, length(?)) = ?", "command != ?")
+		args = append(args, q.Prefix, q.Prefix, q.Prefix)
+	}
+	where := ""
+	if len(clauses) > 0 {
+		where = "WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT command, COUNT(*), COALESCE(SUM(exit_code != 0), 0),
+			CAST(ROUND((julianday(MAX(executed_at)) - 2440587.5) * 86400000) AS INTEGER),
+			SUM(1.0 / (1 + (julianday('now') - julianday(executed_at)) / 7)
+				* (CASE WHEN cwd = ?1 AND ?1 != '' THEN 2 ELSE 1 END)
+				* (CASE WHEN exit_code != 0 THEN 0.25 ELSE 1 END)) AS score
+		FROM terminal_commands %s
+		GROUP BY command
+		ORDER BY score DESC, MAX(id) DESC
+		LIMIT ?`, where), append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest commands: %w", err)
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		if err := rows.Scan(&suggestion.Command, &suggestion.Uses, &suggestion.Failures,
+			&suggestion.LastUsed, &suggestion.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan command suggestions: %w", err)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to suggest commands: %w", err)
+	}
+	return suggestions, nil
+}
+
+// historyLimit applies the default and cap to a requested number of results
+func historyLimit(limit int) (int, error) {
+	switch {
+	case limit < 0:
+		return 0, fmt.Errorf("%w: limit cannot be negative", errInvalidHistoryQuery)
+	case limit == 0:
+		return defaultHistoryLimit, nil
+	}
+	return min(limit, maxHistoryLimit), nil
+}
+
+// recordCommand adds a command reported by shell integration to the history
+func (s *Session) recordCommand(c Command) {
+	if s.history == nil {
+		return
+	}
+	duration := c.EndedAt - c.StartedAt
+	s.history.Add(HistoryEntry{
+		SessionID:  s.ID,
+		ProjectID:  s.ProjectID,
+		Command:    c.Command,
+		Cwd:        c.Cwd,
+		ExecutedAt: c.StartedAt,
+		ExitCode:   c.ExitCode,
+		DurationMs: &duration,
+	})
+}
+
+// captureInput records the lines typed into a shell that doesn't report its
+// commands. Lines are only taken once the terminal shows them, so passwords
+// typed at prompts that turn echo off stay out of the history.
+func (s *Session) captureInput(data []byte) {
+	if s.history == nil || s.commands.nonce != "" || s.commands.marked.Load() {
+		return
+	}
+	for _, line := range s.typed.feed(data) {
+		if s.screen.echoed(line) {
+			s.history.Add(HistoryEntry{
+				SessionID:  s.ID,
+				ProjectID:  s.ProjectID,
+				Command:    line,
+				Cwd:        s.WorkingDir(),
+				ExecutedAt: time.Now().UnixMilli(),
+			})
+		}
+	}
+}
+
+// lineCapture rebuilds the lines typed at a prompt from keystrokes. Only
+// typing, backspace and the keys that clear the line are followed; a line
+// edited any other way, such as with the arrow keys or tab completion, is
+// given up on, since only the shell knows what it became.
+type lineCapture struct {
+	mu     sync.Mutex
+	line   []byte
+	edited bool
+	state  int
+	params []byte
+}
+
+const (
+	typedGround = iota
+	typedEscape
+	typedCSI
+)
+
+// feed follows keystrokes, returning the lines they entered
+func (l *lineCapture) feed(data []byte) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var lines []string
+	for _, b := range data {
+		switch l.state {
+		case typedEscape:
+			if b == '[' {
+				l.state = typedCSI
+				l.params = l.params[:0]
+			} else {
+				l.edited = true
+				l.state = typedGround
+			}
+			continue
+		case typedCSI:
+			if b < 0x40 || b > 0x7e {
+				if len(l.params) < 16 {
+					l.params = append(l.params, b)
+				}
+				continue
+			}
+			// Bracketed paste markers wrap typing; anything else moves the cursor
+			if p := string(l.params); b != '~' || (p != "200" && p != "201") {
+				l.edited = true
+			}
+			l.state = typedGround
+			continue
+		}
+
+		switch {
+		case b == 0x1b:
+			l.state = typedEscape
+		case b == '\r' || b == '\n':
+			if !l.edited && strings.TrimSpace(string(l.line)) != "" {
+				lines = append(lines, string(l.line))
+			}
+			l.line, l.edited = l.line[:0], false
+		case b == 0x7f || b == 0x08:
+			if len(l.line) > 0 {
+				_, size := utf8.DecodeLastRune(l.line)
+				l.line = l.line[:len(l.line)-size]
+			}
+		case b == 0x03 || b == 0x15:
+			// Ctrl-C and Ctrl-U throw the line away
+			l.line, l.edited = l.line[:0], false
+		case b < 0x20:
+			l.edited = true
+		default:
+			if len(l.line) <= maxHistoryCommandLength {
+				l.line = append(l.line, b)
+			}
+		}
+	}
+	return lines
+}
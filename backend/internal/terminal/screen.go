@@ -0,0 +1,1074 @@
+package terminal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Cell attribute flags
+const (
+	attrBold uint16 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrReverse
+	attrHidden
+	attrStrike
+)
+
+// color is a cell color: 0 is the terminal default, 1-256 a palette index
+// plus one, and colorRGB marks a 24-bit color in the low bits
+type color uint32
+
+const colorRGB color = 1 << 24
+
+// pen is the colors and attributes text is drawn with
+type pen struct {
+	fg, bg color
+	flags  uint16
+}
+
+type cell struct {
+	ch    rune   // 0 for the second half of a wide character
+	extra string // Combining marks drawn over ch
+	pen   pen
+}
+
+// cursor is the cursor state saved and restored by DECSC and DECRC
+type cursor struct {
+	row, col int
+	pen      pen
+	origin   bool
+	wrapNext bool // The last column was written; the next character wraps
+}
+
+// parser states
+const (
+	stateGround = iota
+	stateEscape
+	stateEscapeIntermediate // Discards the character after ESC ( and friends
+	stateCSI
+	stateOSC
+	stateOSCEscape
+	stateString // DCS, SOS, PM and APC strings, which are ignored
+	stateStringEscape
+)
+
+// maxOSCLength bounds the operating system commands that are buffered
+const maxOSCLength = 4096
+
+// replayedModes are the DEC private modes a snapshot restores besides the
+// cursor, wrap and origin modes, so applications keep their input behaviour
+var replayedModes = []int{1, 1000, 1002, 1003, 1004, 1005, 1006, 1015, 2004}
+
+// Screen is a headless VT100/xterm emulator. It follows a session's output
+// to track the visible screen, cursor, attributes and alternate screen, so a
+// joining client can be sent the current screen instead of the output that
+// produced it.
+type Screen struct {
+	mu sync.Mutex
+
+	rows, cols int
+	primary    [][]cell
+	alternate  [][]cell
+	alt        bool // The alternate screen is shown
+
+	cur        cursor
+	saved      cursor
+	top        int // Scroll region, inclusive
+	bottom     int
+	tabs       []bool
+	autowrap   bool
+	visible    bool // Cursor visibility
+	insertMode bool
+	modes      map[int]bool
+	title      string
+	last       rune // Last printed character, for REP
+	scrolled   int  // Lines scrolled off the top of the primary screen
+
+	// Parser state
+	state        int
+	params       []int
+	private      byte
+	intermediate byte
+	osc          []byte
+	pending      []byte // Incomplete UTF-8 sequence from the previous write
+}
+
+// ScreenContent is the visible text of a terminal
+type ScreenContent struct {
+	Rows            int      `json:"rows"`
+	Cols            int      `json:"cols"`
+	Lines           []string `json:"lines"`     // One per row, trailing spaces trimmed
+	CursorRow       int      `json:"cursorRow"` // 1-based
+	CursorCol       int      `json:"cursorCol"` // 1-based
+	CursorVisible   bool     `json:"cursorVisible"`
+	AlternateScreen bool     `json:"alternateScreen"` // A full-screen application is running
+	Title           string   `json:"title,omitempty"`
+}
+
+// NewScreen creates a blank screen of the given size
+func NewScreen(rows, cols int) *Screen {
+	s := &Screen{rows: max(rows, 1), cols: max(cols, 1)}
+	s.reset()
+	return s
+}
+
+// reset returns the screen to its power-on state
+func (s *Screen) reset() {
+	s.primary = newGrid(s.rows, s.cols)
+	s.alternate = newGrid(s.rows, s.cols)
+	s.alt = false
+	s.cur = cursor{}
+	s.saved = cursor{}
+	s.top, s.bottom = 0, s.rows-1
+	s.resetTabs()
+	s.autowrap = true
+	s.visible = true
+	s.insertMode = false
+	s.modes = make(map[int]bool)
+	s.state = stateGround
+}
+
+func newGrid(rows, cols int) [][]cell {
+	g := make([][]cell, rows)
+	for i := range g {
+		g[i] = newLine(cols, pen{})
+	}
+	return g
+}
+
+func newLine(cols int, p pen) []cell {
+	line := make([]cell, cols)
+	for i := range line {
+		line[i] = blankCell(p)
+	}
+	return line
+}
+
+// blankCell is an erased cell, which keeps the background of the pen
+func blankCell(p pen) cell {
+	return cell{ch: ' ', pen: pen{bg: p.bg}}
+}
+
+func (s *Screen) resetTabs() {
+	s.tabs = make([]bool, s.cols)
+	for i := 8; i < s.cols; i += 8 {
+		s.tabs[i] = true
+	}
+}
+
+// grid returns the lines of the screen being shown
+func (s *Screen) grid() [][]cell {
+	if s.alt {
+		return s.alternate
+	}
+	return s.primary
+}
+
+// Write feeds terminal output through the emulator
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := p
+	if len(s.pending) > 0 {
+		data = append(s.pending, p...)
+		s.pending = nil
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(data) {
+			s.pending = append([]byte(nil), data...)
+			break
+		}
+		data = data[size:]
+		s.process(r)
+	}
+	return len(p), nil
+}
+
+// process advances the parser by one character
+func (s *Screen) process(r rune) {
+	// CAN and SUB abort any sequence, and ESC starts a new one
+	if r == 0x18 || r == 0x1a {
+		s.state = stateGround
+		return
+	}
+
+	switch s.state {
+	case stateGround:
+		switch {
+		case r == 0x1b:
+			s.state = stateEscape
+		case r < 0x20 || r == 0x7f:
+			s.control(r)
+		default:
+			s.print(r)
+		}
+
+	case stateEscape:
+		s.state = stateGround
+		switch r {
+		case '[':
+			s.state = stateCSI
+			s.params = s.params[:0]
+			s.private, s.intermediate = 0, 0
+		case ']':
+			s.state = stateOSC
+			s.osc = s.osc[:0]
+		case 'P', 'X', '^', '_':
+			s.state = stateString
+		case '(', ')', '*', '+', '-', '.', '/', '#', '%', ' ':
+			s.state = stateEscapeIntermediate
+		case 0x1b:
+			s.state = stateEscape
+		case '7':
+			s.saved = s.cur
+		case '8':
+			s.restoreCursor()
+		case 'D':
+			s.lineFeed()
+		case 'E':
+			s.cur.col = 0
+			s.lineFeed()
+		case 'M':
+			s.reverseIndex()
+		case 'H':
+			s.tabs[s.cur.col] = true
+		case 'c':
+			s.reset()
+		default:
+			if r < 0x20 {
+				s.control(r)
+			}
+		}
+
+	case stateEscapeIntermediate:
+		s.state = stateGround
+
+	case stateCSI:
+		switch {
+		case r >= '0' && r <= '9':
+			if len(s.params) == 0 {
+				s.params = append(s.params, 0)
+			}
+			if n := &s.params[len(s.params)-1]; *n < 65535 {
+				*n = *n*10 + int(r-'0')
+			}
+		case r == ';' || r == ':':
+			if len(s.params) == 0 {
+				s.params = append(s.params, 0)
+			}
+			s.params = append(s.params, 0)
+		case r >= '<' && r <= '?':
+			s.private = byte(r)
+		case r >= 0x20 && r <= 0x2f:
+			s.intermediate = byte(r)
+		case r >= 0x40 && r <= 0x7e:
+			s.state = stateGround
+			s.csi(byte(r))
+		case r == 0x1b:
+			s.state = stateEscape
+		case r < 0x20:
+			s.control(r)
+		default:
+			s.state = stateGround
+		}
+
+	case stateOSC:
+		switch r {
+		case 0x07:
+			s.state = stateGround
+			s.oscDispatch()
+		case 0x1b:
+			s.state = stateOSCEscape
+		default:
+			if len(s.osc) < maxOSCLength {
+				s.osc = utf8.AppendRune(s.osc, r)
+			}
+		}
+
+	case stateOSCEscape:
+		s.oscDispatch()
+		s.state = stateGround
+		if r != '\\' {
+			s.state = stateEscape
+			s.process(r)
+		}
+
+	case stateString:
+		switch r {
+		case 0x1b:
+			s.state = stateStringEscape
+		case 0x07:
+			s.state = stateGround
+		}
+
+	case stateStringEscape:
+		s.state = stateString
+		if r == '\\' {
+			s.state = stateGround
+		}
+	}
+}
+
+// control executes a C0 control character
+func (s *Screen) control(r rune) {
+	switch r {
+	case '\b':
+		if s.cur.col > 0 {
+			s.cur.col--
+		}
+		s.cur.wrapNext = false
+	case '\t':
+		s.tabForward(1)
+	case '\n', '\v', '\f':
+		s.lineFeed()
+	case '\r':
+		s.cur.col = 0
+		s.cur.wrapNext = false
+	}
+}
+
+// print draws a character at the cursor and advances it
+func (s *Screen) print(r rune) {
+	g := s.grid()
+	width := runeWidth(r)
+	if width == 0 {
+		// Combining marks join the character before the cursor
+		col := s.cur.col
+		if !s.cur.wrapNext && col > 0 {
+			col--
+		}
+		if col > 0 && g[s.cur.row][col].ch == 0 {
+			col--
+		}
+		g[s.cur.row][col].extra += string(r)
+		return
+	}
+
+	if s.cur.wrapNext && s.autowrap {
+		s.cur.col = 0
+		s.lineFeed()
+	}
+	s.cur.wrapNext = false
+	if width == 2 && s.cur.col == s.cols-1 {
+		if !s.autowrap || s.cols < 2 {
+			return
+		}
+		s.clearWide(s.cur.row, s.cur.col)
+		g[s.cur.row][s.cur.col] = blankCell(s.cur.pen)
+		s.cur.col = 0
+		s.lineFeed()
+	}
+
+	line := g[s.cur.row]
+	if s.insertMode {
+		copy(line[s.cur.col+width:], line[s.cur.col:])
+	}
+	s.clearWide(s.cur.row, s.cur.col)
+	line[s.cur.col] = cell{ch: r, pen: s.cur.pen}
+	if width == 2 {
+		s.clearWide(s.cur.row, s.cur.col+1)
+		line[s.cur.col+1] = cell{pen: s.cur.pen}
+	}
+	s.last = r
+
+	s.cur.col += width
+	if s.cur.col >= s.cols {
+		s.cur.col = s.cols - 1
+		s.cur.wrapNext = s.autowrap
+	}
+}
+
+// clearWide blanks the other half of a wide character about to be overwritten
+func (s *Screen) clearWide(row, col int) {
+	line := s.grid()[row]
+	if line[col].ch == 0 && col > 0 {
+		line[col-1] = blankCell(line[col-1].pen)
+	} else if col+1 < len(line) && line[col+1].ch == 0 {
+		line[col+1] = blankCell(line[col+1].pen)
+	}
+}
+
+// lineFeed moves the cursor down, scrolling at the bottom of the scroll region
+func (s *Screen) lineFeed() {
+	s.cur.wrapNext = false
+	if s.cur.row == s.bottom {
+		if s.top == 0 && !s.alt {
+			s.scrolled++
+		}
+		s.scrollUp(s.top, s.bottom, 1)
+	} else if s.cur.row < s.rows-1 {
+		s.cur.row++
+	}
+}
+
+// reverseIndex moves the cursor up, scrolling at the top of the scroll region
+func (s *Screen) reverseIndex() {
+	s.cur.wrapNext = false
+	if s.cur.row == s.top {
+		s.scrollDown(s.top, s.bottom, 1)
+	} else if s.cur.row > 0 {
+		s.cur.row--
+	}
+}
+
+// scrollUp moves lines top..bottom up by n, blanking the lines at the bottom
+func (s *Screen) scrollUp(top, bottom, n int) {
+	g := s.grid()
+	n = min(n, bottom-top+1)
+	copy(g[top:bottom+1], g[top+n:bottom+1])
+	for i := bottom - n + 1; i <= bottom; i++ {
+		g[i] = newLine(s.cols, s.cur.pen)
+	}
+}
+
+// scrollDown moves lines top..bottom down by n, blanking the lines at the top
+func (s *Screen) scrollDown(top, bottom, n int) {
+	g := s.grid()
+	n = min(n, bottom-top+1)
+	copy(g[top+n:bottom+1], g[top:bottom+1-n])
+	for i := top; i < top+n; i++ {
+		g[i] = newLine(s.cols, s.cur.pen)
+	}
+}
+
+func (s *Screen) tabForward(n int) {
+	s.cur.wrapNext = false
+	for ; n > 0 && s.cur.col < s.cols-1; n-- {
+		s.cur.col++
+		for s.cur.col < s.cols-1 && !s.tabs[s.cur.col] {
+			s.cur.col++
+		}
+	}
+}
+
+func (s *Screen) tabBackward(n int) {
+	s.cur.wrapNext = false
+	for ; n > 0 && s.cur.col > 0; n-- {
+		s.cur.col--
+		for s.cur.col > 0 && !s.tabs[s.cur.col] {
+			s.cur.col--
+		}
+	}
+}
+
+// moveTo positions the cursor, relative to the scroll region in origin mode
+func (s *Screen) moveTo(row, col int) {
+	top, bottom := 0, s.rows-1
+	if s.cur.origin {
+		top, bottom = s.top, s.bottom
+	}
+	s.cur.row = clamp(row+top, top, bottom)
+	s.cur.col = clamp(col, 0, s.cols-1)
+	s.cur.wrapNext = false
+}
+
+func (s *Screen) restoreCursor() {
+	s.cur = s.saved
+	s.cur.row = clamp(s.cur.row, 0, s.rows-1)
+	s.cur.col = clamp(s.cur.col, 0, s.cols-1)
+}
+
+// erase blanks cells from..to (exclusive) of a row
+func (s *Screen) erase(row, from, to int) {
+	line := s.grid()[row]
+	from, to = clamp(from, 0, s.cols), clamp(to, 0, s.cols)
+	if from < to {
+		s.clearWide(row, from)
+		s.clearWide(row, to-1)
+	}
+	for i := from; i < to; i++ {
+		line[i] = blankCell(s.cur.pen)
+	}
+}
+
+// param returns the nth parameter, or def when it is missing or zero
+func (s *Screen) param(n, def int) int {
+	if n >= len(s.params) || s.params[n] == 0 {
+		return def
+	}
+	return s.params[n]
+}
+
+// csi executes a control sequence
+func (s *Screen) csi(final byte) {
+	if s.private == '?' {
+		switch final {
+		case 'h', 'l':
+			for _, mode := range s.params {
+				s.setPrivateMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+	if s.private != 0 {
+		return
+	}
+	if s.intermediate != 0 {
+		if s.intermediate == '!' && final == 'p' {
+			// Soft reset
+			s.visible, s.autowrap, s.insertMode = true, true, false
+			s.cur.origin, s.cur.pen = false, pen{}
+			s.top, s.bottom = 0, s.rows-1
+		}
+		return
+	}
+
+	g := s.grid()
+	n := s.param(0, 1)
+	switch final {
+	case '@':
+		line := g[s.cur.row]
+		n = min(n, s.cols-s.cur.col)
+		copy(line[s.cur.col+n:], line[s.cur.col:])
+		s.erase(s.cur.row, s.cur.col, s.cur.col+n)
+	case 'A':
+		top := 0
+		if s.cur.row >= s.top {
+			top = s.top
+		}
+		s.cur.row = max(s.cur.row-n, top)
+		s.cur.wrapNext = false
+	case 'B', 'e':
+		bottom := s.rows - 1
+		if s.cur.row <= s.bottom {
+			bottom = s.bottom
+		}
+		s.cur.row = min(s.cur.row+n, bottom)
+		s.cur.wrapNext = false
+	case 'C', 'a':
+		s.cur.col = min(s.cur.col+n, s.cols-1)
+		s.cur.wrapNext = false
+	case 'D':
+		s.cur.col = max(s.cur.col-n, 0)
+		s.cur.wrapNext = false
+	case 'E':
+		s.cur.row = min(s.cur.row+n, s.bottom)
+		s.cur.col = 0
+		s.cur.wrapNext = false
+	case 'F':
+		s.cur.row = max(s.cur.row-n, s.top)
+		s.cur.col = 0
+		s.cur.wrapNext = false
+	case 'G', '`':
+		s.cur.col = clamp(n-1, 0, s.cols-1)
+		s.cur.wrapNext = false
+	case 'H', 'f':
+		s.moveTo(s.param(0, 1)-1, s.param(1, 1)-1)
+	case 'I':
+		s.tabForward(n)
+	case 'Z':
+		s.tabBackward(n)
+	case 'J':
+		switch s.param(0, 0) {
+		case 0:
+			s.erase(s.cur.row, s.cur.col, s.cols)
+			for row := s.cur.row + 1; row < s.rows; row++ {
+				s.erase(row, 0, s.cols)
+			}
+		case 1:
+			for row := 0; row < s.cur.row; row++ {
+				s.erase(row, 0, s.cols)
+			}
+			s.erase(s.cur.row, 0, s.cur.col+1)
+		case 2:
+			for row := 0; row < s.rows; row++ {
+				s.erase(row, 0, s.cols)
+			}
+		}
+	case 'K':
+		switch s.param(0, 0) {
+		case 0:
+			s.erase(s.cur.row, s.cur.col, s.cols)
+		case 1:
+			s.erase(s.cur.row, 0, s.cur.col+1)
+		case 2:
+			s.erase(s.cur.row, 0, s.cols)
+		}
+	case 'L':
+		if s.cur.row >= s.top && s.cur.row <= s.bottom {
+			s.scrollDown(s.cur.row, s.bottom, n)
+			s.cur.col = 0
+		}
+	case 'M':
+		if s.cur.row >= s.top && s.cur.row <= s.bottom {
+			s.scrollUp(s.cur.row, s.bottom, n)
+			s.cur.col = 0
+		}
+	case 'P':
+		line := g[s.cur.row]
+		n = min(n, s.cols-s.cur.col)
+		copy(line[s.cur.col:], line[s.cur.col+n:])
+		s.erase(s.cur.row, s.cols-n, s.cols)
+	case 'S':
+		s.scrollUp(s.top, s.bottom, n)
+	case 'T':
+		if len(s.params) <= 1 {
+			s.scrollDown(s.top, s.bottom, n)
+		}
+	case 'X':
+		s.erase(s.cur.row, s.cur.col, s.cur.col+n)
+	case 'b':
+		if s.last != 0 {
+			for i := 0; i < min(n, s.rows*s.cols); i++ {
+				s.print(s.last)
+			}
+		}
+	case 'd':
+		s.moveTo(n-1, s.cur.col)
+	case 'm':
+		s.sgr()
+	case 'r':
+		top, bottom := s.param(0, 1)-1, s.param(1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's':
+		if len(s.params) == 0 {
+			s.saved = s.cur
+		}
+	case 'u':
+		s.restoreCursor()
+	case 'h', 'l':
+		for _, mode := range s.params {
+			if mode == 4 {
+				s.insertMode = final == 'h'
+			}
+		}
+	}
+}
+
+// setPrivateMode sets or resets a DEC private mode
+func (s *Screen) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 6:
+		s.cur.origin = on
+		s.moveTo(0, 0)
+	case 7:
+		s.autowrap = on
+	case 25:
+		s.visible = on
+	case 47, 1047:
+		s.switchScreen(on, mode == 1047)
+	case 1048:
+		if on {
+			s.saved = s.cur
+		} else {
+			s.restoreCursor()
+		}
+	case 1049:
+		if on {
+			s.saved = s.cur
+			s.switchScreen(true, true)
+		} else {
+			s.switchScreen(false, false)
+			s.restoreCursor()
+		}
+	default:
+		for _, m := range replayedModes {
+			if m == mode {
+				s.modes[mode] = on
+			}
+		}
+	}
+}
+
+// switchScreen shows the alternate or primary screen, optionally clearing the
+// alternate screen on the way in
+func (s *Screen) switchScreen(alt, clear bool) {
+	if alt == s.alt {
+		return
+	}
+	if alt && clear {
+		s.alternate = newGrid(s.rows, s.cols)
+	}
+	s.alt = alt
+}
+
+// sgr applies a Select Graphic Rendition sequence to the pen
+func (s *Screen) sgr() {
+	params := s.params
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	p := &s.cur.pen
+	for i := 0; i < len(params); i++ {
+		switch n := params[i]; {
+		case n == 0:
+			*p = pen{}
+		case n == 1:
+			p.flags |= attrBold
+		case n == 2:
+			p.flags |= attrDim
+		case n == 3:
+			p.flags |= attrItalic
+		case n == 4 || n == 21:
+			p.flags |= attrUnderline
+		case n == 5 || n == 6:
+			p.flags |= attrBlink
+		case n == 7:
+			p.flags |= attrReverse
+		case n == 8:
+			p.flags |= attrHidden
+		case n == 9:
+			p.flags |= attrStrike
+		case n == 22:
+			p.flags &^= attrBold | attrDim
+		case n == 23:
+			p.flags &^= attrItalic
+		case n == 24:
+			p.flags &^= attrUnderline
+		case n == 25:
+			p.flags &^= attrBlink
+		case n == 27:
+			p.flags &^= attrReverse
+		case n == 28:
+			p.flags &^= attrHidden
+		case n == 29:
+			p.flags &^= attrStrike
+		case n >= 30 && n <= 37:
+			p.fg = color(n - 30 + 1)
+		case n == 39:
+			p.fg = 0
+		case n >= 40 && n <= 47:
+			p.bg = color(n - 40 + 1)
+		case n == 49:
+			p.bg = 0
+		case n >= 90 && n <= 97:
+			p.fg = color(n - 90 + 8 + 1)
+		case n >= 100 && n <= 107:
+			p.bg = color(n - 100 + 8 + 1)
+		case n == 38 || n == 48:
+			var c color
+			var ok bool
+			c, i, ok = extendedColor(params, i)
+			if ok && n == 38 {
+				p.fg = c
+			} else if ok {
+				p.bg = c
+			}
+		}
+	}
+}
+
+// extendedColor parses the 256-color or 24-bit color after a 38 or 48 and
+// returns the index of its last parameter
+func extendedColor(params []int, i int) (color, int, bool) {
+	if i+1 >= len(params) {
+		return 0, i, false
+	}
+	switch params[i+1] {
+	case 5:
+		if i+2 < len(params) {
+			return color(clamp(params[i+2], 0, 255) + 1), i + 2, true
+		}
+	case 2:
+		if i+4 < len(params) {
+			r, g, b := clamp(params[i+2], 0, 255), clamp(params[i+3], 0, 255), clamp(params[i+4], 0, 255)
+			return colorRGB | color(r<<16|g<<8|b), i + 4, true
+		}
+	}
+	return 0, len(params), false
+}
+
+// oscDispatch executes an operating system command; only titles are kept
+func (s *Screen) oscDispatch() {
+	cmd, text, ok := strings.Cut(string(s.osc), ";")
+	if ok && (cmd == "0" || cmd == "2") {
+		s.title = text
+	}
+}
+
+// screenMark is a position on the screen that follows its line as lines
+// scroll off the top
+type screenMark struct {
+	row, col int
+	scrolled int
+	alt      bool
+}
+
+// mark returns the cursor position
+func (s *Screen) mark() screenMark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return screenMark{row: s.cur.row, col: s.cur.col, scrolled: s.scrolled, alt: s.alt}
+}
+
+// textFrom returns the text from a mark up to the cursor, such as a command
+// line typed after a prompt. Rows that fill the width are taken to wrap onto
+// the next one.
+func (s *Screen) textFrom(m screenMark) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m.alt != s.alt {
+		return ""
+	}
+	row, col := m.row-(s.scrolled-m.scrolled), m.col
+	if row < 0 {
+		row, col = 0, 0
+	}
+
+	var b strings.Builder
+	g := s.grid()
+	for r := row; r <= s.cur.row && r < s.rows; r++ {
+		from, to := 0, s.cols
+		if r == row {
+			from = min(col, s.cols)
+		}
+		if r == s.cur.row {
+			to = max(from, min(s.cur.col, s.cols))
+		}
+		var line strings.Builder
+		for _, c := range g[r][from:to] {
+			if c.ch != 0 {
+				line.WriteRune(c.ch)
+				line.WriteString(c.extra)
+			}
+		}
+		text := line.String()
+		if r > row {
+			// A row that stopped short of the edge ended its line
+			if prev := g[r-1][s.cols-1]; prev.ch == 0 || prev.ch == ' ' {
+				b.WriteByte('\n')
+			}
+		}
+		b.WriteString(strings.TrimRight(text, " "))
+	}
+	return b.String()
+}
+
+// echoed reports whether the primary screen shows line just before the
+// cursor, as it does once a shell has echoed a line typed at its prompt
+func (s *Screen) echoed(line string) bool {
+	line = strings.TrimRight(line, " ")
+	s.mu.Lock()
+	m := screenMark{
+		row:      max(0, s.cur.row-utf8.RuneCountInString(line)/s.cols-1),
+		scrolled: s.scrolled,
+		alt:      s.alt,
+	}
+	s.mu.Unlock()
+
+	if m.alt {
+		return false
+	}
+	return strings.HasSuffix(strings.ReplaceAll(s.textFrom(m), "\n", ""), line)
+}
+
+// Resize changes the screen size. Lines pushed off the bottom of the primary
+// screen scroll off the top so the cursor stays on its line.
+func (s *Screen) Resize(rows, cols int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, cols = max(rows, 1), max(cols, 1)
+	if rows == s.rows && cols == s.cols {
+		return
+	}
+
+	shift := 0
+	if !s.alt && s.cur.row >= rows {
+		shift = s.cur.row - rows + 1
+	}
+	s.primary = resizeGrid(s.primary[shift:], rows, cols)
+	s.alternate = resizeGrid(s.alternate, rows, cols)
+	s.rows, s.cols = rows, cols
+
+	s.cur.row = clamp(s.cur.row-shift, 0, rows-1)
+	s.cur.col = clamp(s.cur.col, 0, cols-1)
+	s.cur.wrapNext = false
+	s.saved.row = clamp(s.saved.row, 0, rows-1)
+	s.saved.col = clamp(s.saved.col, 0, cols-1)
+	s.top, s.bottom = 0, rows-1
+	s.resetTabs()
+}
+
+func resizeGrid(g [][]cell, rows, cols int) [][]cell {
+	out := make([][]cell, rows)
+	for i := range out {
+		line := newLine(cols, pen{})
+		if i < len(g) {
+			copy(line, g[i])
+			// Don't keep half of a wide character cut by the new width
+			if cols < len(g[i]) && line[cols-1].ch != 0 && g[i][cols].ch == 0 {
+				line[cols-1] = blankCell(line[cols-1].pen)
+			}
+		}
+		out[i] = line
+	}
+	return out
+}
+
+// Size returns the screen's rows and columns
+func (s *Screen) Size() (rows, cols int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rows, s.cols
+}
+
+// Content returns the visible text of the screen
+func (s *Screen) Content() ScreenContent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content := ScreenContent{
+		Rows:            s.rows,
+		Cols:            s.cols,
+		Lines:           make([]string, s.rows),
+		CursorRow:       s.cur.row + 1,
+		CursorCol:       s.cur.col + 1,
+		CursorVisible:   s.visible,
+		AlternateScreen: s.alt,
+		Title:           s.title,
+	}
+	for i, line := range s.grid() {
+		var b strings.Builder
+		for _, c := range line {
+			if c.ch != 0 {
+				b.WriteRune(c.ch)
+				b.WriteString(c.extra)
+			}
+		}
+		content.Lines[i] = strings.TrimRight(b.String(), " ")
+	}
+	return content
+}
+
+// Snapshot returns escape sequences that redraw the current state on a blank
+// terminal of the same size: the primary screen, then the alternate screen
+// if it is shown, the cursor, the pen and the modes applications rely on
+func (s *Screen) Snapshot() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	if s.title != "" {
+		fmt.Fprintf(&b, "\x1b]2;%s\x07", s.title)
+	}
+	writeGrid(&b, s.primary)
+	if s.alt {
+		// Entering the alternate screen saves the cursor the primary returns to
+		fmt.Fprintf(&b, "\x1b[%d;%dH%s\x1b[?1049h", s.saved.row+1, s.saved.col+1, s.saved.pen.sgr())
+		writeGrid(&b, s.alternate)
+	}
+
+	b.WriteString("\x1b[0m")
+	if s.top != 0 || s.bottom != s.rows-1 {
+		fmt.Fprintf(&b, "\x1b[%d;%dr", s.top+1, s.bottom+1)
+	}
+	if !s.autowrap {
+		b.WriteString("\x1b[?7l")
+	}
+	if s.insertMode {
+		b.WriteString("\x1b[4h")
+	}
+	for _, mode := range replayedModes {
+		if s.modes[mode] {
+			fmt.Fprintf(&b, "\x1b[?%dh", mode)
+		}
+	}
+	row := s.cur.row
+	if s.cur.origin {
+		b.WriteString("\x1b[?6h")
+		row -= s.top
+	}
+	fmt.Fprintf(&b, "\x1b[%d;%dH", row+1, s.cur.col+1)
+	b.WriteString(s.cur.pen.sgr())
+	if !s.visible {
+		b.WriteString("\x1b[?25l")
+	}
+	return []byte(b.String())
+}
+
+// writeGrid draws the non-blank lines of a grid on a cleared screen
+func writeGrid(b *strings.Builder, g [][]cell) {
+	b.WriteString("\x1b[0m\x1b[H\x1b[2J")
+	current := pen{}
+	for row, line := range g {
+		end := len(line)
+		for end > 0 && line[end-1] == blankCell(pen{}) {
+			end--
+		}
+		if end == 0 {
+			continue
+		}
+
+		fmt.Fprintf(b, "\x1b[%dH", row+1)
+		for _, c := range line[:end] {
+			if c.ch == 0 {
+				continue
+			}
+			if c.pen != current {
+				b.WriteString(c.pen.sgr())
+				current = c.pen
+			}
+			b.WriteRune(c.ch)
+			b.WriteString(c.extra)
+		}
+	}
+}
+
+// sgr returns the sequence that selects the pen from the default rendition
+func (p pen) sgr() string {
+	codes := []string{"0"}
+	for i, code := range []string{"1", "2", "3", "4", "5", "7", "8", "9"} {
+		if p.flags&(1<<i) != 0 {
+			codes = append(codes, code)
+		}
+	}
+	codes = append(codes, p.fg.sgr(30, 90, 38)...)
+	codes = append(codes, p.bg.sgr(40, 100, 48)...)
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// sgr returns the parameters selecting a color, given the base codes of its
+// standard, bright and extended forms
+func (c color) sgr(standard, bright, extended int) []string {
+	switch {
+	case c == 0:
+		return nil
+	case c&colorRGB != 0:
+		return []string{strconv.Itoa(extended), "2",
+			strconv.Itoa(int(c >> 16 & 0xff)), strconv.Itoa(int(c >> 8 & 0xff)), strconv.Itoa(int(c & 0xff))}
+	case c <= 8:
+		return []string{strconv.Itoa(standard + int(c) - 1)}
+	case c <= 16:
+		return []string{strconv.Itoa(bright + int(c) - 9)}
+	}
+	return []string{strconv.Itoa(extended), "5", strconv.Itoa(int(c) - 1)}
+}
+
+// wideRanges are the East Asian wide and fullwidth blocks, and emoji
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, {0x2e80, 0x303e}, {0x3041, 0x33ff}, {0x3400, 0x4dbf},
+	{0x4e00, 0x9fff}, {0xa000, 0xa4cf}, {0xac00, 0xd7a3}, {0xf900, 0xfaff},
+	{0xfe30, 0xfe4f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x1f300, 0x1f64f},
+	{0x1f900, 0x1f9ff}, {0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+// runeWidth returns how many columns a character occupies
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, rng := range wideRanges {
+		if r >= rng[0] && r <= rng[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
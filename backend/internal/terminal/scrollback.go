@@ -0,0 +1,111 @@
+package terminal
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+// scrollbackSize is how much output each session keeps for replay
+const scrollbackSize = 1024 * 1024
+
+// scrollback is a fixed-size ring buffer of a session's output. Positions are
+// byte offsets into everything the session has printed, so a client that knows
+// how far it got can ask for exactly the output it missed.
+type scrollback struct {
+	mu  sync.Mutex
+	buf []byte
+	end uint64 // Offset just past the last byte written
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{buf: make([]byte, size)}
+}
+
+// write appends output, overwriting the oldest bytes once the buffer is full,
+// and returns the offset of its first byte
+func (b *scrollback) write(p []byte) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offset := b.end
+	size := len(b.buf)
+	if len(p) > size {
+		b.end += uint64(len(p) - size)
+		p = p[len(p)-size:]
+	}
+	pos := int(b.end % uint64(size))
+	n := copy(b.buf[pos:], p)
+	copy(b.buf, p[n:])
+	b.end += uint64(len(p))
+	return offset
+}
+
+// since returns the retained output from offset onwards and the offset of its
+// first byte, which is later than requested when that output was overwritten
+func (b *scrollback) since(offset uint64) ([]byte, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.read(offset)
+}
+
+// tail returns up to the last n bytes of output
+func (b *scrollback) tail(n int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offset := uint64(0)
+	if b.end > uint64(n) {
+		offset = b.end - uint64(n)
+	}
+	out, _ := b.read(offset)
+	return out
+}
+
+// offset returns the offset just past the last byte written
+func (b *scrollback) offset() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.end
+}
+
+// read copies out the output from offset onwards. Callers hold b.mu.
+func (b *scrollback) read(offset uint64) ([]byte, uint64) {
+	if start := b.start(); offset < start {
+		// Skip the tail of a character whose first bytes were overwritten
+		offset = start
+		for i := 0; i < utf8.UTFMax-1 && offset < b.end && !utf8.RuneStart(b.buf[offset%uint64(len(b.buf))]); i++ {
+			offset++
+		}
+	}
+	if offset > b.end {
+		offset = b.end
+	}
+
+	out := make([]byte, b.end-offset)
+	size := uint64(len(b.buf))
+	n := copy(out, b.buf[offset%size:])
+	copy(out[n:], b.buf)
+	return out, offset
+}
+
+// start returns the offset of the oldest retained byte. Callers hold b.mu.
+func (b *scrollback) start() uint64 {
+	if size := uint64(len(b.buf)); b.end > size {
+		return b.end - size
+	}
+	return 0
+}
+
+// completeUTF8 returns how much of p can be sent without splitting a
+// multi-byte character that continues in the next read
+func completeUTF8(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
+}
@@ -0,0 +1,352 @@
+package terminal
+
+import (
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Shell integration scripts mark prompts and commands with OSC 633 sequences,
+// the same ones VS Code uses. Shells with their own integration may send the
+// FinalTerm OSC 133 marks instead, and OSC 7 for the directory.
+//
+//go:embed shellintegration
+var shellIntegrationScripts embed.FS
+
+const (
+	// maxCommands is how many commands each session remembers
+	maxCommands = 1000
+
+	// maxShellOSCLength bounds the shell integration sequences that are
+	// buffered; a command line can be much longer than a title
+	maxShellOSCLength = 64 * 1024
+)
+
+var (
+	shellIntegrationOnce sync.Once
+	shellIntegrationDir  string
+)
+
+// installShellIntegration writes the integration scripts where the shells can
+// load them, once per process. It returns "" if they can't be written.
+func installShellIntegration() string {
+	shellIntegrationOnce.Do(func() {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		dir := filepath.Join(base, "glask-ide", "shell-integration")
+		files := map[string]string{
+			"bash.sh":    "bash.sh",
+			"fish.fish":  "fish.fish",
+			"zshenv.zsh": filepath.Join("zsh", ".zshenv"),
+			"zshrc.zsh":  filepath.Join("zsh", ".zshrc"),
+		}
+		for name, target := range files {
+			data, err := shellIntegrationScripts.ReadFile("shellintegration/" + name)
+			if err == nil {
+				target = filepath.Join(dir, target)
+				if err = os.MkdirAll(filepath.Dir(target), 0700); err == nil {
+					err = os.WriteFile(target, data, 0600)
+				}
+			}
+			if err != nil {
+				logger.Printf("⚠️ Shell integration is unavailable: %v", err)
+				return
+			}
+		}
+		shellIntegrationDir = dir
+	})
+	return shellIntegrationDir
+}
+
+// withShellIntegration returns the arguments and environment that start a
+// shell with integration loaded, and a nonce that vouches for the command
+// lines it reports. Only bash, zsh and fish started without arguments are
+// integrated, since arguments may mean the shell isn't interactive.
+func withShellIntegration(command string, args []string) ([]string, []string, string, bool) {
+	shell := filepath.Base(command)
+	if len(args) > 0 || (shell != "bash" && shell != "zsh" && shell != "fish") {
+		return args, nil, "", false
+	}
+	dir := installShellIntegration()
+	if dir == "" {
+		return args, nil, "", false
+	}
+
+	nonceBytes := make([]byte, 16)
+	rand.Read(nonceBytes)
+	nonce := hex.EncodeToString(nonceBytes)
+	env := []string{"GLASK_SHELL_NONCE=" + nonce}
+
+	switch shell {
+	case "bash":
+		args = []string{"--init-file", filepath.Join(dir, "bash.sh")}
+	case "zsh":
+		userDir := os.Getenv("ZDOTDIR")
+		if userDir == "" {
+			userDir, _ = os.UserHomeDir()
+		}
+		env = append(env, "ZDOTDIR="+filepath.Join(dir, "zsh"), "GLASK_USER_ZDOTDIR="+userDir)
+	case "fish":
+		script := strings.ReplaceAll(filepath.Join(dir, "fish.fish"), `'`, `\'`)
+		args = []string{"--init-command", "source '" + script + "'"}
+	}
+	return args, env, nonce, true
+}
+
+// oscScanner picks the shell integration sequences out of terminal output.
+// It keeps its state between writes, so a sequence may be split across them.
+type oscScanner struct {
+	state int
+	buf   []byte
+}
+
+const (
+	oscGround = iota
+	oscEscape
+	oscBody
+	oscBodyEscape
+)
+
+// scan reports each OSC 7, 133 and 633 sequence in p with the index just
+// past its end
+func (o *oscScanner) scan(p []byte, fn func(end int, osc string)) {
+	for i, b := range p {
+		switch o.state {
+		case oscGround:
+			if b == 0x1b {
+				o.state = oscEscape
+			}
+		case oscEscape:
+			if b == ']' {
+				o.state = oscBody
+				o.buf = o.buf[:0]
+			} else if b != 0x1b {
+				o.state = oscGround
+			}
+		case oscBody:
+			switch b {
+			case 0x07:
+				o.dispatch(i+1, fn)
+			case 0x1b:
+				o.state = oscBodyEscape
+			case 0x18, 0x1a:
+				o.state = oscGround
+			default:
+				if len(o.buf) < maxShellOSCLength {
+					o.buf = append(o.buf, b)
+				}
+			}
+		case oscBodyEscape:
+			// Any escape but ST aborts the sequence and may start another
+			switch b {
+			case '\\':
+				o.dispatch(i+1, fn)
+			case ']':
+				o.state = oscBody
+				o.buf = o.buf[:0]
+			case 0x1b:
+				o.state = oscEscape
+			default:
+				o.state = oscGround
+			}
+		}
+	}
+}
+
+func (o *oscScanner) dispatch(end int, fn func(end int, osc string)) {
+	o.state = oscGround
+	if len(o.buf) >= maxShellOSCLength {
+		return
+	}
+	osc := string(o.buf)
+	if strings.HasPrefix(osc, "7;") || strings.HasPrefix(osc, "133;") || strings.HasPrefix(osc, "633;") {
+		fn(end, osc)
+	}
+}
+
+// Command is a command run at a shell prompt, as reported by shell integration
+type Command struct {
+	ID        int    `json:"id"` // Numbers the session's commands from 1
+	Command   string `json:"command"`
+	Cwd       string `json:"cwd,omitempty"`
+	StartedAt int64  `json:"startedAt"`         // Unix milliseconds
+	EndedAt   int64  `json:"endedAt,omitempty"` // Unix milliseconds; 0 while it runs
+	ExitCode  *int   `json:"exitCode,omitempty"`
+
+	// Output offsets just past the marks where the command started and
+	// ended, so its output is the session output between them
+	Offset    uint64 `json:"offset"`
+	EndOffset uint64 `json:"endOffset,omitempty"`
+}
+
+// CommandMessage tells JSON and binary clients that a command started or ended
+type CommandMessage struct {
+	Type    string  `json:"type"` // "command_started" or "command_finished"
+	Command Command `json:"command"`
+}
+
+// commandTracker follows the shell integration sequences in a session's
+// output to find the commands run at its prompts
+type commandTracker struct {
+	nonce string // Command lines must carry this nonce; "" to trust any
+
+	// marked is set once the shell has sent a prompt or command mark
+	marked atomic.Bool
+
+	// Only the output handler updates the parser state
+	scanner  oscScanner
+	input    screenMark // Where the command line started, at the last B mark
+	hasInput bool
+	line     string // The command line from the last E mark
+	hasLine  bool
+
+	mu       sync.Mutex
+	cwd      string
+	current  *Command
+	commands []Command
+	next     int
+}
+
+// handle applies one sequence at output offset, returning the command that
+// started or ended, if any
+func (t *commandTracker) handle(osc string, offset uint64, screen *Screen) *CommandMessage {
+	if rest, ok := strings.CutPrefix(osc, "7;"); ok {
+		if u, err := url.Parse(rest); err == nil && u.Scheme == "file" {
+			t.setCwd(u.Path)
+		}
+		return nil
+	}
+
+	t.marked.Store(true)
+	_, osc, _ = strings.Cut(osc, ";")
+	mark, args, _ := strings.Cut(osc, ";")
+	switch mark {
+	case "A":
+		// A prompt means any command still running has ended
+		return t.finish(offset, nil)
+	case "B":
+		t.input, t.hasInput = screen.mark(), true
+		t.line, t.hasLine = "", false
+	case "E":
+		line, nonce, _ := strings.Cut(args, ";")
+		if t.nonce == "" || nonce == t.nonce {
+			t.line, t.hasLine = unescapeShellValue(line), true
+		}
+	case "C":
+		line := t.line
+		if !t.hasLine && t.hasInput {
+			line = strings.TrimSpace(screen.textFrom(t.input))
+		}
+		t.hasInput, t.hasLine = false, false
+		return t.start(line, offset)
+	case "D":
+		var code *int
+		if n, err := strconv.Atoi(args); err == nil {
+			code = &n
+		}
+		return t.finish(offset, code)
+	case "P":
+		if key, value, ok := strings.Cut(args, "="); ok && key == "Cwd" {
+			t.setCwd(unescapeShellValue(value))
+		}
+	}
+	return nil
+}
+
+func (t *commandTracker) setCwd(dir string) {
+	t.mu.Lock()
+	t.cwd = dir
+	t.mu.Unlock()
+}
+
+func (t *commandTracker) start(line string, offset uint64) *CommandMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.next++
+	t.current = &Command{
+		ID:        t.next,
+		Command:   line,
+		Cwd:       t.cwd,
+		StartedAt: time.Now().UnixMilli(),
+		Offset:    offset,
+	}
+	return &CommandMessage{Type: "command_started", Command: *t.current}
+}
+
+// finish ends the running command at output offset end
+func (t *commandTracker) finish(end uint64, code *int) *CommandMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.current
+	if c == nil {
+		return nil
+	}
+	t.current = nil
+	c.EndedAt = time.Now().UnixMilli()
+	c.ExitCode = code
+	c.EndOffset = max(end, c.Offset)
+
+	t.commands = append(t.commands, *c)
+	if len(t.commands) > maxCommands {
+		t.commands = append(t.commands[:0], t.commands[len(t.commands)-maxCommands:]...)
+	}
+	return &CommandMessage{Type: "command_finished", Command: *c}
+}
+
+// list returns the finished commands, oldest first, then the running one
+func (t *commandTracker) list() []Command {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	commands := append([]Command{}, t.commands...)
+	if t.current != nil {
+		commands = append(commands, *t.current)
+	}
+	return commands
+}
+
+// workingDir returns the directory the shell last reported
+func (t *commandTracker) workingDir() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cwd
+}
+
+// unescapeShellValue reverses the escaping of values in OSC 633 sequences:
+// \\ for a backslash and \xAB for a byte
+func unescapeShellValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			if s[i+1] == '\\' {
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+			if s[i+1] == 'x' && i+3 < len(s) {
+				if n, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+					b.WriteByte(byte(n))
+					i += 3
+					continue
+				}
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+# Shell integration for bash, loaded with --init-file in place of ~/.bashrc.
+# Marks prompts and commands with OSC 633 sequences so the IDE knows where
+# each command starts and ends, its exit status and the working directory.
+
+if [ -r ~/.bashrc ]; then
+	. ~/.bashrc
+fi
+
+# The nonce shows the IDE that a command line came from here and not from a
+# program's output
+__glask_nonce=$GLASK_SHELL_NONCE
+unset GLASK_SHELL_NONCE
+
+# "prompt" while the user is typing, "running" once a command has started
+__glask_state=
+
+# The number of the last history entry when the prompt was shown; a command
+# kept out of history doesn't add one
+__glask_histnum=
+
+__glask_escape() {
+	local s=${1//\\/\\\\}
+	s=${s//;/\\x3b}
+	s=${s//$'\n'/\\x0a}
+	s=${s//$'\r'/\\x0d}
+	s=${s//$'\e'/\\x1b}
+	s=${s//$'\a'/\\x07}
+	builtin printf '%s' "$s"
+}
+
+__glask_preexec() {
+	[ "$__glask_state" = prompt ] || return
+	[ "$BASH_COMMAND" = __glask_precmd ] && return
+	__glask_state=running
+
+	local entry num cmd
+	entry=$(HISTTIMEFORMAT= builtin history 1)
+	read -r num _ <<<"$entry"
+	if [ "$num" != "$__glask_histnum" ]; then
+		cmd=${entry#*[0-9]  }
+		builtin printf '\e]633;E;%s;%s\a' "$(__glask_escape "$cmd")" "$__glask_nonce"
+	fi
+	# Without E, the IDE takes the command line from the screen
+	builtin printf '\e]633;C\a'
+}
+
+__glask_precmd() {
+	local ret=$?
+	if [ "$__glask_state" = running ]; then
+		builtin printf '\e]633;D;%s\a' "$ret"
+	fi
+	__glask_state=
+	builtin printf '\e]633;P;Cwd=%s\a' "$(__glask_escape "$PWD")"
+
+	local entry
+	entry=$(HISTTIMEFORMAT= builtin history 1)
+	read -r __glask_histnum _ <<<"$entry"
+
+	# Prompts are often rebuilt by PROMPT_COMMAND, so mark them every time
+	if [[ $PS1 != *'633;A'* ]]; then
+		PS1='\[\e]633;A\a\]'$PS1'\[\e]633;B\a\]'
+	fi
+}
+
+trap '__glask_preexec' DEBUG
+
+# Newlines separate the commands, since PROMPT_COMMAND may end with ";"
+PROMPT_COMMAND=$'__glask_precmd\n'"$PROMPT_COMMAND"$'\n__glask_state=prompt'
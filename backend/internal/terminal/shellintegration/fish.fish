@@ -0,0 +1,40 @@
+# Shell integration for fish, sourced with --init-command after the user's
+# configuration. Marks prompts and commands with OSC 633 sequences so the IDE
+# knows where each command starts and ends, its exit status and the working
+# directory.
+
+# The nonce shows the IDE that a command line came from here and not from a
+# program's output
+set -g __glask_nonce $GLASK_SHELL_NONCE
+set -e GLASK_SHELL_NONCE
+
+function __glask_escape
+    set -l s (string replace -a -- '\\' '\\\\' $argv[1])
+    set s (string replace -a -- ';' '\\x3b' $s)
+    set s (string replace -a -- \r '\\x0d' $s)
+    set s (string replace -a -- \e '\\x1b' $s)
+    set s (string replace -a -- \a '\\x07' $s)
+    string join -- '\\x0a' $s
+end
+
+function __glask_preexec --on-event fish_preexec
+    set -l cmd (__glask_escape $argv[1])
+    printf '\e]633;E;%s;%s\a\e]633;C\a' "$cmd" $__glask_nonce
+end
+
+function __glask_postexec --on-event fish_postexec
+    printf '\e]633;D;%s\a' $status
+end
+
+function __glask_cwd --on-event fish_prompt
+    set -l cwd (__glask_escape $PWD)
+    printf '\e]633;P;Cwd=%s\a' "$cwd"
+end
+
+# Mark the prompt, keeping the user's
+functions -c fish_prompt __glask_user_prompt
+function fish_prompt
+    printf '\e]633;A\a'
+    __glask_user_prompt
+    printf '\e]633;B\a'
+end
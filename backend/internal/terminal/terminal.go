@@ -1,12 +1,17 @@
 package terminal
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/creack/pty"
@@ -15,66 +20,183 @@ import (
 
 var logger = log.New(os.Stdout, "TERM: ", log.Ldate|log.Ltime)
 
+// errSessionClosed is returned when a client joins a session that has ended
+var errSessionClosed = errors.New("terminal session has exited")
+
+// exitedSessionTTL is how long a session whose shell has exited stays listed,
+// so clients can still see how it ended
+const exitedSessionTTL = 5 * time.Minute
+
+// recentOutputSize is how much of a session's latest output is kept for
+// in-process consumers such as error analysis
+const recentOutputSize = 64 * 1024
+
 // Session represents a terminal session that can handle multiple clients
 type Session struct {
-	ID      string
-	PTY     *os.File
-	Command *exec.Cmd
-	Clients map[string]*websocket.Conn
-	mu      sync.RWMutex
-	done    chan struct{}
+	ID        string
+	ProjectID string
+	Args      []string // As requested, without the shell integration's
+	PTY       *os.File
+	Command   *exec.Cmd
+	CreatedAt time.Time
+	mu        sync.RWMutex
+	done      chan struct{}
+
+	// exit is how the shell ended; nil while it runs
+	exit *exitInfo
+
+	// listeners receive a copy of the output for in-process consumers
+	listeners map[chan []byte]struct{}
+
+	// scrollback keeps the latest output for clients that reconnect
+	scrollback *scrollback
+
+	// screen follows the output to know what the terminal shows
+	screen *Screen
+
+	// commands follows shell integration marks in the output to find the
+	// commands run at the prompt
+	commands *commandTracker
+
+	// history records the commands run in the session, if kept; typed
+	// rebuilds them from keystrokes when the shell doesn't report them
+	history *HistoryStore
+	typed   lineCapture
+
+	// clients are the connected WebSockets by ID; controller is the one that
+	// can type, if any
+	clients    map[string]*client
+	controller string
+	joins      int
+}
+
+// SessionOptions configures a new session. The zero value starts the user's
+// shell in the server's directory at 80x24.
+type SessionOptions struct {
+	Command   string // Shell or program to run; $SHELL by default
+	Args      []string
+	Dir       string            // Working directory
+	Env       map[string]string // Added to the server's environment
+	Rows      uint16
+	Cols      uint16
+	ProjectID string // Groups the sessions of a project
+
+	// NoShellIntegration starts bash, zsh or fish without the integration
+	// scripts that report commands
+	NoShellIntegration bool
+}
+
+// exitInfo records how a session's shell ended
+type exitInfo struct {
+	code   int    // -1 when killed by a signal
+	status string // e.g. "exit status 1" or "signal: killed"
+	at     time.Time
+}
+
+// SessionInfo describes a terminal session
+type SessionInfo struct {
+	ID         string   `json:"id"`
+	ProjectID  string   `json:"projectId,omitempty"`
+	PID        int      `json:"pid"`
+	Shell      string   `json:"shell"`
+	Args       []string `json:"args,omitempty"`
+	Cwd        string   `json:"cwd,omitempty"` // Only known while the shell runs
+	Rows       int      `json:"rows"`
+	Cols       int      `json:"cols"`
+	CreatedAt  int64    `json:"createdAt"`
+	Clients    int      `json:"clients"`
+	Controller string   `json:"controller,omitempty"` // ID of the client that can type
+	Running    bool     `json:"running"`
+	ExitCode   *int     `json:"exitCode,omitempty"`
+	ExitStatus string   `json:"exitStatus,omitempty"`
+	ExitedAt   int64    `json:"exitedAt,omitempty"`
+
+	// ShellIntegration is set when the shell was started with the scripts
+	// that report commands
+	ShellIntegration bool `json:"shellIntegration"`
 }
 
 // Manager handles terminal sessions
 type Manager struct {
 	sessions sync.Map
+	history  *HistoryStore
 }
 
-// NewManager creates a new terminal session manager
-func NewManager() *Manager {
+// NewManager creates a new terminal session manager. The commands run in its
+// sessions are recorded in history unless it is nil.
+func NewManager(history *HistoryStore) *Manager {
 	logger.Printf("🔧 Terminal manager initialized")
-	return &Manager{}
+	return &Manager{history: history}
+}
+
+// History returns the store of commands run in terminals, or nil if none is kept
+func (m *Manager) History() *HistoryStore {
+	return m.history
 }
 
 // NewSession creates a new terminal session
-func (m *Manager) NewSession() (*Session, error) {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
+func (m *Manager) NewSession(opts SessionOptions) (*Session, error) {
+	command := opts.Command
+	if command == "" {
+		command = os.Getenv("SHELL")
+	}
+	if command == "" {
+		command = "/bin/bash"
+	}
+	if opts.Dir != "" {
+		if info, err := os.Stat(opts.Dir); err != nil {
+			return nil, fmt.Errorf("invalid working directory: %v", err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("invalid working directory: %s is not a directory", opts.Dir)
+		}
+	}
+
+	args, integrationEnv, nonce := opts.Args, []string(nil), ""
+	if !opts.NoShellIntegration {
+		args, integrationEnv, nonce, _ = withShellIntegration(command, opts.Args)
 	}
 
-	// Create command with proper environment
-	cmd := exec.Command(shell)
+	// Create command with proper environment; the caller's variables come
+	// last so they win over the server's
+	cmd := exec.Command(command, args...)
+	cmd.Dir = opts.Dir
 	cmd.Env = append(os.Environ(),
 		"TERM=xterm-256color",
 		"COLORTERM=truecolor",
 		"LANG=en_US.UTF-8",
 	)
+	cmd.Env = append(cmd.Env, integrationEnv...)
+	for key, value := range opts.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
 
-	// Create PTY with specific window size
-	ptmx, err := pty.Start(cmd)
+	// Create PTY with the requested window size (80 columns x 24 rows is standard)
+	size := &pty.Winsize{Rows: opts.Rows, Cols: opts.Cols}
+	if size.Rows == 0 {
+		size.Rows = 24
+	}
+	if size.Cols == 0 {
+		size.Cols = 80
+	}
+	ptmx, err := pty.StartWithSize(cmd, size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start PTY: %v", err)
 	}
 
-	// Set terminal size (80 columns x 24 rows is standard)
-	if err := pty.Setsize(ptmx, &pty.Winsize{
-		Rows: 24,
-		Cols: 80,
-		X:    0,
-		Y:    0,
-	}); err != nil {
-		ptmx.Close()
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("failed to set terminal size: %v", err)
-	}
-
 	session := &Session{
-		ID:      generateID(),
-		PTY:     ptmx,
-		Command: cmd,
-		Clients: make(map[string]*websocket.Conn),
-		done:    make(chan struct{}),
+		ID:         generateID(),
+		ProjectID:  opts.ProjectID,
+		Args:       opts.Args,
+		PTY:        ptmx,
+		Command:    cmd,
+		CreatedAt:  time.Now(),
+		done:       make(chan struct{}),
+		listeners:  make(map[chan []byte]struct{}),
+		scrollback: newScrollback(scrollbackSize),
+		screen:     NewScreen(int(size.Rows), int(size.Cols)),
+		commands:   &commandTracker{nonce: nonce},
+		history:    m.history,
+		clients:    make(map[string]*client),
 	}
 
 	// Store session
@@ -83,10 +205,37 @@ func (m *Manager) NewSession() (*Session, error) {
 
 	// Start output handler
 	go session.handleOutput()
+	go m.reap(session)
 
 	return session, nil
 }
 
+// reap waits for a session's shell to exit, records how it ended and forgets
+// the session once it has been listed as exited for exitedSessionTTL
+func (m *Manager) reap(s *Session) {
+	err := s.Command.Wait()
+
+	info := &exitInfo{code: -1, status: "exited", at: time.Now()}
+	if state := s.Command.ProcessState; state != nil {
+		info.code = state.ExitCode()
+		info.status = state.String()
+	} else if err != nil {
+		info.status = err.Error()
+	}
+
+	s.mu.Lock()
+	s.exit = info
+	s.mu.Unlock()
+	s.Close()
+	logger.Printf("💀 Shell exited in session %s: %s", s.ID, info.status)
+
+	time.AfterFunc(exitedSessionTTL, func() {
+		if m.sessions.CompareAndDelete(s.ID, s) {
+			logger.Printf("🧹 Reaped exited session: %s", s.ID)
+		}
+	})
+}
+
 // handleOutput broadcasts terminal output to all connected clients
 func (s *Session) handleOutput() {
 	defer func() {
@@ -95,6 +244,7 @@ func (s *Session) handleOutput() {
 	}()
 
 	buffer := make([]byte, 32*1024)
+	var carry []byte
 	for {
 		select {
 		case <-s.done:
@@ -109,48 +259,146 @@ func (s *Session) handleOutput() {
 			}
 
 			if n > 0 {
-				output := buffer[:n]
-				s.broadcast(output)
+				// Hold back a character split across reads so every chunk is valid UTF-8
+				output := append(carry, buffer[:n]...)
+				cut := completeUTF8(output)
+				if cut > 0 {
+					s.broadcast(output[:cut])
+				}
+				carry = append(carry[:0], output[cut:]...)
 			}
 		}
 	}
 }
 
-// broadcast sends data to all connected clients
+// broadcast records data in the scrollback and queues it for all connected
+// clients. It never waits for a client, so reading the PTY keeps pace with
+// the program whatever the clients do.
 func (s *Session) broadcast(data []byte) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for clientID, conn := range s.Clients {
-		err := conn.WriteMessage(websocket.TextMessage, data)
-		if err != nil {
-			logger.Printf("⚠️ Failed to write to client %s: %v", clientID, err)
-			// Don't remove client here to avoid map mutation during iteration
+	// Recording under the lock means a joining client's replay ends exactly
+	// where its live output begins
+	offset := s.scrollback.write(data)
+
+	// The screen is fed up to each shell integration mark in turn, so it
+	// shows what the terminal did when the mark was printed
+	var events []*CommandMessage
+	prev := 0
+	s.commands.scanner.scan(data, func(end int, osc string) {
+		s.screen.Write(data[prev:end])
+		prev = end
+		if msg := s.commands.handle(osc, offset+uint64(end), s.screen); msg != nil {
+			events = append(events, msg)
+		}
+	})
+	s.screen.Write(data[prev:])
+
+	// Each encoding is made once and shared; the read buffer is reused, so
+	// the queued frames get their own copy
+	var plain, message, binary []byte
+	for _, c := range s.clients {
+		switch c.mode {
+		case modeText:
+			if plain == nil {
+				plain = append([]byte(nil), data...)
+			}
+			c.enqueue(frame{websocket.TextMessage, plain})
+		case modeJSON:
+			if message == nil {
+				message, _ = json.Marshal(OutputMessage{
+					Type:   "output",
+					Offset: offset,
+					Next:   offset + uint64(len(data)),
+					Data:   string(data),
+				})
+			}
+			c.enqueue(frame{websocket.TextMessage, message})
+		case modeBinary:
+			if binary == nil {
+				binary = encodeOutputFrame(offset, data)
+			}
+			c.enqueue(frame{websocket.BinaryMessage, binary})
+		}
+	}
+	for _, msg := range events {
+		for _, c := range s.clients {
+			s.send(c, msg)
+		}
+		if msg.Type == "command_finished" {
+			s.recordCommand(msg.Command)
+		}
+	}
+
+	if len(s.listeners) > 0 {
+		// The read buffer is reused, so listeners get their own copy
+		chunk := append([]byte(nil), data...)
+		for ch := range s.listeners {
+			select {
+			case ch <- chunk:
+			default:
+				// Never block the terminal on a slow listener
+			}
 		}
 	}
 }
 
-// AddClient adds a new client to the session
-func (s *Session) AddClient(clientID string, conn *websocket.Conn) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// RecentOutput returns up to the last 64 KiB of the session's output
+func (s *Session) RecentOutput() []byte {
+	return s.scrollback.tail(recentOutputSize)
+}
 
-	s.Clients[clientID] = conn
-	logger.Printf("👤 Client %s joined session %s", clientID, s.ID)
+// OutputOffset returns the position just past the latest output, where a
+// client that has seen everything so far would resume
+func (s *Session) OutputOffset() uint64 {
+	return s.scrollback.offset()
 }
 
-// RemoveClient removes a client from the session
-func (s *Session) RemoveClient(clientID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Commands returns the commands run at the session's prompt, oldest first,
+// as reported by shell integration. A running command comes last, without
+// an end.
+func (s *Session) Commands() []Command {
+	return s.commands.list()
+}
+
+// WorkingDir returns the shell's current directory, or "" where the platform
+// does not expose it
+func (s *Session) WorkingDir() string {
+	if s.Command == nil || s.Command.Process == nil {
+		return ""
+	}
+	dir, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", s.Command.Process.Pid))
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// Subscribe returns a channel that receives the session's output until the
+// returned function is called. Output is dropped if the channel falls behind.
+func (s *Session) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, 256)
 
-	if conn, exists := s.Clients[clientID]; exists {
-		conn.Close()
-		delete(s.Clients, clientID)
-		logger.Printf("👋 Client %s left session %s", clientID, s.ID)
+	s.mu.Lock()
+	s.listeners[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.listeners, ch)
+			s.mu.Unlock()
+		})
 	}
 }
 
+// Done returns a channel that is closed when the session ends
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
 // Write sends data to the terminal
 func (s *Session) Write(data []byte) error {
 	_, err := s.PTY.Write(data)
@@ -159,6 +407,11 @@ func (s *Session) Write(data []byte) error {
 
 // Close closes the terminal session
 func (s *Session) Close() error {
+	// The output handler, the reaper and callers can all close a session, so
+	// only the first one through the lock does the work
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	select {
 	case <-s.done:
 		return nil
@@ -166,14 +419,12 @@ func (s *Session) Close() error {
 		close(s.done)
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	// Close all client connections
-	for clientID, conn := range s.Clients {
-		conn.Close()
-		delete(s.Clients, clientID)
+	for clientID, c := range s.clients {
+		c.close()
+		delete(s.clients, clientID)
 	}
+	s.controller = ""
 
 	// Kill the process
 	if s.Command != nil && s.Command.Process != nil {
@@ -189,6 +440,71 @@ func (s *Session) Close() error {
 	return nil
 }
 
+// Info describes the session
+func (s *Session) Info() SessionInfo {
+	rows, cols := s.screen.Size()
+	info := SessionInfo{
+		ID:        s.ID,
+		ProjectID: s.ProjectID,
+		Shell:     s.Command.Path,
+		Args:      s.Args,
+		Rows:      rows,
+		Cols:      cols,
+		CreatedAt: s.CreatedAt.Unix(),
+
+		ShellIntegration: s.commands.nonce != "",
+	}
+	if s.Command.Process != nil {
+		info.PID = s.Command.Process.Pid
+	}
+
+	s.mu.RLock()
+	info.Clients = len(s.clients)
+	info.Controller = s.controller
+	exit := s.exit
+	s.mu.RUnlock()
+
+	if exit != nil {
+		code := exit.code
+		info.ExitCode = &code
+		info.ExitStatus = exit.status
+		info.ExitedAt = exit.at.Unix()
+	} else {
+		info.Running = true
+		info.Cwd = s.WorkingDir()
+		if info.Cwd == "" {
+			info.Cwd = s.commands.workingDir()
+		}
+	}
+	return info
+}
+
+// Exited reports whether the session's shell has exited or the session was closed
+func (s *Session) Exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ListSessions returns the sessions of a project, or every session when
+// projectID is empty, oldest first
+func (m *Manager) ListSessions(projectID string) []*Session {
+	var sessions []*Session
+	m.sessions.Range(func(_, value any) bool {
+		if session := value.(*Session); projectID == "" || session.ProjectID == projectID {
+			sessions = append(sessions, session)
+		}
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
 // GetSession retrieves a session by ID
 func (m *Manager) GetSession(id string) (*Session, bool) {
 	if sess, ok := m.sessions.Load(id); ok {
@@ -207,17 +523,37 @@ func (m *Manager) CloseSession(id string) {
 	}
 }
 
-// generateID generates a unique session ID
+// lastID is the most recent ID handed out by generateID
+var lastID atomic.Int64
+
+// generateID generates a unique session or client ID: the time in
+// nanoseconds, moved past the last ID when two are made in the same tick
 func generateID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	now := time.Now().UnixNano()
+	for {
+		last := lastID.Load()
+		id := max(now, last+1)
+		if lastID.CompareAndSwap(last, id) {
+			return strconv.FormatInt(id, 10)
+		}
+	}
 }
 
 // Resize updates the terminal window size
 func (s *Session) Resize(rows, cols uint16) error {
-	return pty.Setsize(s.PTY, &pty.Winsize{
+	if err := pty.Setsize(s.PTY, &pty.Winsize{
 		Rows: rows,
 		Cols: cols,
 		X:    0,
 		Y:    0,
-	})
+	}); err != nil {
+		return err
+	}
+	s.screen.Resize(int(rows), int(cols))
+	return nil
+}
+
+// GetScreen returns the text the terminal currently shows
+func (s *Session) GetScreen() ScreenContent {
+	return s.screen.Content()
 }
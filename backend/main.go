@@ -6,15 +6,23 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
+	"glask-ide/internal/ai"
+	aipb "glask-ide/internal/ai/proto"
 	"glask-ide/internal/api/handlers"
 	"glask-ide/internal/filesystem"
 	pb "glask-ide/internal/filesystem/proto"
 	"glask-ide/internal/grpc"
+	"glask-ide/internal/storage"
 	"glask-ide/internal/terminal"
+	termpb "glask-ide/internal/terminal/proto"
 )
 
+// defaultSystemPrompt is sent with every AI request
+const defaultSystemPrompt = "You are an expert coding assistant integrated into the Glask IDE. Be concise and precise."
+
 //go:embed static
 var frontendFiles embed.FS
 
@@ -48,6 +56,15 @@ func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 func main() {
 	logger.Printf("🚀 Starting Glask IDE backend server...")
 
+	// Open the local database
+	logger.Printf("🗄️ Opening database...")
+	db, err := storage.Open(storage.DefaultPath())
+	if err != nil {
+		logger.Fatalf("❌ Failed to open database: %v", err)
+	}
+	defer db.Close()
+	logger.Printf("✅ Database ready at %s", storage.DefaultPath())
+
 	// Initialize services
 	logger.Printf("📁 Initializing filesystem service...")
 	fsService, err := filesystem.NewService()
@@ -58,14 +75,64 @@ func main() {
 
 	// Initialize terminal service
 	logger.Printf("💻 Initializing terminal service...")
-	termManager := terminal.NewManager()
-	termHandler := terminal.NewHandler(termManager)
+	workspaceRoot := os.Getenv("IDE_WORKSPACE_ROOT")
+	if workspaceRoot == "" {
+		if workspaceRoot, err = os.UserHomeDir(); err != nil {
+			workspaceRoot = "/"
+		}
+	}
+	history, err := terminal.NewHistoryStore(db)
+	if err != nil {
+		logger.Fatalf("❌ Failed to create terminal history: %v", err)
+	}
+	termManager := terminal.NewManager(history)
+	termHandler := terminal.NewHandler(termManager, workspaceRoot)
+	executor := terminal.NewExecutor(workspaceRoot)
 	logger.Printf("✅ Terminal service initialized")
 
+	// Initialize AI service
+	logger.Printf("🤖 Initializing AI service...")
+	providerConfig := ai.DefaultProviderConfig()
+	if os.Getenv("AI_FAILOVER") == "false" {
+		providerConfig.Failover = false
+	}
+	cacheConfig := ai.DefaultCacheConfig()
+	if os.Getenv("AI_DISK_CACHE") != "false" {
+		cacheConfig.Dir = filepath.Join(storage.DefaultDataDir(), "ai-cache")
+	}
+	aiService, err := ai.NewService(
+		ai.Config{
+			Model:        "claude-3-haiku-20240307",
+			APIToken:     os.Getenv("CLAUDE_API_KEY"),
+			SystemPrompt: defaultSystemPrompt,
+			Temperature:  0.3,
+			MaxTokens:    2048,
+		},
+		ai.Config{
+			Model:        "gemini-pro",
+			APIToken:     os.Getenv("GEMINI_API_KEY"),
+			SystemPrompt: defaultSystemPrompt,
+			Temperature:  0.2,
+			MaxTokens:    1024,
+		},
+		providerConfig,
+		cacheConfig,
+		filepath.Join(storage.DefaultDataDir(), "prompts"),
+		db,
+		fsService,
+		termManager,
+	)
+	if err != nil {
+		logger.Fatalf("❌ Failed to create AI service: %v", err)
+	}
+	logger.Printf("✅ AI service initialized")
+
 	// Create in-process gRPC server
 	logger.Printf("🔄 Starting gRPC server...")
 	grpcServer := grpc.NewInProcessServer()
 	pb.RegisterFileSystemServiceServer(grpcServer.Server, filesystem.NewGRPCServer(fsService))
+	aipb.RegisterAIServiceServer(grpcServer.Server, ai.NewGRPCServer(aiService))
+	termpb.RegisterTerminalServiceServer(grpcServer.Server, terminal.NewGRPCServer(executor))
 	grpcServer.Start()
 	defer grpcServer.Stop()
 	logger.Printf("✅ gRPC server started")
@@ -81,6 +148,8 @@ func main() {
 
 	// Create HTTP handlers with gRPC client
 	fsHandler := handlers.NewFileSystemHandler(pb.NewFileSystemServiceClient(conn))
+	aiHandler := handlers.NewAIHandler(aipb.NewAIServiceClient(conn))
+	execHandler := handlers.NewExecHandler(termpb.NewTerminalServiceClient(conn))
 
 	// Create router
 	mux := http.NewServeMux()
@@ -97,8 +166,42 @@ func main() {
 	mux.HandleFunc("/api/fs/search", loggingMiddleware(fsHandler.HandleSearchFiles))
 	mux.HandleFunc("/api/fs/register", loggingMiddleware(fsHandler.HandleRegisterDirectory))
 
+	// AI endpoints
+	mux.HandleFunc("/api/ai/complete", loggingMiddleware(aiHandler.HandleComplete))
+	mux.HandleFunc("/api/ai/complete-inline", loggingMiddleware(aiHandler.HandleCompleteInline))
+	mux.HandleFunc("/api/ai/stream", loggingMiddleware(aiHandler.HandleStream))
+	mux.HandleFunc("/api/ai/models", loggingMiddleware(aiHandler.HandleGetModels))
+	mux.HandleFunc("/api/ai/models/active", loggingMiddleware(aiHandler.HandleSetActiveModel))
+	mux.HandleFunc("/api/ai/conversations", loggingMiddleware(aiHandler.HandleConversations))
+	mux.HandleFunc("/api/ai/conversations/messages", loggingMiddleware(aiHandler.HandleConversationMessages))
+	mux.HandleFunc("/api/ai/chat", loggingMiddleware(aiHandler.HandleChat))
+	mux.HandleFunc("/api/ai/context", loggingMiddleware(aiHandler.HandleBuildContext))
+	mux.HandleFunc("/api/ai/generate", loggingMiddleware(aiHandler.HandleGenerate))
+	mux.HandleFunc("/api/ai/refactor", loggingMiddleware(aiHandler.HandleRefactor))
+	mux.HandleFunc("/api/ai/analyze", loggingMiddleware(aiHandler.HandleAnalyze))
+	mux.HandleFunc("/api/ai/analyze-terminal", loggingMiddleware(aiHandler.HandleAnalyzeTerminal))
+	mux.HandleFunc("/api/ai/docs", loggingMiddleware(aiHandler.HandleGenerateDocs))
+	mux.HandleFunc("/api/ai/edits/apply", loggingMiddleware(aiHandler.HandleApplyEdits))
+	mux.HandleFunc("/api/ai/edits/undo", loggingMiddleware(aiHandler.HandleUndoEdits))
+	mux.HandleFunc("/api/ai/agent", loggingMiddleware(aiHandler.HandleAgent))
+	mux.HandleFunc("/api/ai/memory", loggingMiddleware(aiHandler.HandleMemory))
+	mux.HandleFunc("/api/ai/tokens", loggingMiddleware(aiHandler.HandleCountTokens))
+	mux.HandleFunc("/api/ai/usage", loggingMiddleware(aiHandler.HandleUsage))
+	mux.HandleFunc("/api/ai/usage/limits", loggingMiddleware(aiHandler.HandleUsageLimits))
+	mux.HandleFunc("/api/ai/templates", loggingMiddleware(aiHandler.HandleTemplates))
+
 	// Terminal endpoint
 	mux.HandleFunc("/api/terminal/session", loggingMiddleware(termHandler.HandleTerminalSession))
+	mux.HandleFunc("/api/terminal/screen", loggingMiddleware(termHandler.HandleScreen))
+	mux.HandleFunc("/api/terminal/commands", loggingMiddleware(termHandler.HandleCommands))
+	mux.HandleFunc("/api/terminal/history", loggingMiddleware(termHandler.HandleHistory))
+	mux.HandleFunc("/api/terminal/history/suggestions", loggingMiddleware(termHandler.HandleSuggestions))
+	mux.HandleFunc("/api/terminal/list", loggingMiddleware(termHandler.HandleList))
+	mux.HandleFunc("/api/terminal/get", loggingMiddleware(termHandler.HandleGet))
+	mux.HandleFunc("/api/terminal/terminate", loggingMiddleware(termHandler.HandleTerminate))
+	mux.HandleFunc("/api/terminal/resize", loggingMiddleware(termHandler.HandleResize))
+	mux.HandleFunc("/api/terminal/exec", loggingMiddleware(execHandler.HandleExec))
+	mux.HandleFunc("/api/terminal/exec/stream", loggingMiddleware(execHandler.HandleExecStream))
 
 	// Serve static frontend files
 	mux.Handle("/", http.FileServer(http.FS(frontendFiles)))
@@ -107,6 +210,7 @@ func main() {
 	logger.Printf("🌟 Server is starting on :3001...")
 	logger.Printf("🔥 API endpoints ready:")
 	logger.Printf("   - File System API: http://localhost:3001/api/fs/*")
+	logger.Printf("   - AI API:          http://localhost:3001/api/ai/*")
 	logger.Printf("   - Terminal API:    http://localhost:3001/api/terminal/*")
 
 	if err := http.ListenAndServe(":3001", mux); err != nil {